@@ -4,6 +4,7 @@ import (
 	"context"
 
 	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/locksutil"
 	"github.com/hashicorp/vault/sdk/logical"
 )
 
@@ -17,6 +18,8 @@ func Factory(ctx context.Context, conf *logical.BackendConfig) (logical.Backend,
 
 type pluginBackend struct {
 	*framework.Backend
+	// walletLocks serialise the signs of a wallet that update its entry.
+	walletLocks []*locksutil.LockEntry
 	// lock     sync.RWMutex
 	// registry map[adapters.BlockchainType]adapters.BlockchainAdapter // registry for blockchain adapters
 }
@@ -25,7 +28,7 @@ type pluginBackend struct {
 // for Vault. It must include each path
 // and the secrets it will store.
 func backend() *pluginBackend {
-	var b = pluginBackend{}
+	var b = pluginBackend{walletLocks: locksutil.CreateLocks()}
 	// b.registry = make(map[adapters.BlockchainType]adapters.BlockchainAdapter)
 	// b.registry[adapters.BlockchainETH] = eth.NewAdapter() // Assuming eth package implements
 
@@ -34,11 +37,23 @@ func backend() *pluginBackend {
 		PathsSpecial: &logical.Paths{
 			SealWrapStorage: []string{
 				"accounts/",
+				"wallets/",
 			},
 		},
 		Paths: framework.PathAppend(
 			walletsPaths(&b),
 			pathSign(&b),
+			pathSignUserOp(&b),
+			pathSignSafeTx(&b),
+			pathSignPSBT(&b),
+			pathMultisig(&b),
+			pathSignMessage(&b),
+			pathBumpFee(&b),
+			pathEstimate(&b),
+			pathWalletConfig(&b),
+			pathCaps(&b),
+			pathConfigSignet(&b),
+			pathWalletExport(&b),
 		),
 		Secrets:     []*framework.Secret{},
 		BackendType: logical.TypeLogical,
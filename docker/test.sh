@@ -88,7 +88,7 @@ demo_eth(){
   cat > payload.json <<EOF
   {
     "chainId": 97,
-    "to": "0x0000000000000000000000000000000000000000",
+    "to": "0x337610d27c682E347C9cD60BD4b3b107C9d34dDd",
     "value": 0,
     "data": "0x",
     "nonce": 0,
@@ -14,7 +14,29 @@ func GetAdapter(blockchainType BlockchainType) (BlockchainAdapter, error) {
 		return NewBtcAdapter(&chaincfg.MainNetParams), nil
 	case BlockchainBTCTestnet:
 		return NewBtcAdapter(&chaincfg.TestNet4Params), nil
+	case BlockchainBTCTestnet3:
+		return NewBtcAdapter(&chaincfg.TestNet3Params), nil
+	case BlockchainBTCSignet:
+		return NewBtcAdapter(&chaincfg.SigNetParams), nil
+	case BlockchainBTCRegtest:
+		return NewBtcAdapter(&chaincfg.RegressionNetParams), nil
 	default:
 		return nil, fmt.Errorf("unsupported blockchain type: %s", blockchainType)
 	}
 }
+
+// SignetConfig describes a custom signet network.
+type SignetConfig struct {
+	Challenge []byte // the block challenge script
+	Bech32HRP string // the segwit address prefix; "tb" when empty
+}
+
+// NewSignetAdapter returns the bitcoin adapter of a custom signet. Only the
+// address prefix affects signing; the challenge sets the network magic.
+func NewSignetAdapter(config SignetConfig) BlockchainAdapter {
+	params := chaincfg.CustomSignetParams(config.Challenge, nil)
+	if config.Bech32HRP != "" {
+		params.Bech32HRPSegwit = config.Bech32HRP
+	}
+	return NewBtcAdapter(&params)
+}
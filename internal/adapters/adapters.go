@@ -1,12 +1,164 @@
 package adapters
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"strings"
 )
 
 var ErrInvalidPayload = fmt.Errorf("invalid payload format")
 
+// PayloadError reports which payload field failed validation. It matches
+// ErrInvalidPayload with errors.Is.
+type PayloadError struct {
+	Field  string
+	Reason string
+}
+
+func (e *PayloadError) Error() string {
+	return fmt.Sprintf("%s: %s: %s", ErrInvalidPayload, e.Field, e.Reason)
+}
+
+func (e *PayloadError) Is(target error) bool {
+	return target == ErrInvalidPayload
+}
+
+func invalidField(field, format string, args ...interface{}) error {
+	return &PayloadError{Field: field, Reason: fmt.Sprintf(format, args...)}
+}
+
+// decodePayload strictly decodes a JSON payload into v, rejecting unknown
+// fields and trailing data.
+func decodePayload(jsonPayload string, v interface{}) error {
+	decoder := json.NewDecoder(strings.NewReader(jsonPayload))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			return invalidField(typeErr.Field, "expected %s, got %s", typeErr.Type, typeErr.Value)
+		}
+		if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+			return invalidField(strings.Trim(field, `"`), "unknown field")
+		}
+		return invalidField("payload", "%v", err)
+	}
+	// More reports false at a stray } or ], so decode again and require the
+	// end of the input.
+	if err := decoder.Decode(&struct{}{}); err != io.EOF {
+		return invalidField("payload", "unexpected data after the JSON object")
+	}
+	return nil
+}
+
 type BlockchainAdapter interface {
 	DeriveWallet() (*Wallet, error)
 	CreateSignedTransaction(wallet *Wallet, payload string) (string, error)
 }
+
+// SignResult is a signed transaction along with details of how it was built,
+// returned in the sign response next to the signature.
+type SignResult struct {
+	Tx      string
+	Details map[string]interface{}
+}
+
+// DetailedSigner is implemented by adapters that report how a transaction was
+// built, e.g. which inputs coin selection chose.
+type DetailedSigner interface {
+	CreateSignedTransactionDetailed(wallet *Wallet, payload string) (*SignResult, error)
+}
+
+// Policy constrains what an adapter may sign. The backend assembles it from
+// mount and wallet configuration for every request.
+type Policy struct {
+	// Caps resolves the safety caps for a chain. Nil disables cap checks.
+	Caps CapsLookup
+	// AllowDelegateCall permits signing Safe transactions with operation 1.
+	AllowDelegateCall bool
+	// ChangeWallets are addresses of other wallets in the mount that may
+	// receive bitcoin change.
+	ChangeWallets []string
+	// FeeLimits bound bitcoin fees. Nil leaves only the minimum relay fee
+	// rate.
+	FeeLimits *BtcFeeLimits
+}
+
+// AddressTypeDeriver is implemented by adapters that can create wallets with
+// more than one address type.
+type AddressTypeDeriver interface {
+	DeriveWalletOfType(addressType string) (*Wallet, error)
+}
+
+// PolicyEnforcer is implemented by adapters that honour a signing Policy.
+type PolicyEnforcer interface {
+	SetPolicy(policy *Policy)
+}
+
+// UserOperationSigner is implemented by adapters that can sign ERC-4337 user
+// operations. It returns the userOpHash and the owner signature, both 0x hex.
+type UserOperationSigner interface {
+	SignUserOperation(wallet *Wallet, userOp string, entryPoint string, chainID uint64) (string, string, error)
+}
+
+// SafeTransactionSigner is implemented by adapters that can sign Safe{Wallet}
+// multisig transactions as one of the owners. It returns the safeTxHash and
+// the owner signature, both 0x hex.
+type SafeTransactionSigner interface {
+	SignSafeTransaction(wallet *Wallet, safeAddress string, chainID uint64, safeTx string) (string, string, error)
+}
+
+// KeystoreImporter is implemented by adapters that can import an encrypted
+// keystore file as a wallet.
+type KeystoreImporter interface {
+	ImportKeystore(keystoreJSON []byte, password string) (*Wallet, error)
+}
+
+// PSBTSigner is implemented by adapters that can sign BIP174 partially
+// signed transactions.
+type PSBTSigner interface {
+	SignPSBT(wallet *Wallet, psbt string, finalize bool) (*PSBTResult, error)
+}
+
+// MultisigSigner is implemented by adapters that can build M-of-N multisig
+// wallets from wallet keys and external public keys, and add one wallet's
+// signatures to PSBTs spending them.
+type MultisigSigner interface {
+	NewMultisig(threshold int, internal []*Wallet, external []string, addressType string) (*Multisig, error)
+	SignMultisigPSBT(multisig *Multisig, signer *Wallet, psbt string, finalize bool) (*PSBTResult, error)
+}
+
+// MessageSigner is implemented by adapters that can sign messages with a
+// wallet key to prove ownership of its address, and verify such signatures.
+type MessageSigner interface {
+	SignMessage(wallet *Wallet, message, format string) (string, string, error)
+	VerifyMessage(address, message, signature, format string) (bool, error)
+}
+
+// FeeBumper is implemented by adapters that can speed up an unconfirmed
+// transaction, either by replacing it (BIP125) or by spending one of its
+// outputs with a higher fee (CPFP).
+type FeeBumper interface {
+	BumpFee(wallet *Wallet, payload string, tx string, feeRate float64) (*SignResult, error)
+	ChildPaysForParent(wallet *Wallet, parentTx string, parentUtxos string, feeRate float64) (*SignResult, error)
+}
+
+// FeeEstimator is implemented by adapters that can price a payment without
+// signing it. The estimate applies the same checks and signing policy as
+// signing, so a payload is rejected by both or by neither.
+type FeeEstimator interface {
+	EstimateFee(wallet *Wallet, payload string) (*FeeEstimate, error)
+}
+
+// AccountExporter is implemented by adapters whose wallets are derived from
+// HD accounts and can export the account's public data for watch-only use.
+type AccountExporter interface {
+	ExportAccount(wallet *Wallet) (*AccountExport, error)
+}
+
+// DescriptorExporter is implemented by adapters that can describe a wallet
+// with output descriptors.
+type DescriptorExporter interface {
+	Descriptors(wallet *Wallet) (*BtcDescriptors, error)
+}
@@ -3,10 +3,13 @@ package adapters
 import (
 	"bytes"
 	"encoding/hex"
-	"encoding/json"
 	"fmt"
+	"slices"
+	"strings"
+	"unicode/utf8"
 
 	btcec "github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
 	"github.com/btcsuite/btcd/btcutil"
 	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
@@ -22,25 +25,271 @@ type UTXO struct {
 	ScriptPubKey     string `json:"script_pub_key"`
 	ScriptPubKeyType string `json:"script_pubkey_type"`
 	Vout             uint32 `json:"vout"`
+	// Sequence overrides the input's nSequence, e.g. with a BIP68 relative
+	// locktime.
+	Sequence *uint32 `json:"sequence,omitempty"`
+	// Path is the key of the wallet's HD account the UTXO pays,
+	// "<chain>/<index>" below the account, e.g. "0/5" for the sixth receive
+	// address. Empty is the wallet key.
+	Path string `json:"path,omitempty"`
+}
+
+// BtcOutput is a payment to a single address.
+type BtcOutput struct {
+	Address string `json:"address"`
+	Amount  int64  `json:"amount"`
 }
 
 type BtcPayload struct {
-	Recipient string  `json:"recipient"`
-	Amount    int64   `json:"amount"`
-	FeeRate   float64 `json:"fee_rate"`
-	Utxos     []UTXO  `json:"utxos"` // Details for each utxo
+	// Recipient and Amount describe a single payment. They are kept for
+	// backward compatibility and cannot be combined with Outputs.
+	Recipient string      `json:"recipient,omitempty"`
+	Amount    int64       `json:"amount,omitempty"`
+	Outputs   []BtcOutput `json:"outputs,omitempty"`
+	FeeRate   float64     `json:"fee_rate"`
+	Utxos     []UTXO      `json:"utxos"` // Details for each utxo
+	// CoinSelection picks inputs from Utxos: "bnb", "knapsack" or
+	// "largest_first". Empty spends every UTXO.
+	CoinSelection string `json:"coin_selection,omitempty"`
+	// ChangeAddress receives the change instead of the wallet address. It
+	// must be an address of the wallet key or an allowlisted change wallet.
+	ChangeAddress string `json:"change_address,omitempty"`
+	// RBF signals BIP125 replaceability so the payment can be fee bumped.
+	RBF bool `json:"rbf,omitempty"`
+	// Locktime is the transaction's nLockTime: a block height below
+	// 500000000, otherwise a unix timestamp.
+	Locktime uint32 `json:"locktime,omitempty"`
+	// ChangeType pays the change to the wallet key's address of another type:
+	// "p2wpkh", "p2tr", "p2sh_p2wpkh" or "same_as_inputs". Empty keeps the
+	// wallet address, or a fresh change key for HD wallets.
+	ChangeType string `json:"change_type,omitempty"`
+	// ChangePath pays the change to the key of the wallet's HD account at
+	// this path, e.g. the change_path a sign returned when the payment is
+	// rebuilt to bump its fee.
+	ChangePath string `json:"change_path,omitempty"`
+	// OpReturn adds zero value OP_RETURN outputs after the payments, in
+	// order. A payload may carry only OpReturn outputs and no payment.
+	OpReturn []BtcOpReturn `json:"op_return,omitempty"`
+	// SendMax pays everything the UTXOs hold, less the fee, to the single
+	// recipient, whose amount is left out. No change is made.
+	SendMax bool `json:"send_max,omitempty"`
+	// AbsoluteFee pays exactly this many sats of fee instead of FeeRate per
+	// vbyte.
+	AbsoluteFee int64 `json:"absolute_fee,omitempty"`
+	// SubtractFeeFromOutputs lists, by index, the payment outputs that pay
+	// the fee between them, so the wallet pays only the amounts.
+	SubtractFeeFromOutputs []int `json:"subtract_fee_from_outputs,omitempty"`
+}
+
+// BtcOpReturn is the data of an OP_RETURN output, given as Hex or as UTF-8
+// Text.
+type BtcOpReturn struct {
+	Hex  string `json:"hex,omitempty"`
+	Text string `json:"text,omitempty"`
+}
+
+// payments returns the payload's payment outputs in order. The amount of a
+// send_max payment is left at zero.
+func (p *BtcPayload) payments() ([]BtcOutput, error) {
+	outputs := p.Outputs
+	if len(p.Outputs) == 0 {
+		outputs = []BtcOutput{{Address: p.Recipient, Amount: p.Amount}}
+		if p.Recipient == "" && p.Amount == 0 && len(p.OpReturn) > 0 {
+			outputs = nil
+		}
+	} else if p.Recipient != "" || p.Amount != 0 {
+		return nil, invalidField("outputs", "cannot be combined with recipient and amount")
+	}
+	if p.SendMax {
+		if err := p.checkSendMax(outputs); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.checkFeeMode(outputs); err != nil {
+		return nil, err
+	}
+	return outputs, nil
+}
+
+// checkFeeMode checks the payload's absolute_fee and
+// subtract_fee_from_outputs against its outputs and other settings.
+func (p *BtcPayload) checkFeeMode(outputs []BtcOutput) error {
+	switch {
+	case p.AbsoluteFee < 0:
+		return invalidField("absolute_fee", "must not be negative")
+	case p.AbsoluteFee > btcutil.MaxSatoshi:
+		return invalidField("absolute_fee", "%d exceeds the %d sats in existence", p.AbsoluteFee, int64(btcutil.MaxSatoshi))
+	case p.AbsoluteFee != 0 && p.FeeRate != 0:
+		return invalidField("absolute_fee", "set either fee_rate or absolute_fee, not both")
+	case p.AbsoluteFee != 0 && p.CoinSelection != "":
+		return invalidField("absolute_fee", "cannot be combined with coin_selection, which needs a fee_rate")
+	case len(p.SubtractFeeFromOutputs) > 0 && p.SendMax:
+		return invalidField("subtract_fee_from_outputs", "send_max already pays the fee from its payment")
+	}
+	seen := make(map[int]bool, len(p.SubtractFeeFromOutputs))
+	for i, index := range p.SubtractFeeFromOutputs {
+		field := fmt.Sprintf("subtract_fee_from_outputs[%d]", i)
+		if index < 0 || index >= len(outputs) {
+			return invalidField(field, "%d is not the index of one of the %d payments", index, len(outputs))
+		}
+		if seen[index] {
+			return invalidField(field, "repeats output %d", index)
+		}
+		seen[index] = true
+	}
+	return nil
+}
+
+// subtractFee takes fee out of the payment outputs at indices in equal
+// shares, the first paying any remainder. Each must stay above the dust limit
+// of its script.
+func subtractFee(outputs []*wire.TxOut, indices []int, fee int64) error {
+	n := int64(len(indices))
+	for i, index := range indices {
+		share := fee / n
+		if i == 0 {
+			share += fee % n
+		}
+		amount := outputs[index].Value
+		outputs[index].Value -= share
+		if limit := dustLimit(outputs[index].PkScript); outputs[index].Value < limit {
+			return invalidField("subtract_fee_from_outputs", "output %d of %d sats cannot pay %d sats of the fee and stay above the dust threshold of %d", index, amount, share, limit)
+		}
+	}
+	return nil
+}
+
+// nullData returns the data of the payload's OP_RETURN outputs in order. Each
+// is limited to the data carrier size nodes relay by default.
+func (p *BtcPayload) nullData() ([][]byte, error) {
+	data := make([][]byte, 0, len(p.OpReturn))
+	for i, opReturn := range p.OpReturn {
+		field := fmt.Sprintf("op_return[%d]", i)
+		var b []byte
+		switch {
+		case opReturn.Hex != "" && opReturn.Text != "":
+			return nil, invalidField(field, "set either hex or text, not both")
+		case opReturn.Hex != "":
+			var err error
+			b, err = hex.DecodeString(strings.TrimPrefix(opReturn.Hex, "0x"))
+			if err != nil {
+				return nil, invalidField(field+".hex", "%v", err)
+			}
+		case opReturn.Text != "":
+			if !utf8.ValidString(opReturn.Text) {
+				return nil, invalidField(field+".text", "is not valid UTF-8")
+			}
+			b = []byte(opReturn.Text)
+		default:
+			return nil, invalidField(field, "hex or text is required")
+		}
+		if len(b) > txscript.MaxDataCarrierSize {
+			return nil, invalidField(field, "%d bytes exceeds the standard limit of %d", len(b), txscript.MaxDataCarrierSize)
+		}
+		data = append(data, b)
+	}
+	return data, nil
+}
+
+// nullDataSizes returns the lengths of data.
+func nullDataSizes(data [][]byte) []int {
+	sizes := make([]int, len(data))
+	for i, b := range data {
+		sizes[i] = len(b)
+	}
+	return sizes
+}
+
+// Address types a bitcoin wallet can be created with.
+const (
+	AddressTypeP2WPKH     = "p2wpkh"
+	AddressTypeP2TR       = "p2tr"
+	AddressTypeP2SHP2WPKH = "p2sh_p2wpkh"
+)
+
+var addressTypes = []string{AddressTypeP2WPKH, AddressTypeP2TR, AddressTypeP2SHP2WPKH}
+
+// ChangeTypeSameAsInputs pays the change to the wallet address of the type
+// the payload's UTXOs are spent from.
+const ChangeTypeSameAsInputs = "same_as_inputs"
+
+// inputAddressTypes maps UTXO script types to the wallet address type that
+// receives them.
+var inputAddressTypes = map[string]string{
+	"v0_p2wpkh":   AddressTypeP2WPKH,
+	"v1_p2tr":     AddressTypeP2TR,
+	"p2sh_p2wpkh": AddressTypeP2SHP2WPKH,
+}
+
+// addressOutputTypes maps wallet address types to the output type the fee
+// estimator sizes them as.
+var addressOutputTypes = map[string]string{
+	AddressTypeP2WPKH:     "p2wpkh",
+	AddressTypeP2TR:       "p2tr",
+	AddressTypeP2SHP2WPKH: "p2sh",
+}
+
+// changeAddressType returns the wallet address type the payload's change_type
+// asks for, or "" to keep the wallet address.
+func (p *BtcPayload) changeAddressType() (string, error) {
+	if p.ChangeType == "" {
+		return "", nil
+	}
+	if p.ChangeAddress != "" {
+		return "", invalidField("change_type", "cannot be combined with change_address")
+	}
+	if p.ChangeType == ChangeTypeSameAsInputs {
+		inputType := ""
+		for _, utxo := range p.Utxos {
+			if inputType != "" && utxo.ScriptPubKeyType != inputType {
+				return "", invalidField("change_type", "%s requires UTXOs of a single script type", ChangeTypeSameAsInputs)
+			}
+			inputType = utxo.ScriptPubKeyType
+		}
+		addressType, ok := inputAddressTypes[inputType]
+		if !ok {
+			return "", invalidField("change_type", "no wallet address type receives %q UTXOs", inputType)
+		}
+		return addressType, nil
+	}
+	for _, addressType := range addressTypes {
+		if p.ChangeType == addressType {
+			return addressType, nil
+		}
+	}
+	return "", invalidField("change_type", "must be one of %s, %s", strings.Join(addressTypes, ", "), ChangeTypeSameAsInputs)
 }
 
 type btcAdapter struct {
-	net *chaincfg.Params
+	net    *chaincfg.Params
+	policy *Policy
 }
 
 func NewBtcAdapter(net *chaincfg.Params) *btcAdapter {
 	return &btcAdapter{net: net}
 }
 
+// SetPolicy sets the signing policy, which allowlists change wallets and
+// limits fees.
+func (a *btcAdapter) SetPolicy(policy *Policy) {
+	a.policy = policy
+}
+
 func (a *btcAdapter) DeriveWallet() (*Wallet, error) {
-	privateKey, err := btcec.NewPrivateKey()
+	return a.DeriveWalletOfType(AddressTypeP2WPKH)
+}
+
+// DeriveWalletOfType creates a wallet whose address is of the given type. A
+// p2tr wallet uses the BIP86 tweak of its key, committing to no script tree.
+// The key is the first receive key of a new HD account, derived under the
+// BIP84, BIP49 or BIP86 path of the address type, and the wallet keeps the
+// account key to sign for the account's other keys.
+func (a *btcAdapter) DeriveWalletOfType(addressType string) (*Wallet, error) {
+	purpose, ok := addressTypePurposes[addressType]
+	if !ok {
+		return nil, invalidField("address_type", "must be one of %s", strings.Join(addressTypes, ", "))
+	}
+	account, accountKey, privateKey, err := deriveHDAccount(a.net, purpose, a.net.HDCoinType, 0)
 	if err != nil {
 		return nil, err
 	}
@@ -50,207 +299,805 @@ func (a *btcAdapter) DeriveWallet() (*Wallet, error) {
 		return nil, err
 	}
 
-	addr, err := getPubKey(wif, a.net)
+	addr, err := walletAddress(wif, addressType, a.net)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get public key: %w", err)
+		return nil, err
 	}
 
 	return &Wallet{
 		PrivateKey: wif.String(),
 		PublicKey:  addr.EncodeAddress(),
+		Account:    account,
+		AccountKey: accountKey,
 	}, nil
 }
 
 func (a *btcAdapter) validatePayload(jsonPayload string) (*BtcPayload, error) {
 	var payload BtcPayload
-	if err := json.Unmarshal([]byte(jsonPayload), &payload); err != nil {
-		return nil, fmt.Errorf("failed to decode payload: %w", err)
+	if err := decodePayload(jsonPayload, &payload); err != nil {
+		return nil, err
+	}
+	if err := checkUtxos(payload.Utxos); err != nil {
+		return nil, err
 	}
 
 	return &payload, nil
 }
 
 func (a *btcAdapter) CreateSignedTransaction(wallet *Wallet, payload string) (string, error) {
+	result, err := a.CreateSignedTransactionDetailed(wallet, payload)
+	if err != nil {
+		return "", err
+	}
+	return result.Tx, nil
+}
+
+// CreateSignedTransactionDetailed signs a payment like CreateSignedTransaction
+// and reports the UTXOs coin selection spent and left unused, the fee, and
+// the path of an HD change key. Paying change to a fresh change key advances
+// wallet.ChangeIndex, and the caller stores the wallet.
+func (a *btcAdapter) CreateSignedTransactionDetailed(wallet *Wallet, payload string) (*SignResult, error) {
 	btcPayload, err := a.validatePayload(payload)
 	if err != nil {
-		return "", fmt.Errorf("invalid payload type, expected BtcPayload: %w", err)
+		return nil, fmt.Errorf("invalid payload type, expected BtcPayload: %w", err)
+	}
+	keys, addressType, err := a.walletKey(wallet)
+	if err != nil {
+		return nil, err
+	}
+
+	plan, err := a.planPayment(keys, addressType, btcPayload)
+	if err != nil {
+		return nil, err
 	}
-	_ = btcPayload
+	tx, err := a.newTx(keys, plan.spec)
+	if err != nil {
 
+		return nil, fmt.Errorf("failed to create transaction: %w", err)
+	}
+	hexSignedTx, err := serializeTx(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	details := map[string]interface{}{
+		"selected_utxos": UTXORefs(plan.spec.utxos),
+		"unused_utxos":   UTXORefs(plan.unused),
+		"fee":            txFee(tx, plan.spec.utxos),
+	}
+	if btcPayload.SendMax {
+		details["amount"] = plan.spec.outputs[0].Amount
+	}
+	if plan.changePath != "" {
+		changeScript, err := txscript.PayToAddrScript(plan.spec.change)
+		if err != nil {
+			return nil, err
+		}
+		// Change below the dust threshold is left to the fee, and the key
+		// stays fresh.
+		if slices.ContainsFunc(tx.TxOut, func(txOut *wire.TxOut) bool { return bytes.Equal(txOut.PkScript, changeScript) }) {
+			details["change_path"] = plan.changePath
+			if btcPayload.ChangePath == "" {
+				wallet.ChangeIndex++
+			}
+		}
+	}
+	return &SignResult{Tx: hexSignedTx, Details: details}, nil
+}
+
+// walletKey decodes the wallet's key, which must be for the adapter's
+// network, and returns the wallet's keys with the type of the wallet address.
+func (a *btcAdapter) walletKey(wallet *Wallet) (btcKeys, string, error) {
 	wif, err := btcutil.DecodeWIF(wallet.PrivateKey)
 	if err != nil {
-		return "", fmt.Errorf("failed to decode WIF: %w", err)
+		return btcKeys{}, "", fmt.Errorf("failed to decode WIF: %w", err)
 	}
 
 	// Ensure the provided wallet belongs to the adapter's configured network.
 	if !wif.IsForNet(a.net) {
-		return "", fmt.Errorf("wif network mismatch: wallet WIF not for %s", a.net.Name)
+		return btcKeys{}, "", fmt.Errorf("wif network mismatch: wallet WIF not for %s", a.net.Name)
 	}
 
-	tx, err := a.NewTxWithInputsAndOutputs(wif, btcPayload.Recipient, btcPayload.Amount, btcPayload.Utxos, btcPayload.FeeRate)
+	addressType, err := walletAddressType(wif, wallet.PublicKey, a.net)
+	if err != nil {
+		return btcKeys{}, "", err
+	}
+	return btcKeys{wif: wif, pub: wif.PrivKey.PubKey(), wallet: wallet, net: a.net}, addressType, nil
+}
+
+// publicWalletKey returns the wallet's keys without their private keys, with
+// the type of the wallet address. The wallet key of an HD wallet is the
+// account's first receive key and comes from the account's extended public
+// key; other wallets store no public key, so theirs comes from the wallet
+// key.
+func (a *btcAdapter) publicWalletKey(wallet *Wallet) (btcKeys, string, error) {
+	if wallet.Account == nil {
+		keys, addressType, err := a.walletKey(wallet)
+		keys.wif = nil
+		return keys, addressType, err
+	}
+	pub, err := wallet.Account.publicChildKey(a.net, "0/0")
+	if err != nil {
+		return btcKeys{}, "", err
+	}
+	addressType, err := pubKeyAddressType(pub, wallet.PublicKey, a.net)
 	if err != nil {
+		return btcKeys{}, "", err
+	}
+	return btcKeys{pub: pub, wallet: wallet, net: a.net}, addressType, nil
+}
 
-		return "", fmt.Errorf("failed to create transaction: %w", err)
+// btcKeys are the keys a wallet signs with: the wallet key and, for wallets
+// that kept their HD account key, the account keys UTXO paths name.
+type btcKeys struct {
+	wif    *btcutil.WIF // nil when the keys only plan, e.g. to estimate
+	pub    *btcec.PublicKey
+	wallet *Wallet // nil when only wif signs
+	net    *chaincfg.Params
+}
+
+// child returns the key of the wallet's HD account at path.
+func (k btcKeys) child(path string) (*btcutil.WIF, error) {
+	privKey, err := k.wallet.ChildKey(k.net, path)
+	if err != nil {
+		return nil, err
 	}
-	var signedTx bytes.Buffer
-	tx.Serialize(&signedTx)
+	return btcutil.NewWIF(privKey, k.net, true)
+}
 
-	hexSignedTx := hex.EncodeToString(signedTx.Bytes())
+// childPub returns the public key of the wallet's HD account at path, from
+// the account's extended public key. Like child, it needs the account key, so
+// payloads plan for exactly the keys the wallet signs for.
+func (k btcKeys) childPub(path string) (*btcec.PublicKey, error) {
+	if k.wallet == nil || k.wallet.Account == nil {
+		return nil, ErrNoHDAccount
+	}
+	if k.wallet.AccountKey == "" {
+		return nil, errNoAccountKey
+	}
+	return k.wallet.Account.publicChildKey(k.net, path)
+}
 
-	return hexSignedTx, nil
+// hdChange reports whether change goes to fresh keys of the wallet's HD
+// account, which needs the account key.
+func (k btcKeys) hdChange() bool {
+	return k.wallet != nil && k.wallet.AccountKey != ""
 }
 
-func (a *btcAdapter) NewTxWithInputsAndOutputs(wif *btcutil.WIF, destination string, amount int64, utxos []UTXO, feeRate float64) (*wire.MsgTx, error) {
-	redeemTx := wire.NewMsgTx(wire.TxVersion)
+// issuedChangeScripts maps the scripts of the change keys the wallet handed
+// out, 1/0 to 1/<ChangeIndex-1>, to their paths.
+func (k btcKeys) issuedChangeScripts() (map[string]string, error) {
+	scripts := map[string]string{}
+	if !k.hdChange() {
+		return scripts, nil
+	}
+	for index := range k.wallet.ChangeIndex {
+		path := fmt.Sprintf("1/%d", index)
+		key, err := k.childPub(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, script := range pubKeyScripts(key) {
+			scripts[string(script)] = path
+		}
+	}
+	return scripts, nil
+}
 
-	destinationAddr, err := btcutil.DecodeAddress(destination, a.net)
+// forUtxos returns the key that signs each of utxos.
+func (k btcKeys) forUtxos(utxos []UTXO) ([]*btcutil.WIF, error) {
+	keys := make([]*btcutil.WIF, len(utxos))
+	children := map[string]*btcutil.WIF{}
+	for i, utxo := range utxos {
+		if utxo.Path == "" {
+			keys[i] = k.wif
+			continue
+		}
+		key, ok := children[utxo.Path]
+		if !ok {
+			var err error
+			key, err = k.child(utxo.Path)
+			if err != nil {
+				return nil, invalidField("utxos", "%s:%d path %s: %v", utxo.Txid, utxo.Vout, utxo.Path, err)
+			}
+			children[utxo.Path] = key
+		}
+		keys[i] = key
+	}
+	return keys, nil
+}
+
+// pubsForUtxos returns the public key of the key that signs each of utxos.
+func (k btcKeys) pubsForUtxos(utxos []UTXO) ([]*btcec.PublicKey, error) {
+	keys := make([]*btcec.PublicKey, len(utxos))
+	for i, utxo := range utxos {
+		if utxo.Path == "" {
+			keys[i] = k.pub
+			continue
+		}
+		key, err := k.childPub(utxo.Path)
+		if err != nil {
+			return nil, invalidField("utxos", "%s:%d path %s: %v", utxo.Txid, utxo.Vout, utxo.Path, err)
+		}
+		keys[i] = key
+	}
+	return keys, nil
+}
+
+// publicKeys returns the public keys of wifs.
+func publicKeys(wifs []*btcutil.WIF) []*btcec.PublicKey {
+	keys := make([]*btcec.PublicKey, len(wifs))
+	for i, wif := range wifs {
+		keys[i] = wif.PrivKey.PubKey()
+	}
+	return keys
+}
+
+// btcPlan is a payload's payment as planned for the wallet key.
+type btcPlan struct {
+	spec   btcTx
+	unused []UTXO // UTXOs coin selection left out
+	// sendMax is the fee of a send_max payment, which pays what the fee
+	// leaves.
+	sendMax *FeeInfo
+	// changePath is the path of the HD account key the change goes to, if
+	// any.
+	changePath string
+}
+
+// planPayment checks the payload's payments, change and UTXOs for the wallet
+// key of addressType and runs its coin selection. Signing and estimating
+// share it, and buildTx, so both accept the same payloads.
+func (a *btcAdapter) planPayment(keys btcKeys, addressType string, payload *BtcPayload) (*btcPlan, error) {
+	outputs, err := payload.payments()
+	if err != nil {
+		return nil, err
+	}
+	nullData, err := payload.nullData()
 	if err != nil {
 		return nil, err
 	}
 
-	// Ensure destination address is for the adapter's configured network
-	if !destinationAddr.IsForNet(a.net) {
-		return nil, fmt.Errorf("destination address not for %s", a.net.Name)
+	changeAddr, changePath, err := a.changeAddress(keys, addressType, payload)
+	if err != nil {
+		return nil, err
 	}
 
-	destinationAddrByte, err := txscript.PayToAddrScript(destinationAddr)
+	selected, unused := payload.Utxos, []UTXO{}
+	if payload.CoinSelection != "" {
+		changeType, err := a.getOutputType(changeAddr.EncodeAddress())
+		if err != nil {
+			return nil, fmt.Errorf("failed to determine change type: %w", err)
+		}
+		selected, unused, err = a.selectPayloadCoins(payload, outputs, nullData, changeType)
+		if err != nil {
+			return nil, err
+		}
+	}
+	outputs, sendMax, err := a.sendMaxOutputs(payload, outputs, nullData, selected, payload.FeeRate, payload.AbsoluteFee)
 	if err != nil {
 		return nil, err
 	}
 
-	// Derive change address (use the same P2WPKH address for simplicity)
-	hash := btcutil.Hash160(wif.PrivKey.PubKey().SerializeCompressed())
-	changeAddr, err := btcutil.NewAddressWitnessPubKeyHash(hash, a.net)
-	// changeAddr, err := btcutil.NewAddressPubKey(wif.PrivKey.PubKey().SerializeUncompressed(), a.net)
+	return &btcPlan{
+		spec: btcTx{
+			outputs:         outputs,
+			utxos:           selected,
+			change:          changeAddr,
+			nullData:        nullData,
+			feeRate:         payload.FeeRate,
+			absoluteFee:     payload.AbsoluteFee,
+			subtractFeeFrom: payload.SubtractFeeFromOutputs,
+			rbf:             payload.RBF,
+			locktime:        payload.Locktime,
+		},
+		unused:     unused,
+		sendMax:    sendMax,
+		changePath: changePath,
+	}, nil
+}
 
+// changeAddress returns the address the payload's change is paid to: its
+// change_address, the wallet key's address of its change_type, or the
+// addressType address of the HD account key at its change_path. Otherwise
+// HD wallets pay change to a fresh change key, 1/<ChangeIndex>, and other
+// wallets to the wallet address. The path of an HD change key is returned
+// with the address.
+func (a *btcAdapter) changeAddress(keys btcKeys, addressType string, payload *BtcPayload) (btcutil.Address, string, error) {
+	changeType, err := payload.changeAddressType()
 	if err != nil {
-		return nil, fmt.Errorf("failed to derive change address: %v", err)
+		return nil, "", err
+	}
+	if payload.ChangePath != "" && (payload.ChangeAddress != "" || changeType != "") {
+		return nil, "", invalidField("change_path", "cannot be combined with change_address or change_type")
+	}
+	if changeType != "" {
+		addr, err := pubKeyAddress(keys.pub, changeType, a.net)
+		return addr, "", err
+	}
+	if payload.ChangeAddress == "" {
+		path := payload.ChangePath
+		if path == "" && keys.hdChange() {
+			path = fmt.Sprintf("1/%d", keys.wallet.ChangeIndex)
+		}
+		if path == "" {
+			addr, err := pubKeyAddress(keys.pub, addressType, a.net)
+			return addr, "", err
+		}
+		key, err := keys.childPub(path)
+		if err != nil {
+			return nil, "", invalidField("change_path", "%v", err)
+		}
+		addr, err := pubKeyAddress(key, addressType, a.net)
+		return addr, path, err
 	}
 
-	if !changeAddr.IsForNet(a.net) {
-		return nil, fmt.Errorf("change address not for %s", a.net.Name)
+	addr, err := btcutil.DecodeAddress(payload.ChangeAddress, a.net)
+	if err != nil {
+		return nil, "", invalidField("change_address", "%v", err)
 	}
+	if !addr.IsForNet(a.net) {
+		return nil, "", invalidField("change_address", "address not for %s", a.net.Name)
+	}
+	pkScript, err := txscript.PayToAddrScript(addr)
+	if err != nil {
+		return nil, "", invalidField("change_address", "%v", err)
+	}
+	if _, ok := pubKeyScripts(keys.pub).match(pkScript); ok {
+		return addr, "", nil
+	}
+	if a.policy != nil {
+		for _, allowed := range a.policy.ChangeWallets {
+			if allowed == addr.EncodeAddress() {
+				return addr, "", nil
+			}
+		}
+	}
+	return nil, "", invalidField("change_address", "%s is neither an address of this wallet nor an allowlisted change wallet", payload.ChangeAddress)
+}
 
-	// README: THIS ALWAYS MIGRATES TO v0_p2wpkh ADDRESS. is this waht we want? what about specifiying the destination address
-	changeAddrByte, err := txscript.PayToAddrScript(changeAddr)
+// selectPayloadCoins runs the payload's coin selection over its UTXOs, sizing
+// the OP_RETURN outputs of nullData and change as an output of changeType.
+func (a *btcAdapter) selectPayloadCoins(payload *BtcPayload, outputs []BtcOutput, nullData [][]byte, changeType string) ([]UTXO, []UTXO, error) {
+	params := coinSelection{feeRate: payload.FeeRate, nullDataSizes: nullDataSizes(nullData)}
+	for i, output := range outputs {
+		_, destType, err := a.paymentOutput(i, output)
+		if err != nil {
+			return nil, nil, err
+		}
+		params.outputTypes = append(params.outputTypes, destType)
+	}
+	amount, err := checkAmounts(outputs)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create change script: %v", err)
+		return nil, nil, err
 	}
+	params.amount = amount
+	params.changeType = changeType
 
-	var totalInputValue int64
-	inputTypes := make([]string, 0, len(utxos))
+	return selectCoins(payload.CoinSelection, payload.Utxos, params)
+}
 
-	for _, utxo := range utxos {
+// UTXORefs formats UTXOs as txid:vout outpoints.
+func UTXORefs(utxos []UTXO) []string {
+	refs := make([]string, len(utxos))
+	for i, utxo := range utxos {
+		refs[i] = fmt.Sprintf("%s:%d", utxo.Txid, utxo.Vout)
+	}
+	return refs
+}
 
-		switch utxo.ScriptPubKeyType {
-		case "v0_p2wpkh":
-			expectedScript := append([]byte{0x00, 0x14}, hash...)
-			if utxo.ScriptPubKey != hex.EncodeToString(expectedScript) {
-				return nil, fmt.Errorf("UTXO scriptPubKey does not match wallet's P2WPKH address")
-			}
-		case "p2pkh":
-			expectedScript := append(append([]byte{0x76, 0xa9, 0x14}, hash...), 0x88, 0xac)
-			if utxo.ScriptPubKey != hex.EncodeToString(expectedScript) {
-				return nil, fmt.Errorf("UTXO scriptPubKey does not match wallet's P2PKH address")
-			}
-		default:
-			return nil, fmt.Errorf("unsupported script type: %s", utxo.ScriptPubKeyType)
+// NewTxWithInputsAndOutputs builds and signs a transaction paying outputs, in
+// order, from utxos. Change goes back to the wallet's addressType address.
+func (a *btcAdapter) NewTxWithInputsAndOutputs(wif *btcutil.WIF, addressType string, outputs []BtcOutput, utxos []UTXO, feeRate float64) (*wire.MsgTx, error) {
+	changeAddr, err := walletAddress(wif, addressType, a.net)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive change address: %w", err)
+	}
+	return a.newTx(btcKeys{wif: wif, pub: wif.PrivKey.PubKey(), net: a.net}, btcTx{outputs: outputs, utxos: utxos, change: changeAddr, feeRate: feeRate})
+}
+
+// btcTx describes a payment for newTx to build and sign.
+type btcTx struct {
+	outputs     []BtcOutput
+	utxos       []UTXO
+	change      btcutil.Address
+	feeRate     float64
+	absoluteFee int64    // the fee in sats, instead of feeRate
+	nullData    [][]byte // OP_RETURN outputs, after the payments
+	rbf         bool     // signal BIP125 replaceability
+	locktime    uint32   // nLockTime
+	// subtractFeeFrom are the indices of the outputs that pay the fee.
+	subtractFeeFrom []int
+}
+
+// newTx builds and signs a transaction paying spec.outputs, in order, from
+// spec.utxos. The OP_RETURN outputs of spec.nullData follow the payments and
+// any change, going to spec.change, comes last.
+func (a *btcAdapter) newTx(keys btcKeys, spec btcTx) (*wire.MsgTx, error) {
+	inputKeys, err := keys.forUtxos(spec.utxos)
+	if err != nil {
+		return nil, err
+	}
+	redeemTx, prevOuts, _, err := a.buildTx(publicKeys(inputKeys), spec)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := signInputs(redeemTx, inputKeys, spec.utxos, prevOuts); err != nil {
+		return nil, err
+	}
+	if err := verifySignedTx(redeemTx, prevOuts); err != nil {
+		return nil, err
+	}
+	return redeemTx, nil
+}
+
+// buildTx builds the unsigned transaction of spec, spending UTXOs that pay
+// the scripts of inputKeys, one public key per UTXO, and checks its fee against the
+// signing policy. It returns the prevouts of the inputs and the fee
+// calculation.
+func (a *btcAdapter) buildTx(inputKeys []*btcec.PublicKey, spec btcTx) (*wire.MsgTx, *txscript.MultiPrevOutFetcher, *FeeInfo, error) {
+	limits := a.feeLimits()
+	if spec.absoluteFee == 0 {
+		if err := checkRelayFeeRate(spec.feeRate); err != nil {
+			return nil, nil, nil, err
 		}
+		if err := limits.checkFeeRate(spec.feeRate); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	if err := checkUtxos(spec.utxos); err != nil {
+		return nil, nil, nil, err
+	}
 
-		utxoHash, err := chainhash.NewHashFromStr(utxo.Txid)
+	redeemTx := wire.NewMsgTx(wire.TxVersion)
+
+	destTypes := make([]string, 0, len(spec.outputs))
+	for i, output := range spec.outputs {
+		txOut, destType, err := a.paymentOutput(i, output)
 		if err != nil {
-			return nil, err
+			return nil, nil, nil, err
 		}
+		redeemTx.AddTxOut(txOut)
+		destTypes = append(destTypes, destType)
+	}
+	amount, err := checkAmounts(spec.outputs)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	for _, data := range spec.nullData {
+		script, err := txscript.NullDataScript(data)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		redeemTx.AddTxOut(wire.NewTxOut(0, script))
+	}
 
-		outPoint := wire.NewOutPoint(utxoHash, utxo.Vout)
+	changeAddr := spec.change
+	if !changeAddr.IsForNet(a.net) {
+		return nil, nil, nil, fmt.Errorf("change address not for %s", a.net.Name)
+	}
 
-		// making the input, and adding it to transaction
-		txIn := wire.NewTxIn(outPoint, nil, nil)
-		redeemTx.AddTxIn(txIn)
+	changeAddrByte, err := txscript.PayToAddrScript(changeAddr)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to create change script: %w", err)
+	}
 
+	prevOuts, err := addInputs(redeemTx, inputKeys, spec.utxos, spec.rbf)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if err := setTimelocks(redeemTx, spec); err != nil {
+		return nil, nil, nil, err
+	}
+	var totalInputValue int64
+	inputTypes := make([]string, 0, len(spec.utxos))
+	for _, utxo := range spec.utxos {
 		totalInputValue += utxo.Value
 		inputTypes = append(inputTypes, utxo.ScriptPubKeyType)
-
 	}
 
-	// estimatedSize := len(utxos)*148 + 3*34 + 10 // inputs * 148 + outputs * 34 + overhead
-	// estimatedFee := int64(estimatedSize) *
-	destType, err := a.getOutputType(destination)
+	changeType, err := a.getOutputType(changeAddr.EncodeAddress())
 	if err != nil {
-		return nil, fmt.Errorf("failed to determine destination type: %v", err)
+		return nil, nil, nil, fmt.Errorf("failed to determine change type: %w", err)
 	}
 
-	feeInfo, err := CalculateFee(destType, inputTypes, amount, totalInputValue, feeRate)
+	feeInfo, err := CalculateFee(FeeParams{
+		InputTypes:    inputTypes,
+		OutputTypes:   destTypes,
+		NullDataSizes: nullDataSizes(spec.nullData),
+		ChangeType:    changeType,
+		Amount:        amount,
+		TotalInput:    totalInputValue,
+		FeeRate:       spec.feeRate,
+		AbsoluteFee:   spec.absoluteFee,
+		SubtractFee:   len(spec.subtractFeeFrom) > 0,
+	})
 
 	if err != nil {
-		return nil, fmt.Errorf("failed to calculate fee: %v", err)
+		return nil, nil, nil, fmt.Errorf("failed to calculate fee: %w", err)
+	}
+	if spec.absoluteFee != 0 {
+		if err := limits.checkAbsoluteFee(spec.absoluteFee, feeInfo.TxSize); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	if feeInfo.Subtracted > 0 {
+		if err := subtractFee(redeemTx.TxOut, spec.subtractFeeFrom, feeInfo.Subtracted); err != nil {
+			return nil, nil, nil, err
+		}
 	}
 
-	estimatedFee := feeInfo.EstimatedFee
-	if amount <= 0 {
-		return nil, fmt.Errorf("amount to send must be positive")
+	// CalculateFee adds change below the dust threshold to the fee.
+	if feeInfo.ChangeValue > 0 {
+		redeemTx.AddTxOut(wire.NewTxOut(feeInfo.ChangeValue, changeAddrByte))
 	}
-	changeValue := totalInputValue - amount - estimatedFee
-	if changeValue < 0 {
-		return nil, fmt.Errorf("insufficient funds. Total: %d, Amount: %d, Fee: %d", totalInputValue, amount, estimatedFee)
+	if err := limits.checkFee(feeInfo.EstimatedFee, amount); err != nil {
+		return nil, nil, nil, err
+	}
+	return redeemTx, prevOuts, feeInfo, nil
+}
+
+// rbfSequence is the highest input sequence number that signals BIP125
+// replaceability.
+const rbfSequence = wire.MaxTxInSequenceNum - 2
+
+// addInputs adds an input to tx for each of utxos, which must pay one of the
+// scripts of its key in keys, and returns their prevouts.
+func addInputs(tx *wire.MsgTx, keys []*btcec.PublicKey, utxos []UTXO, rbf bool) (*txscript.MultiPrevOutFetcher, error) {
+	prevOuts := txscript.NewMultiPrevOutFetcher(nil)
+	for i, utxo := range utxos {
+
+		expectedScript, ok := pubKeyScripts(keys[i])[utxo.ScriptPubKeyType]
+		if !ok {
+			return nil, fmt.Errorf("unsupported script type: %s", utxo.ScriptPubKeyType)
+		}
+		if utxo.ScriptPubKey != hex.EncodeToString(expectedScript) {
+			if utxo.Path != "" {
+				return nil, fmt.Errorf("UTXO scriptPubKey does not match the wallet account's %s address at %s", scriptTypeName(utxo.ScriptPubKeyType), utxo.Path)
+			}
+			return nil, fmt.Errorf("UTXO scriptPubKey does not match wallet's %s address", scriptTypeName(utxo.ScriptPubKeyType))
+		}
+
+		utxoHash, err := chainhash.NewHashFromStr(utxo.Txid)
+		if err != nil {
+			return nil, err
+		}
+
+		outPoint := wire.NewOutPoint(utxoHash, utxo.Vout)
+
+		// making the input, and adding it to transaction
+		txIn := wire.NewTxIn(outPoint, nil, nil)
+		if rbf {
+			txIn.Sequence = rbfSequence
+		}
+		if utxo.Sequence != nil {
+			txIn.Sequence = *utxo.Sequence
+		}
+		tx.AddTxIn(txIn)
+		prevOuts.AddPrevOut(*outPoint, wire.NewTxOut(utxo.Value, expectedScript))
 	}
+	return prevOuts, nil
+}
+
+// Bits of a BIP68 relative locktime sequence that carry meaning.
+const sequenceLockTimeBits = wire.SequenceLockTimeIsSeconds | wire.SequenceLockTimeMask
+
+// setTimelocks sets tx's nLockTime and checks it against the input sequence
+// numbers. Inputs without an explicit sequence are made non-final so the
+// locktime is enforced, and a BIP68 relative locktime makes tx version 2.
+func setTimelocks(tx *wire.MsgTx, spec btcTx) error {
+	tx.LockTime = spec.locktime
 
-	txOut := wire.NewTxOut(int64(amount), destinationAddrByte)
-	redeemTx.AddTxOut(txOut)
+	enforced, signalsRBF := false, false
+	for i, txIn := range tx.TxIn {
+		if spec.locktime != 0 && spec.utxos[i].Sequence == nil && txIn.Sequence == wire.MaxTxInSequenceNum {
+			txIn.Sequence = wire.MaxTxInSequenceNum - 1
+		}
+		if txIn.Sequence != wire.MaxTxInSequenceNum {
+			enforced = true
+		}
+		if txIn.Sequence <= rbfSequence {
+			signalsRBF = true
+		}
+		if txIn.Sequence&wire.SequenceLockTimeDisabled == 0 {
+			if txIn.Sequence&^sequenceLockTimeBits != 0 {
+				return invalidField("utxos", "sequence %#x of %s sets bits BIP68 does not define", txIn.Sequence, txIn.PreviousOutPoint)
+			}
+			// Relative locktimes are only enforced from version 2.
+			tx.Version = 2
+		}
+	}
 
-	// Add change output (if change is above dust threshold, e.g., 546 satoshis)
-	if changeValue >= 546 {
-		changeTxOut := wire.NewTxOut(int64(changeValue), changeAddrByte)
-		redeemTx.AddTxOut(changeTxOut)
-	} else if changeValue > 0 {
-		// If change is below dust threshold, add it to the fee
-		estimatedFee += int64(changeValue)
+	if spec.locktime != 0 && !enforced {
+		return invalidField("locktime", "is not enforced when every input sequence is final (%#x)", uint32(wire.MaxTxInSequenceNum))
+	}
+	if spec.rbf && !signalsRBF {
+		return invalidField("rbf", "no input sequence is %#x or below", uint32(rbfSequence))
 	}
+	return nil
+}
 
+// signInputs signs every input of tx, which spends utxos in order, each with
+// its key in keys.
+func signInputs(tx *wire.MsgTx, keys []*btcutil.WIF, utxos []UTXO, prevOuts txscript.PrevOutputFetcher) error {
+	// Taproot sighashes commit to every spent output, so all inputs share
+	// sighashes computed from the full set of prevouts.
+	sigHashes := txscript.NewTxSigHashes(tx, prevOuts)
 	for idx, utxo := range utxos {
+		wif := keys[idx]
 
 		witnessScript := utxo.ScriptPubKey
 
 		sourcePKScript, err := hex.DecodeString(witnessScript)
 		if err != nil {
-			return nil, err
+			return err
 		}
 		switch utxo.ScriptPubKeyType {
 		case "v0_p2wpkh":
-			sigHashes := txscript.NewTxSigHashes(redeemTx, txscript.NewCannedPrevOutputFetcher(
-				sourcePKScript, utxo.Value))
-			signature, err := txscript.WitnessSignature(redeemTx, sigHashes, idx, int64(utxo.Value), sourcePKScript, txscript.SigHashAll, wif.PrivKey, true)
+			signature, err := txscript.WitnessSignature(tx, sigHashes, idx, int64(utxo.Value), sourcePKScript, txscript.SigHashAll, wif.PrivKey, true)
 			if err != nil {
-				return nil, err
+				return err
 			}
 
 			// Create witness stack
-			redeemTx.TxIn[idx].Witness = signature
-			redeemTx.TxIn[idx].SignatureScript = []byte{}
+			tx.TxIn[idx].Witness = signature
+			tx.TxIn[idx].SignatureScript = []byte{}
+		case "p2sh_p2wpkh":
+			// The witness program is revealed as the redeem script and
+			// signed like a native P2WPKH input.
+			redeemScript := walletScripts(wif)["v0_p2wpkh"]
+			witness, err := txscript.WitnessSignature(tx, sigHashes, idx, utxo.Value, redeemScript, txscript.SigHashAll, wif.PrivKey, true)
+			if err != nil {
+				return err
+			}
+			sigScript, err := txscript.NewScriptBuilder().AddData(redeemScript).Script()
+			if err != nil {
+				return err
+			}
+			tx.TxIn[idx].Witness = witness
+			tx.TxIn[idx].SignatureScript = sigScript
+		case "v1_p2tr":
+			witness, err := txscript.TaprootWitnessSignature(tx, sigHashes, idx, utxo.Value, sourcePKScript, txscript.SigHashDefault, wif.PrivKey)
+			if err != nil {
+				return err
+			}
+			tx.TxIn[idx].Witness = witness
+			tx.TxIn[idx].SignatureScript = []byte{}
 		case "p2pkh":
-			signature, err := txscript.SignatureScript(redeemTx, idx, sourcePKScript,
+			signature, err := txscript.SignatureScript(tx, idx, sourcePKScript,
 				txscript.SigHashAll, wif.PrivKey, true)
 			if err != nil {
-				return nil, err
+				return err
 			}
-			redeemTx.TxIn[idx].SignatureScript = signature
+			tx.TxIn[idx].SignatureScript = signature
 		default:
-			return nil, fmt.Errorf("unsupported script type: %s", utxo.ScriptPubKeyType)
+			return fmt.Errorf("unsupported script type: %s", utxo.ScriptPubKeyType)
 
 		}
 
 	}
-
-	return redeemTx, nil
+	return nil
 }
 
-func getPubKey(wif *btcutil.WIF, cfg *chaincfg.Params) (*btcutil.AddressWitnessPubKeyHash, error) {
-	hash := btcutil.Hash160(wif.PrivKey.PubKey().SerializeCompressed())
-	addr, err := btcutil.NewAddressWitnessPubKeyHash(hash, cfg)
+// paymentOutput validates the i-th payment and returns its output along with
+// the destination's address type.
+func (a *btcAdapter) paymentOutput(i int, output BtcOutput) (*wire.TxOut, string, error) {
+	field := fmt.Sprintf("outputs[%d]", i)
+	if output.Amount <= 0 {
+		return nil, "", invalidField(field+".amount", "amount to send must be positive")
+	}
+
+	destinationAddr, err := btcutil.DecodeAddress(output.Address, a.net)
 	if err != nil {
-		return nil, err
+		return nil, "", invalidField(field+".address", "%v", err)
+	}
+
+	// Ensure destination address is for the adapter's configured network
+	if !destinationAddr.IsForNet(a.net) {
+		return nil, "", invalidField(field+".address", "destination address not for %s", a.net.Name)
+	}
+
+	destType, err := a.getOutputType(output.Address)
+	if err != nil {
+		return nil, "", invalidField(field+".address", "%v", err)
+	}
+
+	destinationAddrByte, err := txscript.PayToAddrScript(destinationAddr)
+	if err != nil {
+		return nil, "", err
+	}
+	if limit := dustLimit(destinationAddrByte); output.Amount < limit {
+		return nil, "", invalidField(field+".amount", "%d is below the dust threshold of %d", output.Amount, limit)
+	}
+	return wire.NewTxOut(output.Amount, destinationAddrByte), destType, nil
+}
+
+// btcWalletScripts maps each supported UTXO script type to the scriptPubKey
+// a single wallet key spends under that type.
+type btcWalletScripts map[string][]byte
+
+func walletScripts(wif *btcutil.WIF) btcWalletScripts {
+	return pubKeyScripts(wif.PrivKey.PubKey())
+}
+
+// pubKeyScripts returns the scripts of the key pub, keyed by UTXO script
+// type.
+func pubKeyScripts(pub *btcec.PublicKey) btcWalletScripts {
+	scripts := pubKeyHashScripts(btcutil.Hash160(pub.SerializeCompressed()))
+	outputKey := txscript.ComputeTaprootKeyNoScript(pub)
+	scripts["v1_p2tr"] = append([]byte{0x51, 0x20}, schnorr.SerializePubKey(outputKey)...)
+	return scripts
+}
+
+// pubKeyHashScripts returns the scripts that commit to a key by its hash160.
+func pubKeyHashScripts(hash []byte) btcWalletScripts {
+	witnessProgram := append([]byte{0x00, 0x14}, hash...)
+	return btcWalletScripts{
+		"v0_p2wpkh":   witnessProgram,
+		"p2sh_p2wpkh": append(append([]byte{0xa9, 0x14}, btcutil.Hash160(witnessProgram)...), 0x87),
+		"p2pkh":       append(append([]byte{0x76, 0xa9, 0x14}, hash...), 0x88, 0xac),
+	}
+}
+
+// scriptTypeName turns a UTXO script type into its conventional name, e.g.
+// "p2sh_p2wpkh" into "P2SH-P2WPKH".
+func scriptTypeName(scriptType string) string {
+	name := strings.TrimPrefix(strings.TrimPrefix(scriptType, "v0_"), "v1_")
+	return strings.ToUpper(strings.ReplaceAll(name, "_", "-"))
+}
+
+// match returns the script type under which pkScript belongs to the wallet.
+func (s btcWalletScripts) match(pkScript []byte) (string, bool) {
+	for scriptType, script := range s {
+		if bytes.Equal(script, pkScript) {
+			return scriptType, true
+		}
+	}
+	return "", false
+}
+
+// walletAddress returns the wallet key's address of the given type.
+func walletAddress(wif *btcutil.WIF, addressType string, net *chaincfg.Params) (btcutil.Address, error) {
+	return pubKeyAddress(wif.PrivKey.PubKey(), addressType, net)
+}
+
+// pubKeyAddress returns the address of the given type of the key pub.
+func pubKeyAddress(pub *btcec.PublicKey, addressType string, net *chaincfg.Params) (btcutil.Address, error) {
+	switch addressType {
+	case AddressTypeP2WPKH:
+		hash := btcutil.Hash160(pub.SerializeCompressed())
+		return btcutil.NewAddressWitnessPubKeyHash(hash, net)
+	case AddressTypeP2TR:
+		outputKey := txscript.ComputeTaprootKeyNoScript(pub)
+		return btcutil.NewAddressTaproot(schnorr.SerializePubKey(outputKey), net)
+	case AddressTypeP2SHP2WPKH:
+		witnessProgram := pubKeyScripts(pub)["v0_p2wpkh"]
+		return btcutil.NewAddressScriptHash(witnessProgram, net)
+	default:
+		return nil, invalidField("address_type", "must be one of %s", strings.Join(addressTypes, ", "))
+	}
+}
+
+// walletAddressType returns the type of the wallet key's address matching
+// address, failing if address does not belong to the key.
+func walletAddressType(wif *btcutil.WIF, address string, net *chaincfg.Params) (string, error) {
+	return pubKeyAddressType(wif.PrivKey.PubKey(), address, net)
+}
+
+// pubKeyAddressType returns the type of the address of the key pub matching
+// address, failing if address does not belong to the key.
+func pubKeyAddressType(pub *btcec.PublicKey, address string, net *chaincfg.Params) (string, error) {
+	for _, addressType := range addressTypes {
+		addr, err := pubKeyAddress(pub, addressType, net)
+		if err != nil {
+			return "", err
+		}
+		if addr.EncodeAddress() == address {
+			return addressType, nil
+		}
 	}
-	return addr, nil
+	return "", fmt.Errorf("wallet address %s does not belong to the wallet key", address)
 }
 
 func (a *btcAdapter) getOutputType(address string) (string, error) {
@@ -264,6 +1111,12 @@ func (a *btcAdapter) getOutputType(address string) (string, error) {
 		return "p2wpkh", nil
 	case *btcutil.AddressPubKeyHash:
 		return "p2pkh", nil
+	case *btcutil.AddressWitnessScriptHash:
+		return "p2wsh", nil
+	case *btcutil.AddressTaproot:
+		return "p2tr", nil
+	case *btcutil.AddressScriptHash:
+		return "p2sh", nil
 	default:
 		return "unknown", fmt.Errorf("unsupported address type")
 	}
@@ -4,13 +4,17 @@ import (
 	"bytes"
 	"encoding/hex"
 	"encoding/json"
+	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/btcsuite/btcd/btcec/v2"
 	"github.com/btcsuite/btcd/btcutil"
 	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/mempool"
 	"github.com/btcsuite/btcd/txscript"
 	"github.com/btcsuite/btcd/wire"
+	"github.com/stretchr/testify/require"
 )
 
 func TestCreateSignedTransaction_VerifySignature(t *testing.T) {
@@ -124,3 +128,765 @@ func TestChangeAddressNetwork(t *testing.T) {
 		t.Error("Change address uses hardcoded TestNet4Params but should match adapter's mainnet")
 	}
 }
+
+func TestCreateSignedTransaction_Taproot(t *testing.T) {
+	net := &chaincfg.TestNet4Params
+	a := NewBtcAdapter(net)
+
+	wallet, err := a.DeriveWalletOfType(AddressTypeP2TR)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(wallet.PublicKey, "tb1p"), "taproot address should be bech32m: %s", wallet.PublicKey)
+
+	p2wpkh, err := a.DeriveWallet()
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(p2wpkh.PublicKey, "tb1q"))
+
+	wif, err := btcutil.DecodeWIF(wallet.PrivateKey)
+	require.NoError(t, err)
+	scripts := walletScripts(wif)
+
+	// Spend a taproot and a segwit v0 UTXO of the same key together, so the
+	// taproot sighash has to commit to both prevouts.
+	utxos := []UTXO{
+		{
+			Txid:             "1111111111111111111111111111111111111111111111111111111111111111",
+			Vout:             1,
+			Value:            300000,
+			ScriptPubKey:     hex.EncodeToString(scripts["v1_p2tr"]),
+			ScriptPubKeyType: "v1_p2tr",
+		},
+		{
+			Txid:             "2222222222222222222222222222222222222222222222222222222222222222",
+			Vout:             0,
+			Value:            250000,
+			ScriptPubKey:     hex.EncodeToString(scripts["v0_p2wpkh"]),
+			ScriptPubKeyType: "v0_p2wpkh",
+		},
+	}
+	payloadJSON, err := json.Marshal(BtcPayload{
+		Recipient: "tb1qpn5dddjnc2qwurpsm449l6uvggnjxwsetrnksx",
+		Amount:    400000,
+		FeeRate:   2,
+		Utxos:     utxos,
+	})
+	require.NoError(t, err)
+
+	signedHex, err := a.CreateSignedTransaction(wallet, string(payloadJSON))
+	require.NoError(t, err)
+
+	signedBytes, err := hex.DecodeString(signedHex)
+	require.NoError(t, err)
+	var tx wire.MsgTx
+	require.NoError(t, tx.Deserialize(bytes.NewReader(signedBytes)))
+
+	require.Len(t, tx.TxOut, 2)
+	require.Equal(t, accountChangeScript(t, wallet.Account, "v1_p2tr", 0), tx.TxOut[1].PkScript, "change should go to the taproot account's first change key")
+	require.Len(t, tx.TxIn[0].Witness, 1)
+	require.Len(t, tx.TxIn[0].Witness[0], 64, "key-path spend should carry a SIGHASH_DEFAULT schnorr signature")
+
+	prevOuts := make([]*wire.TxOut, len(utxos))
+	for i, utxo := range utxos {
+		pkScript, err := hex.DecodeString(utxo.ScriptPubKey)
+		require.NoError(t, err)
+		prevOuts[i] = wire.NewTxOut(utxo.Value, pkScript)
+	}
+	verifyInputs(t, &tx, prevOuts)
+
+	t.Run("Unknown address type - fail", func(t *testing.T) {
+		_, err := a.DeriveWalletOfType("p2sh")
+		require.ErrorIs(t, err, ErrInvalidPayload)
+	})
+}
+
+func TestCreateSignedTransaction_NestedSegwit(t *testing.T) {
+	net := &chaincfg.TestNet4Params
+	a := NewBtcAdapter(net)
+
+	wallet, err := a.DeriveWalletOfType(AddressTypeP2SHP2WPKH)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(wallet.PublicKey, "2"), "testnet P2SH address expected: %s", wallet.PublicKey)
+
+	wif, err := btcutil.DecodeWIF(wallet.PrivateKey)
+	require.NoError(t, err)
+	scripts := walletScripts(wif)
+
+	utxos := []UTXO{
+		{
+			Txid:             "3333333333333333333333333333333333333333333333333333333333333333",
+			Vout:             2,
+			Value:            200000,
+			ScriptPubKey:     hex.EncodeToString(scripts["p2sh_p2wpkh"]),
+			ScriptPubKeyType: "p2sh_p2wpkh",
+		},
+		{
+			Txid:             "4444444444444444444444444444444444444444444444444444444444444444",
+			Vout:             0,
+			Value:            50000,
+			ScriptPubKey:     hex.EncodeToString(scripts["p2pkh"]),
+			ScriptPubKeyType: "p2pkh",
+		},
+	}
+	payloadJSON, err := json.Marshal(BtcPayload{
+		// A testnet P2SH destination.
+		Recipient: "2N3oefVeg6stiTb5Kh3ozCSkaqmx91FDbsm",
+		Amount:    150000,
+		FeeRate:   1,
+		Utxos:     utxos,
+	})
+	require.NoError(t, err)
+
+	signedHex, err := a.CreateSignedTransaction(wallet, string(payloadJSON))
+	require.NoError(t, err)
+
+	signedBytes, err := hex.DecodeString(signedHex)
+	require.NoError(t, err)
+	var tx wire.MsgTx
+	require.NoError(t, tx.Deserialize(bytes.NewReader(signedBytes)))
+
+	require.Len(t, tx.TxOut, 2)
+	require.Equal(t, accountChangeScript(t, wallet.Account, "p2sh_p2wpkh", 0), tx.TxOut[1].PkScript, "change should go to the nested segwit account's first change key")
+	require.Len(t, tx.TxIn[0].Witness, 2)
+	require.NotEmpty(t, tx.TxIn[0].SignatureScript, "nested segwit input should push its redeem script")
+
+	prevOuts := make([]*wire.TxOut, len(utxos))
+	for i, utxo := range utxos {
+		pkScript, err := hex.DecodeString(utxo.ScriptPubKey)
+		require.NoError(t, err)
+		prevOuts[i] = wire.NewTxOut(utxo.Value, pkScript)
+	}
+	verifyInputs(t, &tx, prevOuts)
+
+	t.Run("Mismatched scriptPubKey - fail", func(t *testing.T) {
+		bad := utxos[0]
+		bad.ScriptPubKey = hex.EncodeToString(scripts["v0_p2wpkh"])
+		_, err := a.NewTxWithInputsAndOutputs(wif, AddressTypeP2SHP2WPKH, []BtcOutput{{Address: "2N3oefVeg6stiTb5Kh3ozCSkaqmx91FDbsm", Amount: 150000}}, []UTXO{bad}, 1)
+		require.ErrorContains(t, err, "P2SH-P2WPKH")
+	})
+}
+
+func TestCreateSignedTransaction_MultipleOutputs(t *testing.T) {
+	net := &chaincfg.TestNet4Params
+	a := NewBtcAdapter(net)
+
+	wallet, err := a.DeriveWallet()
+	require.NoError(t, err)
+	wif, err := btcutil.DecodeWIF(wallet.PrivateKey)
+	require.NoError(t, err)
+	scripts := walletScripts(wif)
+
+	utxo := UTXO{
+		Txid:             "5555555555555555555555555555555555555555555555555555555555555555",
+		Vout:             0,
+		Value:            1000000,
+		ScriptPubKey:     hex.EncodeToString(scripts["v0_p2wpkh"]),
+		ScriptPubKeyType: "v0_p2wpkh",
+	}
+	taproot, err := a.DeriveWalletOfType(AddressTypeP2TR)
+	require.NoError(t, err)
+	outputs := []BtcOutput{
+		{Address: "tb1qpn5dddjnc2qwurpsm449l6uvggnjxwsetrnksx", Amount: 200000},
+		{Address: "2N3oefVeg6stiTb5Kh3ozCSkaqmx91FDbsm", Amount: 150000},
+		{Address: taproot.PublicKey, Amount: 100000},
+	}
+
+	signPayload := func(payload BtcPayload) (*wire.MsgTx, error) {
+		payloadJSON, err := json.Marshal(payload)
+		require.NoError(t, err)
+		signedHex, err := a.CreateSignedTransaction(wallet, string(payloadJSON))
+		if err != nil {
+			return nil, err
+		}
+		signedBytes, err := hex.DecodeString(signedHex)
+		require.NoError(t, err)
+		var tx wire.MsgTx
+		require.NoError(t, tx.Deserialize(bytes.NewReader(signedBytes)))
+		return &tx, nil
+	}
+
+	t.Run("Batch payout - pass", func(t *testing.T) {
+		tx, err := signPayload(BtcPayload{Outputs: outputs, FeeRate: 2, Utxos: []UTXO{utxo}})
+		require.NoError(t, err)
+
+		require.Len(t, tx.TxOut, len(outputs)+1)
+		var total int64
+		for i, output := range outputs {
+			addr, err := btcutil.DecodeAddress(output.Address, net)
+			require.NoError(t, err)
+			pkScript, err := txscript.PayToAddrScript(addr)
+			require.NoError(t, err)
+			require.Equal(t, pkScript, tx.TxOut[i].PkScript, "outputs should keep the payload order")
+			require.Equal(t, output.Amount, tx.TxOut[i].Value)
+			total += tx.TxOut[i].Value
+		}
+		change := tx.TxOut[len(outputs)]
+		require.Equal(t, accountChangeScript(t, wallet.Account, "v0_p2wpkh", wallet.ChangeIndex-1), change.PkScript, "change goes to the change key just handed out")
+
+		// 862 WU = 40 overhead + 2 marker + 272 input + 124 + 128 + 172 payments
+		// + 124 change, rounded up to 216 vbytes.
+		require.Equal(t, int64(2*216), utxo.Value-total-change.Value)
+
+		pkScript, err := hex.DecodeString(utxo.ScriptPubKey)
+		require.NoError(t, err)
+		verifyInputs(t, tx, []*wire.TxOut{wire.NewTxOut(utxo.Value, pkScript)})
+	})
+
+	t.Run("Dust payment - fail", func(t *testing.T) {
+		// Each output type has the dust limit nodes relay it at.
+		for i, limit := range []int64{294, 540, 330} {
+			payments := append([]BtcOutput(nil), outputs...)
+			payments[i].Amount = limit - 1
+			_, err := signPayload(BtcPayload{Outputs: payments, FeeRate: 2, Utxos: []UTXO{utxo}})
+			require.ErrorIs(t, err, ErrInvalidPayload)
+			require.ErrorContains(t, err, fmt.Sprintf("outputs[%d].amount: %d is below the dust threshold of %d", i, limit-1, limit))
+
+			payments[i].Amount = limit
+			_, err = signPayload(BtcPayload{Outputs: payments, FeeRate: 2, Utxos: []UTXO{utxo}})
+			require.NoError(t, err, "a payment at the dust limit is standard")
+		}
+	})
+
+	t.Run("Outputs with recipient - fail", func(t *testing.T) {
+		_, err := signPayload(BtcPayload{
+			Recipient: outputs[0].Address,
+			Amount:    outputs[0].Amount,
+			Outputs:   outputs,
+			FeeRate:   2,
+			Utxos:     []UTXO{utxo},
+		})
+		require.ErrorIs(t, err, ErrInvalidPayload)
+	})
+
+	t.Run("Insufficient funds across outputs - fail", func(t *testing.T) {
+		_, err := signPayload(BtcPayload{
+			Outputs: []BtcOutput{outputs[0], {Address: outputs[1].Address, Amount: 800000}},
+			FeeRate: 2,
+			Utxos:   []UTXO{utxo},
+		})
+		require.ErrorContains(t, err, "insufficient funds")
+	})
+}
+
+func TestCreateSignedTransaction_Destinations(t *testing.T) {
+	net := &chaincfg.TestNet4Params
+	a := NewBtcAdapter(net)
+
+	wallet, err := a.DeriveWallet()
+	require.NoError(t, err)
+	wif, err := btcutil.DecodeWIF(wallet.PrivateKey)
+	require.NoError(t, err)
+	utxo := UTXO{
+		Txid:             "6666666666666666666666666666666666666666666666666666666666666666",
+		Vout:             0,
+		Value:            500000,
+		ScriptPubKey:     hex.EncodeToString(walletScripts(wif)["v0_p2wpkh"]),
+		ScriptPubKeyType: "v0_p2wpkh",
+	}
+
+	sign := func(recipient string) (*wire.MsgTx, error) {
+		payloadJSON, err := json.Marshal(BtcPayload{Recipient: recipient, Amount: 100000, FeeRate: 1, Utxos: []UTXO{utxo}})
+		require.NoError(t, err)
+		signedHex, err := a.CreateSignedTransaction(wallet, string(payloadJSON))
+		if err != nil {
+			return nil, err
+		}
+		signedBytes, err := hex.DecodeString(signedHex)
+		require.NoError(t, err)
+		var tx wire.MsgTx
+		require.NoError(t, tx.Deserialize(bytes.NewReader(signedBytes)))
+		return &tx, nil
+	}
+
+	destinations := map[string]string{
+		"p2pkh":  "mipcBbFg9gMiCh81Kj8tqqdgoZub1ZJRfn",
+		"p2sh":   "2N3oefVeg6stiTb5Kh3ozCSkaqmx91FDbsm",
+		"p2wpkh": "tb1qpn5dddjnc2qwurpsm449l6uvggnjxwsetrnksx",
+		"p2wsh":  "tb1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3q0sl5k7",
+		"p2tr":   "tb1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vq47zagq",
+	}
+	for destType, recipient := range destinations {
+		t.Run("Pay "+destType+" - pass", func(t *testing.T) {
+			outputType, err := a.getOutputType(recipient)
+			require.NoError(t, err)
+			require.Equal(t, destType, outputType)
+
+			tx, err := sign(recipient)
+			require.NoError(t, err)
+
+			addr, err := btcutil.DecodeAddress(recipient, net)
+			require.NoError(t, err)
+			pkScript, err := txscript.PayToAddrScript(addr)
+			require.NoError(t, err)
+			require.Equal(t, pkScript, tx.TxOut[0].PkScript)
+			require.Equal(t, int64(100000), tx.TxOut[0].Value)
+
+			prevScript, err := hex.DecodeString(utxo.ScriptPubKey)
+			require.NoError(t, err)
+			verifyInputs(t, tx, []*wire.TxOut{wire.NewTxOut(utxo.Value, prevScript)})
+		})
+	}
+
+	// Mainnet addresses of every type must be refused on testnet.
+	mainnet := map[string]string{
+		"p2pkh":  "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa",
+		"p2sh":   "3J98t1WpEZ73CNmQviecrnyiWrnqRhWNLy",
+		"p2wpkh": "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4",
+		"p2wsh":  "bc1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3qccfmv3",
+		"p2tr":   "bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqzk5jj0",
+	}
+	for destType, recipient := range mainnet {
+		t.Run("Pay mainnet "+destType+" - fail", func(t *testing.T) {
+			_, err := sign(recipient)
+			require.ErrorIs(t, err, ErrInvalidPayload)
+			require.ErrorContains(t, err, "outputs[0].address")
+		})
+	}
+}
+
+func TestCreateSignedTransaction_Change(t *testing.T) {
+	net := &chaincfg.TestNet4Params
+	a := NewBtcAdapter(net)
+
+	wallet, err := a.DeriveWallet()
+	require.NoError(t, err)
+	wif, err := btcutil.DecodeWIF(wallet.PrivateKey)
+	require.NoError(t, err)
+	scripts := walletScripts(wif)
+	other, err := a.DeriveWalletOfType(AddressTypeP2TR)
+	require.NoError(t, err)
+
+	utxo := func(scriptType string) UTXO {
+		return UTXO{
+			Txid:             "7777777777777777777777777777777777777777777777777777777777777777",
+			Value:            400000,
+			ScriptPubKey:     hex.EncodeToString(scripts[scriptType]),
+			ScriptPubKeyType: scriptType,
+		}
+	}
+	sign := func(payload BtcPayload) (*wire.MsgTx, error) {
+		payload.Recipient = "tb1qpn5dddjnc2qwurpsm449l6uvggnjxwsetrnksx"
+		payload.Amount = 100000
+		payload.FeeRate = 1
+		payloadJSON, err := json.Marshal(payload)
+		require.NoError(t, err)
+		signedHex, err := a.CreateSignedTransaction(wallet, string(payloadJSON))
+		if err != nil {
+			return nil, err
+		}
+		signedBytes, err := hex.DecodeString(signedHex)
+		require.NoError(t, err)
+		var tx wire.MsgTx
+		require.NoError(t, tx.Deserialize(bytes.NewReader(signedBytes)))
+		return &tx, nil
+	}
+	addressScript := func(address string) []byte {
+		addr, err := btcutil.DecodeAddress(address, net)
+		require.NoError(t, err)
+		pkScript, err := txscript.PayToAddrScript(addr)
+		require.NoError(t, err)
+		return pkScript
+	}
+
+	t.Run("Change type p2tr - pass", func(t *testing.T) {
+		tx, err := sign(BtcPayload{Utxos: []UTXO{utxo("v0_p2wpkh")}, ChangeType: AddressTypeP2TR})
+		require.NoError(t, err)
+		require.Equal(t, scripts["v1_p2tr"], tx.TxOut[1].PkScript)
+		// 610 WU = 40 + 2 + 272 input + 124 payment + 172 P2TR change, 153 vbytes.
+		require.Equal(t, int64(400000-100000-153), tx.TxOut[1].Value)
+	})
+
+	t.Run("Change type same as inputs - pass", func(t *testing.T) {
+		tx, err := sign(BtcPayload{Utxos: []UTXO{utxo("p2sh_p2wpkh")}, ChangeType: ChangeTypeSameAsInputs})
+		require.NoError(t, err)
+		require.Equal(t, scripts["p2sh_p2wpkh"], tx.TxOut[1].PkScript)
+	})
+
+	t.Run("Change type same as mixed inputs - fail", func(t *testing.T) {
+		mixed := []UTXO{utxo("v0_p2wpkh"), utxo("v1_p2tr")}
+		mixed[1].Vout = 1
+		_, err := sign(BtcPayload{Utxos: mixed, ChangeType: ChangeTypeSameAsInputs})
+		require.ErrorIs(t, err, ErrInvalidPayload)
+		require.ErrorContains(t, err, "change_type")
+	})
+
+	t.Run("Unknown change type - fail", func(t *testing.T) {
+		_, err := sign(BtcPayload{Utxos: []UTXO{utxo("v0_p2wpkh")}, ChangeType: "p2pkh"})
+		require.ErrorIs(t, err, ErrInvalidPayload)
+		require.ErrorContains(t, err, "change_type")
+	})
+
+	t.Run("Own change address - pass", func(t *testing.T) {
+		p2pkh, err := btcutil.NewAddressPubKeyHash(btcutil.Hash160(wif.PrivKey.PubKey().SerializeCompressed()), net)
+		require.NoError(t, err)
+		tx, err := sign(BtcPayload{Utxos: []UTXO{utxo("v0_p2wpkh")}, ChangeAddress: p2pkh.EncodeAddress()})
+		require.NoError(t, err)
+		require.Equal(t, scripts["p2pkh"], tx.TxOut[1].PkScript)
+	})
+
+	t.Run("Foreign change address - fail", func(t *testing.T) {
+		_, err := sign(BtcPayload{Utxos: []UTXO{utxo("v0_p2wpkh")}, ChangeAddress: other.PublicKey})
+		require.ErrorIs(t, err, ErrInvalidPayload)
+		require.ErrorContains(t, err, "allowlisted")
+	})
+
+	t.Run("Allowlisted change address - pass", func(t *testing.T) {
+		a.SetPolicy(&Policy{ChangeWallets: []string{other.PublicKey}})
+		defer a.SetPolicy(nil)
+
+		tx, err := sign(BtcPayload{Utxos: []UTXO{utxo("v0_p2wpkh")}, ChangeAddress: other.PublicKey})
+		require.NoError(t, err)
+		require.Equal(t, addressScript(other.PublicKey), tx.TxOut[1].PkScript)
+	})
+
+	t.Run("Change address with change type - fail", func(t *testing.T) {
+		_, err := sign(BtcPayload{Utxos: []UTXO{utxo("v0_p2wpkh")}, ChangeAddress: wallet.PublicKey, ChangeType: AddressTypeP2TR})
+		require.ErrorIs(t, err, ErrInvalidPayload)
+		require.ErrorContains(t, err, "change_type")
+	})
+
+	signDetailed := func(wallet *Wallet, payload BtcPayload) (*SignResult, *wire.MsgTx) {
+		payload.Recipient = "tb1qpn5dddjnc2qwurpsm449l6uvggnjxwsetrnksx"
+		payload.FeeRate = 1
+		if payload.Amount == 0 {
+			payload.Amount = 100000
+		}
+		result, err := a.CreateSignedTransactionDetailed(wallet, mustJSON(t, payload))
+		require.NoError(t, err)
+		return result, decodeTestTx(t, result.Tx)
+	}
+
+	t.Run("Fresh HD change key per payment - pass", func(t *testing.T) {
+		next := wallet.ChangeIndex
+		for i := range uint32(2) {
+			result, tx := signDetailed(wallet, BtcPayload{Utxos: []UTXO{utxo("v0_p2wpkh")}})
+			require.Equal(t, fmt.Sprintf("1/%d", next+i), result.Details["change_path"])
+			require.Equal(t, accountChangeScript(t, wallet.Account, "v0_p2wpkh", next+i), tx.TxOut[1].PkScript)
+		}
+		require.Equal(t, next+2, wallet.ChangeIndex)
+
+		// Estimating plans the same change but hands out no key.
+		estimate, err := a.EstimateFee(wallet, mustJSON(t, BtcPayload{Recipient: "tb1qpn5dddjnc2qwurpsm449l6uvggnjxwsetrnksx", Amount: 100000, FeeRate: 1, Utxos: []UTXO{utxo("v0_p2wpkh")}}))
+		require.NoError(t, err)
+		require.Positive(t, estimate.ChangeValue)
+		require.Equal(t, next+2, wallet.ChangeIndex)
+	})
+
+	t.Run("Change path - pass", func(t *testing.T) {
+		next := wallet.ChangeIndex
+		result, tx := signDetailed(wallet, BtcPayload{Utxos: []UTXO{utxo("v0_p2wpkh")}, ChangePath: "1/0"})
+		require.Equal(t, "1/0", result.Details["change_path"])
+		require.Equal(t, accountChangeScript(t, wallet.Account, "v0_p2wpkh", 0), tx.TxOut[1].PkScript)
+		require.Equal(t, next, wallet.ChangeIndex, "a change key named by path is not fresh")
+
+		_, err := sign(BtcPayload{Utxos: []UTXO{utxo("v0_p2wpkh")}, ChangePath: "1/0", ChangeType: AddressTypeP2TR})
+		require.ErrorIs(t, err, ErrInvalidPayload)
+		require.ErrorContains(t, err, "change_path")
+	})
+
+	t.Run("Change below dust hands out no key - pass", func(t *testing.T) {
+		next := wallet.ChangeIndex
+		result, tx := signDetailed(wallet, BtcPayload{Utxos: []UTXO{utxo("v0_p2wpkh")}, Amount: 399700})
+		require.Len(t, tx.TxOut, 1)
+		require.NotContains(t, result.Details, "change_path")
+		require.Equal(t, next, wallet.ChangeIndex)
+	})
+
+	t.Run("Wallets without an account key keep their change address - pass", func(t *testing.T) {
+		legacy, legacyWIF := legacyBtcWallet(t, net)
+		legacyScript := walletScripts(legacyWIF)["v0_p2wpkh"]
+		result, tx := signDetailed(legacy, BtcPayload{Utxos: []UTXO{{
+			Txid:             "7777777777777777777777777777777777777777777777777777777777777777",
+			Value:            400000,
+			ScriptPubKey:     hex.EncodeToString(legacyScript),
+			ScriptPubKeyType: "v0_p2wpkh",
+		}}})
+		require.Equal(t, legacyScript, tx.TxOut[1].PkScript)
+		require.NotContains(t, result.Details, "change_path")
+		require.Zero(t, legacy.ChangeIndex)
+	})
+}
+
+func TestCreateSignedTransaction_Timelocks(t *testing.T) {
+	net := &chaincfg.TestNet4Params
+	a := NewBtcAdapter(net)
+
+	wallet, err := a.DeriveWallet()
+	require.NoError(t, err)
+	wif, err := btcutil.DecodeWIF(wallet.PrivateKey)
+	require.NoError(t, err)
+	script := walletScripts(wif)["v0_p2wpkh"]
+
+	sequence := func(n uint32) *uint32 { return &n }
+	utxos := func(sequences ...*uint32) []UTXO {
+		utxos := make([]UTXO, len(sequences))
+		for i, seq := range sequences {
+			utxos[i] = UTXO{
+				Txid:             "abababababababababababababababababababababababababababababababab",
+				Vout:             uint32(i),
+				Value:            200000,
+				ScriptPubKey:     hex.EncodeToString(script),
+				ScriptPubKeyType: "v0_p2wpkh",
+				Sequence:         seq,
+			}
+		}
+		return utxos
+	}
+	sign := func(payload BtcPayload) (*wire.MsgTx, error) {
+		payload.Recipient = "tb1qpn5dddjnc2qwurpsm449l6uvggnjxwsetrnksx"
+		payload.Amount = 100000
+		payload.FeeRate = 1
+		payloadJSON, err := json.Marshal(payload)
+		require.NoError(t, err)
+		signedHex, err := a.CreateSignedTransaction(wallet, string(payloadJSON))
+		if err != nil {
+			return nil, err
+		}
+		signedBytes, err := hex.DecodeString(signedHex)
+		require.NoError(t, err)
+		var tx wire.MsgTx
+		require.NoError(t, tx.Deserialize(bytes.NewReader(signedBytes)))
+
+		prevOuts := make([]*wire.TxOut, len(tx.TxIn))
+		for i := range prevOuts {
+			prevOuts[i] = wire.NewTxOut(200000, script)
+		}
+		verifyInputs(t, &tx, prevOuts)
+		return &tx, nil
+	}
+
+	t.Run("Default sequences are final - pass", func(t *testing.T) {
+		tx, err := sign(BtcPayload{Utxos: utxos(nil)})
+		require.NoError(t, err)
+		require.Equal(t, int32(1), tx.Version)
+		require.Equal(t, uint32(0), tx.LockTime)
+		require.Equal(t, uint32(wire.MaxTxInSequenceNum), tx.TxIn[0].Sequence)
+	})
+
+	t.Run("Block height locktime - pass", func(t *testing.T) {
+		tx, err := sign(BtcPayload{Utxos: utxos(nil, nil), Locktime: 850000})
+		require.NoError(t, err)
+		require.Equal(t, uint32(850000), tx.LockTime)
+		for _, txIn := range tx.TxIn {
+			require.Equal(t, uint32(wire.MaxTxInSequenceNum-1), txIn.Sequence, "inputs must be non-final for the locktime to apply")
+		}
+		require.Equal(t, int32(1), tx.Version)
+	})
+
+	t.Run("Timestamp locktime with RBF - pass", func(t *testing.T) {
+		tx, err := sign(BtcPayload{Utxos: utxos(nil), Locktime: 1767225600, RBF: true})
+		require.NoError(t, err)
+		require.Equal(t, uint32(1767225600), tx.LockTime)
+		require.Equal(t, uint32(rbfSequence), tx.TxIn[0].Sequence)
+	})
+
+	t.Run("Relative locktime - pass", func(t *testing.T) {
+		csv := uint32(wire.SequenceLockTimeIsSeconds | 20) // 20 * 512 seconds
+		tx, err := sign(BtcPayload{Utxos: utxos(sequence(144), sequence(csv), nil)})
+		require.NoError(t, err)
+		require.Equal(t, int32(2), tx.Version, "BIP68 needs version 2")
+		require.Equal(t, uint32(144), tx.TxIn[0].Sequence)
+		require.Equal(t, csv, tx.TxIn[1].Sequence)
+		require.Equal(t, uint32(wire.MaxTxInSequenceNum), tx.TxIn[2].Sequence)
+	})
+
+	t.Run("Locktime with final sequences - fail", func(t *testing.T) {
+		_, err := sign(BtcPayload{Utxos: utxos(sequence(wire.MaxTxInSequenceNum)), Locktime: 850000})
+		require.ErrorIs(t, err, ErrInvalidPayload)
+		require.ErrorContains(t, err, "locktime")
+	})
+
+	t.Run("RBF with non-signalling sequences - fail", func(t *testing.T) {
+		_, err := sign(BtcPayload{Utxos: utxos(sequence(wire.MaxTxInSequenceNum - 1)), RBF: true})
+		require.ErrorIs(t, err, ErrInvalidPayload)
+		require.ErrorContains(t, err, "rbf")
+	})
+
+	t.Run("Relative locktime with undefined bits - fail", func(t *testing.T) {
+		_, err := sign(BtcPayload{Utxos: utxos(sequence(1<<20 | 144))})
+		require.ErrorIs(t, err, ErrInvalidPayload)
+		require.ErrorContains(t, err, "BIP68")
+	})
+}
+
+func TestCreateSignedTransaction_OpReturn(t *testing.T) {
+	net := &chaincfg.TestNet4Params
+	a := NewBtcAdapter(net)
+
+	wallet, err := a.DeriveWallet()
+	require.NoError(t, err)
+	wif, err := btcutil.DecodeWIF(wallet.PrivateKey)
+	require.NoError(t, err)
+	script := walletScripts(wif)["v0_p2wpkh"]
+
+	utxos := []UTXO{
+		{Txid: "cdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcd", Vout: 0, Value: 200000, ScriptPubKey: hex.EncodeToString(script), ScriptPubKeyType: "v0_p2wpkh"},
+		{Txid: "cdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcd", Vout: 1, Value: 50000, ScriptPubKey: hex.EncodeToString(script), ScriptPubKeyType: "v0_p2wpkh"},
+	}
+	docHash := bytes.Repeat([]byte{0x5e}, 32)
+	sign := func(payload BtcPayload) (*wire.MsgTx, int64, error) {
+		payload.FeeRate = 2
+		if payload.Utxos == nil {
+			payload.Utxos = utxos[:1]
+		}
+		payloadJSON, err := json.Marshal(payload)
+		require.NoError(t, err)
+		result, err := a.CreateSignedTransactionDetailed(wallet, string(payloadJSON))
+		if err != nil {
+			return nil, 0, err
+		}
+		tx, err := decodeTx("tx", result.Tx)
+		require.NoError(t, err)
+
+		prevOuts := make([]*wire.TxOut, len(tx.TxIn))
+		for i, txIn := range tx.TxIn {
+			prevOuts[i] = wire.NewTxOut(utxos[txIn.PreviousOutPoint.Index].Value, script)
+		}
+		verifyInputs(t, tx, prevOuts)
+		return tx, result.Details["fee"].(int64), nil
+	}
+
+	t.Run("Data after payments and before change - pass", func(t *testing.T) {
+		tx, fee, err := sign(BtcPayload{
+			Recipient: "tb1qpn5dddjnc2qwurpsm449l6uvggnjxwsetrnksx",
+			Amount:    100000,
+			OpReturn:  []BtcOpReturn{{Hex: hex.EncodeToString(docHash)}, {Text: "invoice №42"}},
+		})
+		require.NoError(t, err)
+		require.Len(t, tx.TxOut, 4)
+		require.Equal(t, int64(100000), tx.TxOut[0].Value)
+
+		hashScript, err := txscript.NullDataScript(docHash)
+		require.NoError(t, err)
+		textScript, err := txscript.NullDataScript([]byte("invoice №42"))
+		require.NoError(t, err)
+		require.Equal(t, wire.NewTxOut(0, hashScript), tx.TxOut[1])
+		require.Equal(t, wire.NewTxOut(0, textScript), tx.TxOut[2])
+		require.Equal(t, accountChangeScript(t, wallet.Account, "v0_p2wpkh", wallet.ChangeIndex-1), tx.TxOut[3].PkScript, "change comes last")
+
+		vsize := mempool.GetTxVirtualSize(btcutil.NewTx(tx))
+		require.GreaterOrEqual(t, fee, 2*vsize, "the OP_RETURN outputs are paid for")
+	})
+
+	t.Run("Data only - pass", func(t *testing.T) {
+		tx, fee, err := sign(BtcPayload{OpReturn: []BtcOpReturn{{Hex: hex.EncodeToString(docHash)}}})
+		require.NoError(t, err)
+		require.Len(t, tx.TxOut, 2)
+		require.Equal(t, int64(0), tx.TxOut[0].Value)
+		require.Equal(t, utxos[0].Value-fee, tx.TxOut[1].Value)
+	})
+
+	t.Run("Coin selection sizes the data - pass", func(t *testing.T) {
+		tx, _, err := sign(BtcPayload{
+			Recipient:     "tb1qpn5dddjnc2qwurpsm449l6uvggnjxwsetrnksx",
+			Amount:        49700,
+			OpReturn:      []BtcOpReturn{{Hex: hex.EncodeToString(bytes.Repeat([]byte{0x5e}, 80))}},
+			Utxos:         utxos,
+			CoinSelection: CoinSelectionBnB,
+		})
+		require.NoError(t, err)
+		require.Len(t, tx.TxIn, 1)
+		require.Equal(t, uint32(0), tx.TxIn[0].PreviousOutPoint.Index, "50000 sats would pay for the payment, but not for the data too")
+	})
+
+	t.Run("Invalid data - fail", func(t *testing.T) {
+		for name, opReturn := range map[string]BtcOpReturn{
+			"empty":     {},
+			"both":      {Hex: "00", Text: "a"},
+			"bad hex":   {Hex: "zz"},
+			"too large": {Hex: hex.EncodeToString(make([]byte, 81))},
+		} {
+			_, _, err := sign(BtcPayload{OpReturn: []BtcOpReturn{opReturn}})
+			require.ErrorIs(t, err, ErrInvalidPayload, name)
+			require.ErrorContains(t, err, "op_return[0]", name)
+		}
+	})
+}
+
+func TestCreateSignedTransaction_FeeModes(t *testing.T) {
+	net := &chaincfg.TestNet4Params
+	a := NewBtcAdapter(net)
+
+	wallet, err := a.DeriveWallet()
+	require.NoError(t, err)
+	wif, err := btcutil.DecodeWIF(wallet.PrivateKey)
+	require.NoError(t, err)
+	script := walletScripts(wif)["v0_p2wpkh"]
+
+	utxo := UTXO{Txid: "e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5", Vout: 1, Value: 300000, ScriptPubKey: hex.EncodeToString(script), ScriptPubKeyType: "v0_p2wpkh"}
+	outputs := []BtcOutput{
+		{Address: "tb1qpn5dddjnc2qwurpsm449l6uvggnjxwsetrnksx", Amount: 100000},
+		{Address: "tb1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vq47zagq", Amount: 60000},
+		{Address: "tb1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3q0sl5k7", Amount: 40000},
+	}
+	sign := func(payload BtcPayload) (*wire.MsgTx, int64, error) {
+		if payload.Outputs == nil {
+			payload.Outputs = outputs
+		}
+		payload.Utxos = []UTXO{utxo}
+		payloadJSON, err := json.Marshal(payload)
+		require.NoError(t, err)
+		result, err := a.CreateSignedTransactionDetailed(wallet, string(payloadJSON))
+		if err != nil {
+			return nil, 0, err
+		}
+		tx, err := decodeTx("tx", result.Tx)
+		require.NoError(t, err)
+		verifyInputs(t, tx, []*wire.TxOut{wire.NewTxOut(utxo.Value, script)})
+		return tx, result.Details["fee"].(int64), nil
+	}
+
+	t.Run("Subtract fee from outputs - pass", func(t *testing.T) {
+		tx, fee, err := sign(BtcPayload{FeeRate: 3, SubtractFeeFromOutputs: []int{2, 0}})
+		require.NoError(t, err)
+		require.Len(t, tx.TxOut, 4)
+
+		// The first listed output pays the odd sat.
+		share := fee / 2
+		require.Equal(t, int64(40000)-share-fee%2, tx.TxOut[2].Value)
+		require.Equal(t, int64(100000)-share, tx.TxOut[0].Value)
+		require.Equal(t, int64(60000), tx.TxOut[1].Value)
+		require.Equal(t, int64(300000-200000), tx.TxOut[3].Value, "the wallet pays only the amounts")
+
+		vsize := mempool.GetTxVirtualSize(btcutil.NewTx(tx))
+		require.GreaterOrEqual(t, fee, 3*vsize)
+	})
+
+	t.Run("Absolute fee - pass", func(t *testing.T) {
+		tx, fee, err := sign(BtcPayload{AbsoluteFee: 2500})
+		require.NoError(t, err)
+		require.Equal(t, int64(2500), fee)
+		require.Equal(t, int64(300000-200000-2500), tx.TxOut[3].Value)
+
+		tx, fee, err = sign(BtcPayload{AbsoluteFee: 2500, SubtractFeeFromOutputs: []int{1}})
+		require.NoError(t, err)
+		require.Equal(t, int64(2500), fee)
+		require.Equal(t, int64(60000-2500), tx.TxOut[1].Value)
+	})
+
+	t.Run("Subtracted output below dust - fail", func(t *testing.T) {
+		_, _, err := sign(BtcPayload{
+			Outputs:                []BtcOutput{{Address: "tb1qpn5dddjnc2qwurpsm449l6uvggnjxwsetrnksx", Amount: 450}},
+			FeeRate:                2,
+			SubtractFeeFromOutputs: []int{0},
+		})
+		require.ErrorIs(t, err, ErrInvalidPayload)
+		require.ErrorContains(t, err, "dust threshold")
+	})
+
+	t.Run("Invalid fee mode - fail", func(t *testing.T) {
+		for name, tc := range map[string]struct {
+			payload BtcPayload
+			message string
+		}{
+			"rate and absolute":  {BtcPayload{FeeRate: 2, AbsoluteFee: 500}, "either fee_rate or absolute_fee"},
+			"negative absolute":  {BtcPayload{AbsoluteFee: -1}, "absolute_fee: must not be negative"},
+			"absolute too low":   {BtcPayload{AbsoluteFee: 100}, "below the minimum relay fee rate"},
+			"absolute selection": {BtcPayload{AbsoluteFee: 500, CoinSelection: CoinSelectionBnB}, "coin_selection"},
+			"index out of range": {BtcPayload{FeeRate: 2, SubtractFeeFromOutputs: []int{3}}, "subtract_fee_from_outputs[0]"},
+			"repeated index":     {BtcPayload{FeeRate: 2, SubtractFeeFromOutputs: []int{1, 1}}, "repeats output 1"},
+		} {
+			_, _, err := sign(tc.payload)
+			require.ErrorIs(t, err, ErrInvalidPayload, name)
+			require.ErrorContains(t, err, tc.message, name)
+		}
+	})
+}
@@ -0,0 +1,430 @@
+package adapters
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/mempool"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// incrementalRelayFeeRate is the sat/vbyte by which a replacement must outbid
+// the transaction it replaces (BIP125 rule 4), and the least a child may pay
+// for itself.
+const incrementalRelayFeeRate = 1
+
+// BumpFee re-signs the payment described by payload as a BIP125 replacement
+// paying feeRate. The replacement spends the same inputs and makes the same
+// payments, taking the extra fee from the change, or from the payments of a
+// send_max or subtract_fee_from_outputs payload. tx is the original signed
+// transaction; it is required when the payload used coin selection and
+// otherwise only checked against the payload. The original must signal
+// BIP125.
+func (a *btcAdapter) BumpFee(wallet *Wallet, payload string, tx string, feeRate float64) (*SignResult, error) {
+	btcPayload, err := a.validatePayload(payload)
+	if err != nil {
+		return nil, fmt.Errorf("invalid payload type, expected BtcPayload: %w", err)
+	}
+
+	keys, addressType, err := a.walletKey(wallet)
+	if err != nil {
+		return nil, err
+	}
+	outputs, err := btcPayload.payments()
+	if err != nil {
+		return nil, err
+	}
+	nullData, err := btcPayload.nullData()
+	if err != nil {
+		return nil, err
+	}
+
+	var original *wire.MsgTx
+	utxos := btcPayload.Utxos
+	if tx != "" {
+		original, err = decodeTx("tx", tx)
+		if err != nil {
+			return nil, err
+		}
+		utxos, err = spentUtxos(original, btcPayload.Utxos, "tx", "the payload utxos")
+		if err != nil {
+			return nil, err
+		}
+	} else if btcPayload.CoinSelection != "" {
+		return nil, invalidField("tx", "is required when the payload used coin_selection")
+	}
+
+	// An HD wallet paid the change to a fresh key, which the replacement
+	// must pay again.
+	if keys.hdChange() && btcPayload.ChangeAddress == "" && btcPayload.ChangeType == "" && btcPayload.ChangePath == "" {
+		if original == nil {
+			return nil, invalidField("change_path", "is required to rebuild a payment of an HD wallet; pass tx, or the change_path the payment was signed with")
+		}
+		btcPayload.ChangePath, err = originalChangePath(keys, original)
+		if err != nil {
+			return nil, err
+		}
+		if btcPayload.ChangePath == "" {
+			btcPayload.ChangeAddress = wallet.PublicKey
+		}
+	}
+	changeAddr, _, err := a.changeAddress(keys, addressType, btcPayload)
+	if err != nil {
+		return nil, err
+	}
+
+	// A send_max payment pays what the fee leaves of the UTXOs the original
+	// spent, so the replacement pays less than the original.
+	paid, _, err := a.sendMaxOutputs(btcPayload, outputs, nullData, utxos, btcPayload.FeeRate, btcPayload.AbsoluteFee)
+	if err != nil {
+		return nil, err
+	}
+	replacementPaid, _, err := a.sendMaxOutputs(btcPayload, outputs, nullData, utxos, feeRate, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if original != nil {
+		if err := a.checkPayments(original, paid, nullData, btcPayload.SubtractFeeFromOutputs); err != nil {
+			return nil, err
+		}
+	} else {
+		// Signing is deterministic, so rebuilding the original payment
+		// reproduces the transaction that was broadcast.
+		original, err = a.newTx(keys, btcTx{
+			outputs:         paid,
+			utxos:           utxos,
+			change:          changeAddr,
+			nullData:        nullData,
+			feeRate:         btcPayload.FeeRate,
+			absoluteFee:     btcPayload.AbsoluteFee,
+			subtractFeeFrom: btcPayload.SubtractFeeFromOutputs,
+			rbf:             btcPayload.RBF,
+			locktime:        btcPayload.Locktime,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to rebuild the original transaction: %w", err)
+		}
+	}
+	// Nodes refuse to replace a transaction that does not signal BIP125.
+	if !signalsRBF(original) {
+		field := "rbf"
+		if tx != "" {
+			field = "tx"
+		}
+		return nil, invalidField(field, "the original transaction does not signal BIP125 replaceability: no input sequence is %#x or below", uint32(rbfSequence))
+	}
+	originalFee := txFee(original, utxos)
+
+	replacement, err := a.newTx(keys, btcTx{
+		outputs:         replacementPaid,
+		utxos:           utxos,
+		change:          changeAddr,
+		nullData:        nullData,
+		feeRate:         feeRate,
+		subtractFeeFrom: btcPayload.SubtractFeeFromOutputs,
+		rbf:             true,
+		locktime:        btcPayload.Locktime,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create replacement transaction: %w", err)
+	}
+	fee := txFee(replacement, utxos)
+	vsize := mempool.GetTxVirtualSize(btcutil.NewTx(replacement))
+	if minFee := originalFee + feeForSize(incrementalRelayFeeRate, int(vsize)); fee < minFee {
+		return nil, invalidField("fee_rate", "replacement fee %d must be at least %d, the original fee %d plus %d sat/vB", fee, minFee, originalFee, incrementalRelayFeeRate)
+	}
+
+	hexTx, err := serializeTx(replacement)
+	if err != nil {
+		return nil, err
+	}
+	return &SignResult{
+		Tx: hexTx,
+		Details: map[string]interface{}{
+			"txid":          replacement.TxHash().String(),
+			"replaces_txid": original.TxHash().String(),
+			"fee":           fee,
+		},
+	}, nil
+}
+
+// ChildPaysForParent spends the wallet's outputs of the unconfirmed parentTx
+// back to the wallet, paying enough fee that parent and child together pay
+// feeRate. parentUtxos is a JSON list of the outputs the parent spends, from
+// which the parent's fee is computed.
+func (a *btcAdapter) ChildPaysForParent(wallet *Wallet, parentTx string, parentUtxos string, feeRate float64) (*SignResult, error) {
+	parent, err := decodeTx("parent_tx", parentTx)
+	if err != nil {
+		return nil, err
+	}
+	parentFee, err := parentTxFee(parent, parentUtxos)
+	if err != nil {
+		return nil, err
+	}
+	// The child itself must pay the incremental relay fee rate, checked
+	// below, so only the package rate's upper limit is checked here.
+	limits := a.feeLimits()
+	if err := limits.checkFeeRate(feeRate); err != nil {
+		return nil, err
+	}
+
+	keys, _, err := a.walletKey(wallet)
+	if err != nil {
+		return nil, err
+	}
+	walletAddr, err := btcutil.DecodeAddress(wallet.PublicKey, a.net)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode wallet address: %w", err)
+	}
+	walletScript, err := txscript.PayToAddrScript(walletAddr)
+	if err != nil {
+		return nil, err
+	}
+	outputType, err := a.getOutputType(wallet.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to determine wallet output type: %v", err)
+	}
+
+	scripts := pubKeyScripts(keys.pub)
+	changeScripts, err := keys.issuedChangeScripts()
+	if err != nil {
+		return nil, err
+	}
+	parentTxid := parent.TxHash().String()
+	var utxos []UTXO
+	var total int64
+	inputTypes := []string{}
+	for vout, txOut := range parent.TxOut {
+		// The parent pays the wallet key, or the change key of an HD
+		// wallet's payment.
+		scriptType, ok := scripts.match(txOut.PkScript)
+		path, isChange := changeScripts[string(txOut.PkScript)]
+		if isChange {
+			key, err := keys.childPub(path)
+			if err != nil {
+				return nil, err
+			}
+			scriptType, ok = pubKeyScripts(key).match(txOut.PkScript)
+		}
+		if !ok {
+			continue
+		}
+		utxos = append(utxos, UTXO{
+			Txid:             parentTxid,
+			Vout:             uint32(vout),
+			Value:            txOut.Value,
+			ScriptPubKey:     hex.EncodeToString(txOut.PkScript),
+			ScriptPubKeyType: scriptType,
+			Path:             path,
+		})
+		total += txOut.Value
+		inputTypes = append(inputTypes, scriptType)
+	}
+	if len(utxos) == 0 {
+		return nil, invalidField("parent_tx", "has no output paying this wallet")
+	}
+
+	parentSize := int(mempool.GetTxVirtualSize(btcutil.NewTx(parent)))
+	childSize := calculateTransactionSize(inputTypes, []string{outputType}, nil)
+	fee := feeCeil(feeRate, parentSize+childSize) - parentFee
+	if fee < feeForSize(incrementalRelayFeeRate, childSize) {
+		return nil, invalidField("fee_rate", "the parent already pays %d sats, enough for %.2f sat/vB", parentFee, feeRate)
+	}
+	if limit := dustLimit(walletScript); total-fee < limit {
+		return nil, invalidField("fee_rate", "child fee %d leaves %d of the %d sats spent, below the dust threshold of %d", fee, total-fee, total, limit)
+	}
+	if err := limits.checkFee(fee, 0); err != nil {
+		return nil, err
+	}
+
+	child := wire.NewMsgTx(wire.TxVersion)
+	inputKeys, err := keys.forUtxos(utxos)
+	if err != nil {
+		return nil, err
+	}
+	prevOuts, err := addInputs(child, publicKeys(inputKeys), utxos, true)
+	if err != nil {
+		return nil, err
+	}
+	child.AddTxOut(wire.NewTxOut(total-fee, walletScript))
+	if err := signInputs(child, inputKeys, utxos, prevOuts); err != nil {
+		return nil, err
+	}
+	if err := verifySignedTx(child, prevOuts); err != nil {
+		return nil, err
+	}
+
+	hexTx, err := serializeTx(child)
+	if err != nil {
+		return nil, err
+	}
+	return &SignResult{
+		Tx: hexTx,
+		Details: map[string]interface{}{
+			"txid":        child.TxHash().String(),
+			"fee":         fee,
+			"spent_utxos": UTXORefs(utxos),
+		},
+	}, nil
+}
+
+// parentTxFee returns the fee of parent, which spends the JSON list of UTXOs
+// parentUtxos. Every input of parent must execute against the output it
+// spends, so the value of a segwit or taproot output cannot be overstated:
+// its input's signature commits to it. The value of a legacy output is not
+// signed and is trusted.
+func parentTxFee(parent *wire.MsgTx, parentUtxos string) (int64, error) {
+	var utxos []UTXO
+	if err := decodePayload(parentUtxos, &utxos); err != nil {
+		return 0, fmt.Errorf("invalid parent_utxos: %w", err)
+	}
+	spent, err := spentUtxos(parent, utxos, "parent_utxos", "parent_utxos")
+	if err != nil {
+		return 0, err
+	}
+
+	prevOuts := txscript.NewMultiPrevOutFetcher(nil)
+	for i, utxo := range spent {
+		pkScript, err := hex.DecodeString(utxo.ScriptPubKey)
+		if err != nil || len(pkScript) == 0 {
+			return 0, invalidField("parent_utxos", "the output spent by input %d has no valid script_pub_key", i)
+		}
+		if utxo.Value < 0 {
+			return 0, invalidField("parent_utxos", "the output spent by input %d has a negative value", i)
+		}
+		prevOuts.AddPrevOut(parent.TxIn[i].PreviousOutPoint, wire.NewTxOut(utxo.Value, pkScript))
+	}
+	sigHashes := txscript.NewTxSigHashes(parent, prevOuts)
+	for i, txIn := range parent.TxIn {
+		prevOut := prevOuts.FetchPrevOutput(txIn.PreviousOutPoint)
+		vm, err := txscript.NewEngine(prevOut.PkScript, parent, i, txscript.StandardVerifyFlags, nil, sigHashes, prevOut.Value, prevOuts)
+		if err == nil {
+			err = vm.Execute()
+		}
+		if err != nil {
+			return 0, invalidField("parent_utxos", "input %d of the parent does not spend %s with value %d: %v", i, txIn.PreviousOutPoint, prevOut.Value, err)
+		}
+	}
+
+	fee := txFee(parent, spent)
+	if fee < 0 {
+		return 0, invalidField("parent_utxos", "the parent's outputs exceed its inputs by %d sats", -fee)
+	}
+	return fee, nil
+}
+
+// originalChangePath returns the path of the change key the wallet handed out
+// that an output of tx pays, or "" when none does.
+func originalChangePath(keys btcKeys, tx *wire.MsgTx) (string, error) {
+	changeScripts, err := keys.issuedChangeScripts()
+	if err != nil {
+		return "", err
+	}
+	for _, txOut := range tx.TxOut {
+		if path, ok := changeScripts[string(txOut.PkScript)]; ok {
+			return path, nil
+		}
+	}
+	return "", nil
+}
+
+// signalsRBF reports whether tx signals BIP125 replaceability.
+func signalsRBF(tx *wire.MsgTx) bool {
+	for _, txIn := range tx.TxIn {
+		if txIn.Sequence <= rbfSequence {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeTx decodes a hex network transaction from the named field.
+func decodeTx(field, txHex string) (*wire.MsgTx, error) {
+	raw, err := hex.DecodeString(strings.TrimSpace(txHex))
+	if err != nil {
+		return nil, invalidField(field, "%v", err)
+	}
+	var tx wire.MsgTx
+	if err := tx.Deserialize(bytes.NewReader(raw)); err != nil {
+		return nil, invalidField(field, "%v", err)
+	}
+	return &tx, nil
+}
+
+// serializeTx encodes tx as network hex.
+func serializeTx(tx *wire.MsgTx) (string, error) {
+	var buf bytes.Buffer
+	if err := tx.Serialize(&buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf.Bytes()), nil
+}
+
+// spentUtxos returns the UTXOs tx spends, in input order, looked up in utxos.
+// An input missing from utxos is reported against field, naming the list.
+func spentUtxos(tx *wire.MsgTx, utxos []UTXO, field, list string) ([]UTXO, error) {
+	byOutpoint := make(map[string]UTXO, len(utxos))
+	for _, utxo := range utxos {
+		byOutpoint[fmt.Sprintf("%s:%d", strings.ToLower(utxo.Txid), utxo.Vout)] = utxo
+	}
+	spent := make([]UTXO, 0, len(tx.TxIn))
+	for i, txIn := range tx.TxIn {
+		utxo, ok := byOutpoint[txIn.PreviousOutPoint.String()]
+		if !ok {
+			return nil, invalidField(field, "input %d spends %s, which is not in %s", i, txIn.PreviousOutPoint, list)
+		}
+		spent = append(spent, utxo)
+	}
+	return spent, nil
+}
+
+// checkPayments checks that tx starts with the payload's payment outputs
+// followed by its OP_RETURN outputs. The outputs at subtractFeeFrom paid part
+// of the fee and may pay less than their amount.
+func (a *btcAdapter) checkPayments(tx *wire.MsgTx, outputs []BtcOutput, nullData [][]byte, subtractFeeFrom []int) error {
+	if len(tx.TxOut) < len(outputs)+len(nullData) {
+		return invalidField("tx", "does not make the payload's payments")
+	}
+	for i, output := range outputs {
+		txOut, _, err := a.paymentOutput(i, output)
+		if err != nil {
+			return err
+		}
+		value := tx.TxOut[i].Value
+		if slices.Contains(subtractFeeFrom, i) && value <= txOut.Value {
+			value = txOut.Value
+		}
+		if txOut.Value != value || !bytes.Equal(txOut.PkScript, tx.TxOut[i].PkScript) {
+			return invalidField("tx", "output %d does not match the payload's payment", i)
+		}
+	}
+	for i, data := range nullData {
+		script, err := txscript.NullDataScript(data)
+		if err != nil {
+			return err
+		}
+		txOut := tx.TxOut[len(outputs)+i]
+		if txOut.Value != 0 || !bytes.Equal(script, txOut.PkScript) {
+			return invalidField("tx", "output %d does not match the payload's op_return", len(outputs)+i)
+		}
+	}
+	return nil
+}
+
+// txFee returns the fee of tx, which spends utxos.
+func txFee(tx *wire.MsgTx, utxos []UTXO) int64 {
+	var fee int64
+	for _, utxo := range utxos {
+		fee += utxo.Value
+	}
+	for _, txOut := range tx.TxOut {
+		fee -= txOut.Value
+	}
+	return fee
+}
@@ -0,0 +1,227 @@
+package adapters
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"slices"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/mempool"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBumpFee(t *testing.T) {
+	net := &chaincfg.TestNet4Params
+	a := NewBtcAdapter(net)
+
+	wallet, err := a.DeriveWallet()
+	require.NoError(t, err)
+	wif, err := btcutil.DecodeWIF(wallet.PrivateKey)
+	require.NoError(t, err)
+	script := walletScripts(wif)["v0_p2wpkh"]
+
+	utxos := []UTXO{
+		{Txid: "8888888888888888888888888888888888888888888888888888888888888888", Vout: 0, Value: 300000, ScriptPubKey: hex.EncodeToString(script), ScriptPubKeyType: "v0_p2wpkh"},
+		{Txid: "9999999999999999999999999999999999999999999999999999999999999999", Vout: 2, Value: 80000, ScriptPubKey: hex.EncodeToString(script), ScriptPubKeyType: "v0_p2wpkh"},
+	}
+	recipient := "tb1qpn5dddjnc2qwurpsm449l6uvggnjxwsetrnksx"
+	payloadJSON := func(payload BtcPayload) string {
+		payload.Recipient = recipient
+		payload.Amount = 100000
+		payload.FeeRate = 1
+		b, err := json.Marshal(payload)
+		require.NoError(t, err)
+		return string(b)
+	}
+	prevOuts := func(spent []UTXO) []*wire.TxOut {
+		outs := make([]*wire.TxOut, len(spent))
+		for i, utxo := range spent {
+			outs[i] = wire.NewTxOut(utxo.Value, script)
+		}
+		return outs
+	}
+
+	payload := payloadJSON(BtcPayload{Utxos: utxos, RBF: true})
+	original, err := a.CreateSignedTransactionDetailed(wallet, payload)
+	require.NoError(t, err)
+	originalTx, err := decodeTx("tx", original.Tx)
+	require.NoError(t, err)
+	// Rebuilding the payment needs the fresh change key it paid.
+	rebuild := payloadJSON(BtcPayload{Utxos: utxos, RBF: true, ChangePath: original.Details["change_path"].(string)})
+
+	t.Run("RBF signalling - pass", func(t *testing.T) {
+		for _, txIn := range originalTx.TxIn {
+			require.Equal(t, uint32(wire.MaxTxInSequenceNum-2), txIn.Sequence)
+		}
+
+		plain, err := a.CreateSignedTransaction(wallet, payloadJSON(BtcPayload{Utxos: utxos}))
+		require.NoError(t, err)
+		plainTx, err := decodeTx("tx", plain)
+		require.NoError(t, err)
+		require.Equal(t, uint32(wire.MaxTxInSequenceNum), plainTx.TxIn[0].Sequence)
+	})
+
+	t.Run("Bump from payload - pass", func(t *testing.T) {
+		result, err := a.BumpFee(wallet, rebuild, "", 5)
+		require.NoError(t, err)
+		require.Equal(t, originalTx.TxHash().String(), result.Details["replaces_txid"], "rebuilding the payload should reproduce the original")
+
+		replacement, err := decodeTx("tx", result.Tx)
+		require.NoError(t, err)
+		require.Equal(t, result.Details["txid"], replacement.TxHash().String())
+		require.Len(t, replacement.TxIn, len(originalTx.TxIn))
+		for i, txIn := range replacement.TxIn {
+			require.Equal(t, originalTx.TxIn[i].PreviousOutPoint, txIn.PreviousOutPoint)
+			require.Equal(t, uint32(rbfSequence), txIn.Sequence)
+		}
+		require.Equal(t, originalTx.TxOut[0], replacement.TxOut[0], "payments must not change")
+		require.Less(t, replacement.TxOut[1].Value, originalTx.TxOut[1].Value, "the extra fee comes out of the change")
+		require.Equal(t, originalTx.TxOut[1].PkScript, replacement.TxOut[1].PkScript, "the change key is kept")
+		require.Greater(t, result.Details["fee"], original.Details["fee"])
+		verifyInputs(t, replacement, prevOuts(utxos))
+	})
+
+	t.Run("Bump from payload without change_path - fail", func(t *testing.T) {
+		_, err := a.BumpFee(wallet, payload, "", 5)
+		require.ErrorIs(t, err, ErrInvalidPayload)
+		require.ErrorContains(t, err, "change_path: is required to rebuild")
+	})
+
+	t.Run("Bump original keeps its change key - pass", func(t *testing.T) {
+		result, err := a.BumpFee(wallet, payload, original.Tx, 5)
+		require.NoError(t, err)
+		replacement, err := decodeTx("tx", result.Tx)
+		require.NoError(t, err)
+		require.Equal(t, originalTx.TxOut[1].PkScript, replacement.TxOut[1].PkScript)
+	})
+
+	t.Run("Bump too small - fail", func(t *testing.T) {
+		_, err := a.BumpFee(wallet, rebuild, "", 1.5)
+		require.ErrorIs(t, err, ErrInvalidPayload)
+		require.ErrorContains(t, err, "fee_rate")
+	})
+
+	t.Run("Bump coin selected payment - pass", func(t *testing.T) {
+		selecting := payloadJSON(BtcPayload{Utxos: utxos, CoinSelection: CoinSelectionLargestFirst, RBF: true})
+		signed, err := a.CreateSignedTransactionDetailed(wallet, selecting)
+		require.NoError(t, err)
+
+		_, err = a.BumpFee(wallet, selecting, "", 5)
+		require.ErrorContains(t, err, "coin_selection")
+
+		result, err := a.BumpFee(wallet, selecting, signed.Tx, 5)
+		require.NoError(t, err)
+		replacement, err := decodeTx("tx", result.Tx)
+		require.NoError(t, err)
+		require.Len(t, replacement.TxIn, 1, "the replacement spends only the selected UTXO")
+		verifyInputs(t, replacement, prevOuts(utxos[:1]))
+	})
+
+	t.Run("Bump send max payment of fewer UTXOs - pass", func(t *testing.T) {
+		sweep := func(spent []UTXO) string {
+			b, err := json.Marshal(BtcPayload{Recipient: recipient, FeeRate: 1, Utxos: spent, SendMax: true, RBF: true})
+			require.NoError(t, err)
+			return string(b)
+		}
+		signed, err := a.CreateSignedTransactionDetailed(wallet, sweep(utxos[:1]))
+		require.NoError(t, err)
+
+		// The payload lists more UTXOs than the original spent, so the
+		// amount paid is computed from the spent ones.
+		result, err := a.BumpFee(wallet, sweep(utxos), signed.Tx, 5)
+		require.NoError(t, err)
+		replacement, err := decodeTx("tx", result.Tx)
+		require.NoError(t, err)
+		require.Len(t, replacement.TxIn, 1)
+		require.Len(t, replacement.TxOut, 1)
+		require.Equal(t, utxos[0].Value-result.Details["fee"].(int64), replacement.TxOut[0].Value)
+		verifyInputs(t, replacement, prevOuts(utxos[:1]))
+	})
+
+	t.Run("Bump transaction not signalling RBF - fail", func(t *testing.T) {
+		plainPayload := payloadJSON(BtcPayload{Utxos: utxos})
+		plain, err := a.CreateSignedTransactionDetailed(wallet, plainPayload)
+		require.NoError(t, err)
+
+		_, err = a.BumpFee(wallet, plainPayload, plain.Tx, 5)
+		require.ErrorIs(t, err, ErrInvalidPayload)
+		require.ErrorContains(t, err, "does not signal BIP125")
+
+		_, err = a.BumpFee(wallet, payloadJSON(BtcPayload{Utxos: utxos, ChangePath: plain.Details["change_path"].(string)}), "", 5)
+		require.ErrorIs(t, err, ErrInvalidPayload)
+		require.ErrorContains(t, err, "does not signal BIP125")
+	})
+
+	t.Run("Bump tx spending other UTXOs - fail", func(t *testing.T) {
+		_, err := a.BumpFee(wallet, payloadJSON(BtcPayload{Utxos: utxos[1:]}), original.Tx, 5)
+		require.ErrorIs(t, err, ErrInvalidPayload)
+		require.ErrorContains(t, err, "not in the payload utxos")
+	})
+
+	t.Run("Bump tx with other payments - fail", func(t *testing.T) {
+		other, err := json.Marshal(BtcPayload{Recipient: recipient, Amount: 90000, FeeRate: 1, Utxos: utxos})
+		require.NoError(t, err)
+		_, err = a.BumpFee(wallet, string(other), original.Tx, 5)
+		require.ErrorIs(t, err, ErrInvalidPayload)
+		require.ErrorContains(t, err, "does not match")
+	})
+
+	t.Run("Child pays for parent - pass", func(t *testing.T) {
+		// The parent's change went to the wallet's first change key.
+		require.Equal(t, "1/0", original.Details["change_path"])
+		parentFee := original.Details["fee"].(int64)
+		result, err := a.ChildPaysForParent(wallet, original.Tx, mustJSON(t, utxos), 10)
+		require.NoError(t, err)
+		require.Equal(t, []string{originalTx.TxHash().String() + ":1"}, result.Details["spent_utxos"])
+
+		child, err := decodeTx("tx", result.Tx)
+		require.NoError(t, err)
+		require.Len(t, child.TxIn, 1)
+		require.Len(t, child.TxOut, 1)
+		require.Equal(t, script, child.TxOut[0].PkScript)
+
+		// The package of parent and a 110 vbyte child pays 10 sat/vB.
+		parentSize := mempool.GetTxVirtualSize(btcutil.NewTx(originalTx))
+		fee := result.Details["fee"].(int64)
+		require.Equal(t, 10*(parentSize+110)-parentFee, fee)
+		require.Equal(t, originalTx.TxOut[1].Value-fee, child.TxOut[0].Value)
+		verifyInputs(t, child, []*wire.TxOut{originalTx.TxOut[1]})
+	})
+
+	t.Run("Parent already pays the rate - fail", func(t *testing.T) {
+		_, err := a.ChildPaysForParent(wallet, original.Tx, mustJSON(t, utxos), 0.5)
+		require.ErrorIs(t, err, ErrInvalidPayload)
+		require.ErrorContains(t, err, "already pays")
+	})
+
+	t.Run("Parent with an overstated UTXO value - fail", func(t *testing.T) {
+		// Claiming the parent pays 100000 sats more would let the child
+		// underpay, but the parent's signatures commit to the real values.
+		inflated := slices.Clone(utxos)
+		inflated[1].Value += 100000
+		_, err := a.ChildPaysForParent(wallet, original.Tx, mustJSON(t, inflated), 10)
+		require.ErrorIs(t, err, ErrInvalidPayload)
+		require.ErrorContains(t, err, "parent_utxos: input 1 of the parent does not spend")
+	})
+
+	t.Run("Parent spending unlisted UTXOs - fail", func(t *testing.T) {
+		_, err := a.ChildPaysForParent(wallet, original.Tx, mustJSON(t, utxos[:1]), 10)
+		require.ErrorIs(t, err, ErrInvalidPayload)
+		require.ErrorContains(t, err, "which is not in parent_utxos")
+
+		_, err = a.ChildPaysForParent(wallet, original.Tx, `[{"txid": "88", "fee": 1}]`, 10)
+		require.ErrorIs(t, err, ErrInvalidPayload)
+		require.ErrorContains(t, err, "unknown field")
+	})
+
+	t.Run("Parent without wallet outputs - fail", func(t *testing.T) {
+		other, err := a.DeriveWallet()
+		require.NoError(t, err)
+		_, err = a.ChildPaysForParent(other, original.Tx, mustJSON(t, utxos), 10)
+		require.ErrorIs(t, err, ErrInvalidPayload)
+		require.ErrorContains(t, err, "no output paying this wallet")
+	})
+}
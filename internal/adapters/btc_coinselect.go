@@ -0,0 +1,343 @@
+package adapters
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"sort"
+
+	"github.com/shopspring/decimal"
+)
+
+// Coin selection algorithms a payload can request. An empty algorithm spends
+// every UTXO in the payload.
+const (
+	CoinSelectionBnB          = "bnb"
+	CoinSelectionKnapsack     = "knapsack"
+	CoinSelectionLargestFirst = "largest_first"
+)
+
+const (
+	// bnbMaxTries bounds the branch-and-bound search, as in Bitcoin Core.
+	bnbMaxTries = 100000
+	// knapsackIterations is the number of random subsets tried per target.
+	knapsackIterations = 1000
+)
+
+// coinCandidate is a UTXO with the value it contributes once the fee for
+// spending it is paid.
+type coinCandidate struct {
+	utxo           UTXO
+	effectiveValue int64
+}
+
+// coinSelection describes what the selected inputs have to pay for.
+type coinSelection struct {
+	outputTypes   []string
+	nullDataSizes []int
+	changeType    string
+	amount        int64
+	feeRate       float64
+}
+
+// selectCoins picks inputs from utxos with the given algorithm, returning the
+// selected and the unused UTXOs. UTXOs that cost more to spend than they are
+// worth at the fee rate are never selected.
+func selectCoins(algorithm string, utxos []UTXO, params coinSelection) ([]UTXO, []UTXO, error) {
+	var candidates []coinCandidate
+	for _, utxo := range utxos {
+		weight, ok := inputWeights[utxo.ScriptPubKeyType]
+		if !ok {
+			return nil, nil, fmt.Errorf("unsupported script type: %s", utxo.ScriptPubKeyType)
+		}
+		// A legacy input of a segwit transaction adds an empty witness.
+		if utxo.ScriptPubKeyType == "p2pkh" {
+			weight++
+		}
+		effectiveValue := utxo.Value - feeCeil(params.feeRate, weightToVSize(weight))
+		if effectiveValue > 0 {
+			candidates = append(candidates, coinCandidate{utxo: utxo, effectiveValue: effectiveValue})
+		}
+	}
+
+	// The inputs must cover the payments and the fee for everything but
+	// themselves. Fees are rounded up and the segwit marker always counted so
+	// the estimate never falls below the fee CalculateFee charges.
+	baseSize := calculateTransactionSize(nil, params.outputTypes, params.nullDataSizes)
+	baseSize += weightToVSize(segwitWeight)
+	target := params.amount + feeCeil(params.feeRate, baseSize)
+
+	// A change output costs its own size now and an input to spend later.
+	changeSize := weightToVSize(outputWeight(outputScriptSizes[params.changeType]))
+	costOfChange := feeCeil(params.feeRate, changeSize+weightToVSize(inputWeights[changeInputType(params.changeType)]))
+	minChange := dustThreshold + feeCeil(params.feeRate, changeSize)
+
+	var selected []coinCandidate
+	switch algorithm {
+	case CoinSelectionBnB:
+		// Excess below the dust threshold is dropped to the fee, so a
+		// changeless solution must also stay under it.
+		selected = selectBnB(candidates, target, min(costOfChange, dustThreshold-1))
+		if selected == nil {
+			selected = selectKnapsack(candidates, target, minChange)
+		}
+	case CoinSelectionKnapsack:
+		selected = selectKnapsack(candidates, target, minChange)
+	case CoinSelectionLargestFirst:
+		selected = selectLargestFirst(candidates, target)
+	default:
+		return nil, nil, invalidField("coin_selection", "must be one of %s, %s, %s", CoinSelectionBnB, CoinSelectionKnapsack, CoinSelectionLargestFirst)
+	}
+	if selected == nil {
+		var available int64
+		for _, c := range candidates {
+			available += c.effectiveValue
+		}
+		return nil, nil, invalidField("utxos", "insufficient funds: spendable %d, needed %d", available, target)
+	}
+
+	chosen := make(map[UTXO]bool, len(selected))
+	var selectedUtxos, unusedUtxos []UTXO
+	for _, c := range selected {
+		chosen[c.utxo] = true
+	}
+	// Keep the payload order so the result does not depend on the search.
+	for _, utxo := range utxos {
+		if chosen[utxo] {
+			selectedUtxos = append(selectedUtxos, utxo)
+			delete(chosen, utxo)
+		} else {
+			unusedUtxos = append(unusedUtxos, utxo)
+		}
+	}
+	return selectedUtxos, unusedUtxos, nil
+}
+
+// feeCeil is feeForSize rounded up.
+func feeCeil(feeRate float64, size int) int64 {
+	return decimal.NewFromFloat(feeRate).Mul(decimal.NewFromInt(int64(size))).Ceil().IntPart()
+}
+
+// changeInputType maps a change address type to the UTXO script type it is
+// later spent as.
+func changeInputType(changeType string) string {
+	switch changeType {
+	case "p2wpkh":
+		return "v0_p2wpkh"
+	case "p2tr":
+		return "v1_p2tr"
+	case "p2sh":
+		return "p2sh_p2wpkh"
+	default:
+		return changeType
+	}
+}
+
+// selectBnB searches depth first for the subset whose effective value lands in
+// [target, target+window] with the least excess, so that no change output is
+// needed. It returns nil when no such subset is found.
+func selectBnB(candidates []coinCandidate, target, window int64) []coinCandidate {
+	sorted := append([]coinCandidate(nil), candidates...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].effectiveValue > sorted[j].effectiveValue
+	})
+
+	// remaining is the value of the coins not decided yet.
+	var remaining int64
+	for _, c := range sorted {
+		remaining += c.effectiveValue
+	}
+	if remaining < target {
+		return nil
+	}
+
+	var (
+		selection  = make([]bool, len(sorted))
+		best       []bool
+		bestExcess int64 = -1
+		value      int64
+		depth      int
+	)
+	for tries := 0; tries < bnbMaxTries; tries++ {
+		backtrack := false
+		switch {
+		case value+remaining < target || value > target+window:
+			backtrack = true
+		case value >= target:
+			if excess := value - target; bestExcess < 0 || excess < bestExcess {
+				bestExcess = excess
+				best = append(best[:0], selection...)
+			}
+			backtrack = true
+		case depth == len(sorted):
+			backtrack = true
+		}
+		if bestExcess == 0 {
+			break
+		}
+
+		if !backtrack {
+			// Try including the next coin first.
+			remaining -= sorted[depth].effectiveValue
+			value += sorted[depth].effectiveValue
+			selection[depth] = true
+			depth++
+			continue
+		}
+
+		// Walk back to the last included coin and exclude it instead.
+		for depth > 0 && !selection[depth-1] {
+			depth--
+			remaining += sorted[depth].effectiveValue
+		}
+		if depth == 0 {
+			break
+		}
+		selection[depth-1] = false
+		value -= sorted[depth-1].effectiveValue
+	}
+
+	if best == nil {
+		return nil
+	}
+	var selected []coinCandidate
+	for i, included := range best {
+		if included {
+			selected = append(selected, sorted[i])
+		}
+	}
+	return selected
+}
+
+// selectKnapsack follows Bitcoin Core's knapsack solver: an exact match or
+// the smallest coin covering target plus minChange wins, otherwise random
+// subsets of the smaller coins approximate the best combination.
+func selectKnapsack(candidates []coinCandidate, target, minChange int64) []coinCandidate {
+	// Sort by outpoint first so the payload order does not change the result.
+	shuffled := append([]coinCandidate(nil), candidates...)
+	sort.Slice(shuffled, func(i, j int) bool {
+		if shuffled[i].utxo.Txid != shuffled[j].utxo.Txid {
+			return shuffled[i].utxo.Txid < shuffled[j].utxo.Txid
+		}
+		return shuffled[i].utxo.Vout < shuffled[j].utxo.Vout
+	})
+	rng := knapsackRand(shuffled)
+	rng.Shuffle(len(shuffled), func(i, j int) { shuffled[i], shuffled[j] = shuffled[j], shuffled[i] })
+
+	var (
+		applicable  []coinCandidate
+		totalLower  int64
+		lowestLarge *coinCandidate
+	)
+	for i, c := range shuffled {
+		switch {
+		case c.effectiveValue == target:
+			return []coinCandidate{c}
+		case c.effectiveValue < target+minChange:
+			applicable = append(applicable, c)
+			totalLower += c.effectiveValue
+		case lowestLarge == nil || c.effectiveValue < lowestLarge.effectiveValue:
+			lowestLarge = &shuffled[i]
+		}
+	}
+
+	if totalLower == target {
+		return applicable
+	}
+	if totalLower < target {
+		if lowestLarge == nil {
+			return nil
+		}
+		return []coinCandidate{*lowestLarge}
+	}
+
+	sort.SliceStable(applicable, func(i, j int) bool {
+		return applicable[i].effectiveValue > applicable[j].effectiveValue
+	})
+	best, bestValue := approximateBestSubset(rng, applicable, totalLower, target)
+	if bestValue != target && totalLower >= target+minChange {
+		best, bestValue = approximateBestSubset(rng, applicable, totalLower, target+minChange)
+	}
+
+	// Prefer the single larger coin when the subset leaves change below
+	// minChange or is no smaller.
+	if lowestLarge != nil && ((bestValue != target && bestValue < target+minChange) || lowestLarge.effectiveValue <= bestValue) {
+		return []coinCandidate{*lowestLarge}
+	}
+
+	var selected []coinCandidate
+	for i, included := range best {
+		if included {
+			selected = append(selected, applicable[i])
+		}
+	}
+	return selected
+}
+
+// knapsackRand returns a random source seeded from the outpoints of the sorted
+// candidates, so the same pool always yields the same selection and a
+// rebuilt transaction matches the original.
+func knapsackRand(sorted []coinCandidate) *rand.Rand {
+	h := sha256.New()
+	for _, c := range sorted {
+		fmt.Fprintf(h, "%s:%d\n", c.utxo.Txid, c.utxo.Vout)
+	}
+	return rand.New(rand.NewSource(int64(binary.BigEndian.Uint64(h.Sum(nil)))))
+}
+
+// approximateBestSubset randomly includes coins, trying to reach target with
+// as little excess as possible.
+func approximateBestSubset(rng *rand.Rand, coins []coinCandidate, totalLower, target int64) ([]bool, int64) {
+	best := make([]bool, len(coins))
+	for i := range best {
+		best[i] = true
+	}
+	bestValue := totalLower
+
+	included := make([]bool, len(coins))
+	for rep := 0; rep < knapsackIterations && bestValue != target; rep++ {
+		for i := range included {
+			included[i] = false
+		}
+		var total int64
+		reachedTarget := false
+		for pass := 0; pass < 2 && !reachedTarget; pass++ {
+			for i, c := range coins {
+				// The first pass picks coins at random, the second fills in
+				// with the coins left out.
+				if (pass == 0 && rng.Intn(2) == 0) || (pass == 1 && !included[i]) {
+					total += c.effectiveValue
+					included[i] = true
+					if total >= target {
+						reachedTarget = true
+						if total < bestValue {
+							bestValue = total
+							copy(best, included)
+						}
+						total -= c.effectiveValue
+						included[i] = false
+					}
+				}
+			}
+		}
+	}
+	return best, bestValue
+}
+
+// selectLargestFirst spends the largest coins until target is covered.
+func selectLargestFirst(candidates []coinCandidate, target int64) []coinCandidate {
+	sorted := append([]coinCandidate(nil), candidates...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].effectiveValue > sorted[j].effectiveValue
+	})
+
+	var value int64
+	for i, c := range sorted {
+		value += c.effectiveValue
+		if value >= target {
+			return sorted[:i+1]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package adapters
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelectCoins(t *testing.T) {
+	utxo := func(txid byte, value int64) UTXO {
+		id := make([]byte, 64)
+		for i := range id {
+			id[i] = "0123456789abcdef"[txid%16]
+		}
+		return UTXO{Txid: string(id), Value: value, ScriptPubKeyType: "v0_p2wpkh"}
+	}
+	// Effective values at 1 sat/vB are the values less 68.
+	pool := []UTXO{
+		utxo(1, 50068),  // 50000
+		utxo(2, 30112),  // 30044
+		utxo(3, 100068), // 100000
+		utxo(4, 60068),  // 60000
+		utxo(5, 60),     // costs more than it is worth
+	}
+	// 80000 plus 44 vbytes of outputs, overhead and segwit marker is exactly A+B.
+	params := coinSelection{
+		outputTypes: []string{"p2wpkh"},
+		changeType:  "p2wpkh",
+		amount:      80000,
+		feeRate:     1,
+	}
+
+	cases := []struct {
+		Name      string
+		Algorithm string
+		Params    coinSelection
+		Selected  []UTXO // nil when any covering selection is fine
+		Error     bool
+	}{
+		{
+			Name:      "Branch and bound finds changeless pair",
+			Algorithm: CoinSelectionBnB,
+			Params:    params,
+			Selected:  []UTXO{pool[0], pool[1]},
+		},
+		{
+			Name:      "Largest first takes the biggest coin",
+			Algorithm: CoinSelectionLargestFirst,
+			Params:    params,
+			Selected:  []UTXO{pool[2]},
+		},
+		{
+			Name:      "Knapsack covers the target",
+			Algorithm: CoinSelectionKnapsack,
+			Params:    params,
+		},
+		{
+			Name:      "Branch and bound falls back to knapsack",
+			Algorithm: CoinSelectionBnB,
+			Params:    coinSelection{outputTypes: []string{"p2wpkh"}, changeType: "p2wpkh", amount: 150000, feeRate: 1},
+		},
+		{
+			Name:      "Insufficient funds",
+			Algorithm: CoinSelectionBnB,
+			Params:    coinSelection{outputTypes: []string{"p2wpkh"}, changeType: "p2wpkh", amount: 250000, feeRate: 1},
+			Error:     true,
+		},
+		{
+			Name:      "Unknown algorithm",
+			Algorithm: "random",
+			Params:    params,
+			Error:     true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			selected, unused, err := selectCoins(tc.Algorithm, pool, tc.Params)
+			if tc.Error {
+				require.ErrorIs(t, err, ErrInvalidPayload)
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, append(selected, unused...), len(pool))
+			require.Contains(t, unused, pool[4], "uneconomical UTXOs should never be selected")
+
+			if tc.Selected != nil {
+				require.Equal(t, tc.Selected, selected)
+			}
+
+			var total int64
+			inputTypes := make([]string, len(selected))
+			for i, u := range selected {
+				total += u.Value
+				inputTypes[i] = u.ScriptPubKeyType
+			}
+			feeInfo, err := CalculateFee(FeeParams{
+				InputTypes:  inputTypes,
+				OutputTypes: tc.Params.outputTypes,
+				ChangeType:  tc.Params.changeType,
+				Amount:      tc.Params.amount,
+				TotalInput:  total,
+				FeeRate:     tc.Params.feeRate,
+			})
+			require.NoError(t, err, "selected inputs should pay for the transaction")
+			if tc.Algorithm == CoinSelectionBnB && tc.Selected != nil {
+				require.Equal(t, 1, feeInfo.NumOutputs, "branch and bound should avoid change")
+			}
+		})
+	}
+}
+
+func TestSelectKnapsackReproducible(t *testing.T) {
+	var pool []UTXO
+	for i := 0; i < 20; i++ {
+		pool = append(pool, UTXO{
+			Txid:             fmt.Sprintf("%064x", i+1),
+			Vout:             uint32(i % 3),
+			Value:            int64(10000 + 1733*i),
+			ScriptPubKeyType: "v0_p2wpkh",
+		})
+	}
+	params := coinSelection{outputTypes: []string{"p2wpkh"}, changeType: "p2wpkh", amount: 123456, feeRate: 2}
+
+	first, _, err := selectCoins(CoinSelectionKnapsack, pool, params)
+	require.NoError(t, err)
+
+	t.Run("Same pool - pass", func(t *testing.T) {
+		for i := 0; i < 10; i++ {
+			selected, _, err := selectCoins(CoinSelectionKnapsack, pool, params)
+			require.NoError(t, err)
+			require.Equal(t, first, selected)
+		}
+	})
+
+	t.Run("Reordered pool - pass", func(t *testing.T) {
+		reversed := slices.Clone(pool)
+		slices.Reverse(reversed)
+		selected, _, err := selectCoins(CoinSelectionKnapsack, reversed, params)
+		require.NoError(t, err)
+		// Selected UTXOs keep the payload order.
+		slices.Reverse(selected)
+		require.Equal(t, first, selected)
+	})
+}
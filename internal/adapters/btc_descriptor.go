@@ -0,0 +1,165 @@
+package adapters
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/chaincfg"
+)
+
+// BIP44-style purposes of the account each address type is derived under.
+var addressTypePurposes = map[string]uint32{
+	AddressTypeP2WPKH:     84,
+	AddressTypeP2SHP2WPKH: 49,
+	AddressTypeP2TR:       86,
+}
+
+// SLIP-132 public key versions of the address types that have one, for
+// mainnet and for the test networks.
+var slip132Versions = map[string][2][]byte{
+	AddressTypeP2WPKH:     {{0x04, 0xb2, 0x47, 0x46}, {0x04, 0x5f, 0x1c, 0xf6}}, // zpub, vpub
+	AddressTypeP2SHP2WPKH: {{0x04, 0x9d, 0x7c, 0xb2}, {0x04, 0x4a, 0x52, 0x62}}, // ypub, upub
+}
+
+// BtcDescriptors are the BIP380 output descriptors of a wallet, with their
+// checksums.
+type BtcDescriptors struct {
+	// Descriptor covers the receive addresses of the wallet's HD account,
+	// <account>/0/*. Empty when the wallet has no HD account.
+	Descriptor string
+	// ChangeDescriptor covers the account's change addresses, <account>/1/*.
+	// Empty when the wallet has no HD account.
+	ChangeDescriptor string
+	// AddressDescriptor covers only the wallet's own address.
+	AddressDescriptor string
+}
+
+// ExportAccount returns the public data of the wallet's HD account.
+func (a *btcAdapter) ExportAccount(wallet *Wallet) (*AccountExport, error) {
+	if wallet.Account == nil {
+		return nil, ErrNoHDAccount
+	}
+	addressType, err := a.walletType(wallet)
+	if err != nil {
+		return nil, err
+	}
+	export := &AccountExport{HDAccount: *wallet.Account}
+	if versions, ok := slip132Versions[addressType]; ok {
+		accountKey, err := hdkeychain.NewKeyFromString(wallet.Account.ExtendedKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode account key: %w", err)
+		}
+		version := versions[1]
+		if bytes.Equal(a.net.HDPublicKeyID[:], chaincfg.MainNetParams.HDPublicKeyID[:]) {
+			version = versions[0]
+		}
+		slip132Key, err := accountKey.CloneWithVersion(version)
+		if err != nil {
+			return nil, err
+		}
+		export.SLIP132Key = slip132Key.String()
+	}
+	return export, nil
+}
+
+// Descriptors returns the output descriptors of the wallet: wpkh() for
+// p2wpkh, sh(wpkh()) for p2sh_p2wpkh and tr() for p2tr wallets.
+func (a *btcAdapter) Descriptors(wallet *Wallet) (*BtcDescriptors, error) {
+	addressType, err := a.walletType(wallet)
+	if err != nil {
+		return nil, err
+	}
+	wif, err := btcutil.DecodeWIF(wallet.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode WIF: %w", err)
+	}
+	pubKey := hex.EncodeToString(wif.SerializePubKey())
+	if addressType == AddressTypeP2TR {
+		pubKey = hex.EncodeToString(schnorr.SerializePubKey(wif.PrivKey.PubKey()))
+	}
+
+	descriptors := &BtcDescriptors{}
+	if account := wallet.Account; account != nil {
+		origin := account.Fingerprint + strings.TrimPrefix(account.Path, "m")
+		descriptors.Descriptor = descriptorWithChecksum(outputDescriptor(addressType, fmt.Sprintf("[%s]%s/0/*", origin, account.ExtendedKey)))
+		descriptors.ChangeDescriptor = descriptorWithChecksum(outputDescriptor(addressType, fmt.Sprintf("[%s]%s/1/*", origin, account.ExtendedKey)))
+		pubKey = fmt.Sprintf("[%s/0/0]%s", origin, pubKey)
+	}
+	descriptors.AddressDescriptor = descriptorWithChecksum(outputDescriptor(addressType, pubKey))
+	return descriptors, nil
+}
+
+// walletType returns the address type of the wallet, checking that its key
+// is for the adapter's network.
+func (a *btcAdapter) walletType(wallet *Wallet) (string, error) {
+	wif, err := btcutil.DecodeWIF(wallet.PrivateKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode WIF: %w", err)
+	}
+	if !wif.IsForNet(a.net) {
+		return "", fmt.Errorf("wif network mismatch: wallet WIF not for %s", a.net.Name)
+	}
+	return walletAddressType(wif, wallet.PublicKey, a.net)
+}
+
+// outputDescriptor wraps a key expression in the descriptor of addressType.
+func outputDescriptor(addressType, key string) string {
+	switch addressType {
+	case AddressTypeP2SHP2WPKH:
+		return "sh(wpkh(" + key + "))"
+	case AddressTypeP2TR:
+		return "tr(" + key + ")"
+	default:
+		return "wpkh(" + key + ")"
+	}
+}
+
+const (
+	descriptorInputCharset    = "0123456789()[],'/*abcdefgh@:$%{}IJKLMNOPQRSTUVWXYZ&+-.;<=>?!^_|~ijklmnopqrstuvwxyzABCDEFGH`#\"\\ "
+	descriptorChecksumCharset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+)
+
+// descriptorPolymod is one step of the BIP380 checksum's BCH code.
+func descriptorPolymod(c uint64, val uint64) uint64 {
+	c0 := c >> 35
+	c = (c&0x7ffffffff)<<5 ^ val
+	for i, gen := range []uint64{0xf5dee51989, 0xa9fdca3312, 0x1bab10e32d, 0x3706b1677a, 0x644d626ffd} {
+		if c0>>i&1 != 0 {
+			c ^= gen
+		}
+	}
+	return c
+}
+
+// descriptorWithChecksum appends the BIP380 checksum to desc, which only
+// uses characters of the descriptor charset.
+func descriptorWithChecksum(desc string) string {
+	c, cls, clsCount := uint64(1), uint64(0), 0
+	for _, ch := range desc {
+		pos := uint64(strings.IndexRune(descriptorInputCharset, ch))
+		c = descriptorPolymod(c, pos&31)
+		cls = cls*3 + pos>>5
+		if clsCount++; clsCount == 3 {
+			c = descriptorPolymod(c, cls)
+			cls, clsCount = 0, 0
+		}
+	}
+	if clsCount > 0 {
+		c = descriptorPolymod(c, cls)
+	}
+	for range 8 {
+		c = descriptorPolymod(c, 0)
+	}
+	c ^= 1
+
+	checksum := make([]byte, 8)
+	for j := range checksum {
+		checksum[j] = descriptorChecksumCharset[c>>(5*(7-j))&31]
+	}
+	return desc + "#" + string(checksum)
+}
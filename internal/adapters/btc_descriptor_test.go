@@ -0,0 +1,113 @@
+package adapters
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/stretchr/testify/require"
+)
+
+// accountReceiveKey derives the first receive key of an exported account.
+func accountReceiveKey(t *testing.T, account *HDAccount) *btcec.PublicKey {
+	t.Helper()
+	return accountChildKey(t, account, 0, 0)
+}
+
+// accountChildKey derives the key at <chain>/<index> of an exported account,
+// as a watch-only wallet would.
+func accountChildKey(t *testing.T, account *HDAccount, chain, index uint32) *btcec.PublicKey {
+	t.Helper()
+	accountKey, err := hdkeychain.NewKeyFromString(account.ExtendedKey)
+	require.NoError(t, err)
+	require.False(t, accountKey.IsPrivate())
+	chainKey, err := accountKey.Derive(chain)
+	require.NoError(t, err)
+	key, err := chainKey.Derive(index)
+	require.NoError(t, err)
+	pubKey, err := key.ECPubKey()
+	require.NoError(t, err)
+	return pubKey
+}
+
+func TestDescriptorChecksum(t *testing.T) {
+	require.Equal(t, "raw(deadbeef)#89f8spxm", descriptorWithChecksum("raw(deadbeef)"))
+	require.Equal(t,
+		"wpkh([d34db33f/84h/1h/0h]tpubDC8msFGeGuwnKG9Upg7DM2b4DaRqg3CUZa5g8v2SRQ6K4NSkxUgd7HsL2XVWbVm39yBA4LAxysQAm397zwQSQoQgewGiYZqrA9DsP4zbQ1M/0/*)#efef7act",
+		descriptorWithChecksum("wpkh([d34db33f/84h/1h/0h]tpubDC8msFGeGuwnKG9Upg7DM2b4DaRqg3CUZa5g8v2SRQ6K4NSkxUgd7HsL2XVWbVm39yBA4LAxysQAm397zwQSQoQgewGiYZqrA9DsP4zbQ1M/0/*)"))
+}
+
+func TestExportBtcAccount(t *testing.T) {
+	for _, tc := range []struct {
+		net         *chaincfg.Params
+		addressType string
+		path        string
+		slip132     string
+		descriptor  string
+	}{
+		{&chaincfg.TestNet4Params, AddressTypeP2WPKH, "m/84h/1h/0h", "vpub", "wpkh("},
+		{&chaincfg.TestNet4Params, AddressTypeP2SHP2WPKH, "m/49h/1h/0h", "upub", "sh(wpkh("},
+		{&chaincfg.TestNet4Params, AddressTypeP2TR, "m/86h/1h/0h", "", "tr("},
+		{&chaincfg.MainNetParams, AddressTypeP2WPKH, "m/84h/0h/0h", "zpub", "wpkh("},
+	} {
+		t.Run("Export "+tc.net.Name+" "+tc.addressType+" - pass", func(t *testing.T) {
+			a := NewBtcAdapter(tc.net)
+			wallet, err := a.DeriveWalletOfType(tc.addressType)
+			require.NoError(t, err)
+
+			export, err := a.ExportAccount(wallet)
+			require.NoError(t, err)
+			require.Equal(t, tc.path, export.Path)
+			require.Len(t, export.Fingerprint, 8)
+			if tc.slip132 == "" {
+				require.Empty(t, export.SLIP132Key)
+			} else {
+				require.True(t, strings.HasPrefix(export.SLIP132Key, tc.slip132), export.SLIP132Key)
+			}
+
+			// The wallet key is the account's first receive key.
+			wif, err := btcutil.DecodeWIF(wallet.PrivateKey)
+			require.NoError(t, err)
+			require.True(t, accountReceiveKey(t, &export.HDAccount).IsEqual(wif.PrivKey.PubKey()))
+
+			descriptors, err := a.Descriptors(wallet)
+			require.NoError(t, err)
+			origin := "[" + export.Fingerprint + strings.TrimPrefix(tc.path, "m")
+			body, _, _ := strings.Cut(descriptors.Descriptor, "#")
+			require.Equal(t, descriptorWithChecksum(body), descriptors.Descriptor)
+			require.True(t, strings.HasPrefix(body, tc.descriptor+origin+"]"+export.ExtendedKey+"/0/*)"), body)
+			body, _, _ = strings.Cut(descriptors.ChangeDescriptor, "#")
+			require.Equal(t, descriptorWithChecksum(body), descriptors.ChangeDescriptor)
+			require.True(t, strings.HasPrefix(body, tc.descriptor+origin+"]"+export.ExtendedKey+"/1/*)"), body)
+			body, _, _ = strings.Cut(descriptors.AddressDescriptor, "#")
+			require.Equal(t, descriptorWithChecksum(body), descriptors.AddressDescriptor)
+			require.True(t, strings.HasPrefix(body, tc.descriptor+origin+"/0/0]"), body)
+		})
+	}
+
+	t.Run("Export wallet without account - fail", func(t *testing.T) {
+		a := NewBtcAdapter(&chaincfg.TestNet4Params)
+		privateKey, err := btcec.NewPrivateKey()
+		require.NoError(t, err)
+		wif, err := btcutil.NewWIF(privateKey, a.net, true)
+		require.NoError(t, err)
+		addr, err := walletAddress(wif, AddressTypeP2TR, a.net)
+		require.NoError(t, err)
+		wallet := &Wallet{PrivateKey: wif.String(), PublicKey: addr.EncodeAddress()}
+
+		_, err = a.ExportAccount(wallet)
+		require.ErrorIs(t, err, ErrNoHDAccount)
+
+		// The wallet address alone can still be described.
+		descriptors, err := a.Descriptors(wallet)
+		require.NoError(t, err)
+		require.Empty(t, descriptors.Descriptor)
+		require.Empty(t, descriptors.ChangeDescriptor)
+		require.Equal(t, descriptorWithChecksum("tr("+hex.EncodeToString(schnorr.SerializePubKey(privateKey.PubKey()))+")"), descriptors.AddressDescriptor)
+	})
+}
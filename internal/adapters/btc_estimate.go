@@ -0,0 +1,47 @@
+package adapters
+
+import "fmt"
+
+// FeeEstimate is the outcome of a dry run of a payment.
+type FeeEstimate struct {
+	FeeInfo
+	SelectedUtxos []UTXO
+	UnusedUtxos   []UTXO
+}
+
+// EstimateFee runs a payment through the same planning, validation, coin
+// selection, fee calculation and fee limits as CreateSignedTransaction, and
+// stops before signing. It only needs the wallet's public keys, which give
+// the scripts the UTXOs must pay and the change.
+func (a *btcAdapter) EstimateFee(wallet *Wallet, payload string) (*FeeEstimate, error) {
+	btcPayload, err := a.validatePayload(payload)
+	if err != nil {
+		return nil, fmt.Errorf("invalid payload type, expected BtcPayload: %w", err)
+	}
+	keys, addressType, err := a.publicWalletKey(wallet)
+	if err != nil {
+		return nil, err
+	}
+
+	plan, err := a.planPayment(keys, addressType, btcPayload)
+	if err != nil {
+		return nil, err
+	}
+	inputKeys, err := keys.pubsForUtxos(plan.spec.utxos)
+	if err != nil {
+		return nil, err
+	}
+	_, _, feeInfo, err := a.buildTx(inputKeys, plan.spec)
+	if err != nil {
+		return nil, err
+	}
+	if plan.sendMax != nil {
+		feeInfo = plan.sendMax
+	}
+
+	return &FeeEstimate{
+		FeeInfo:       *feeInfo,
+		SelectedUtxos: plan.spec.utxos,
+		UnusedUtxos:   plan.unused,
+	}, nil
+}
@@ -0,0 +1,76 @@
+package adapters
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEstimateFee_PublicKeysOnly(t *testing.T) {
+	net := &chaincfg.TestNet4Params
+	a := NewBtcAdapter(net)
+
+	wallet, err := a.DeriveWallet()
+	require.NoError(t, err)
+	ownScript := accountChildScript(t, wallet.Account, "v0_p2wpkh", 0, 0)
+	otherScript := accountChildScript(t, wallet.Account, "v1_p2tr", 0, 4)
+	payload := func(changeType string) string {
+		return mustJSON(t, BtcPayload{
+			Recipient:  "tb1qpn5dddjnc2qwurpsm449l6uvggnjxwsetrnksx",
+			Amount:     150000,
+			FeeRate:    2,
+			ChangeType: changeType,
+			Utxos: []UTXO{
+				{Txid: strings.Repeat("a", 64), Value: 100000, ScriptPubKey: hex.EncodeToString(ownScript), ScriptPubKeyType: "v0_p2wpkh"},
+				{Txid: strings.Repeat("b", 64), Value: 100000, ScriptPubKey: hex.EncodeToString(otherScript), ScriptPubKeyType: "v1_p2tr", Path: "0/4"},
+			},
+		})
+	}
+
+	// The private keys of the wallet entry cannot be decoded, so only the
+	// public keys can have been used.
+	sealed := *wallet
+	sealed.PrivateKey = "not a WIF"
+	sealed.AccountKey = "not an extended key"
+
+	for _, changeType := range []string{"", "p2tr"} {
+		want, err := a.EstimateFee(wallet, payload(changeType))
+		require.NoError(t, err)
+		got, err := a.EstimateFee(&sealed, payload(changeType))
+		require.NoError(t, err, changeType)
+		require.Equal(t, want, got, changeType)
+
+		_, err = a.CreateSignedTransaction(&sealed, payload(changeType))
+		require.ErrorContains(t, err, "WIF", "signing needs the private key")
+	}
+	require.Zero(t, sealed.ChangeIndex, "estimates hand out no change key")
+
+	t.Run("Estimate for a path of a wallet without an account key - fail", func(t *testing.T) {
+		legacy := sealed
+		legacy.AccountKey = ""
+		_, err := a.EstimateFee(&legacy, payload(""))
+		require.ErrorContains(t, err, "only signs with its own key")
+	})
+
+	t.Run("Estimate for another network's account - fail", func(t *testing.T) {
+		mainnet := sealed
+		mainnet.Account = &HDAccount{Fingerprint: wallet.Account.Fingerprint, Path: wallet.Account.Path, ExtendedKey: "xpub661MyMwAqRbcFtXgS5sYJABqqG9YLmC4Q1Rdap9gSE8NqtwybGhePY2gZ29ESFjqJoCu1Rupje8YtGqsefD265TMg7usUDFdp6W1EGMcet8"}
+		_, err := a.EstimateFee(&mainnet, payload(""))
+		require.ErrorContains(t, err, "not a public key for testnet4")
+	})
+
+	t.Run("Wallets without an HD account estimate from the wallet key - pass", func(t *testing.T) {
+		legacy, wif := legacyBtcWallet(t, net)
+		estimate, err := a.EstimateFee(legacy, mustJSON(t, BtcPayload{
+			Recipient: "tb1qpn5dddjnc2qwurpsm449l6uvggnjxwsetrnksx",
+			Amount:    50000,
+			FeeRate:   1,
+			Utxos:     []UTXO{{Txid: strings.Repeat("c", 64), Value: 100000, ScriptPubKey: hex.EncodeToString(walletScripts(wif)["v0_p2wpkh"]), ScriptPubKeyType: "v0_p2wpkh"}},
+		}))
+		require.NoError(t, err)
+		require.Equal(t, 2, estimate.NumOutputs)
+	})
+}
@@ -3,32 +3,202 @@ package adapters
 import (
 	"fmt"
 
+	"github.com/btcsuite/btcd/mempool"
+	"github.com/btcsuite/btcd/wire"
 	"github.com/shopspring/decimal"
 )
 
-func calculateTransactionSize(numP2PKHInputs, numP2WPKHInputs, numP2PKHOutputs, numP2WPKHOutputs int) int {
-	inputSize := numP2PKHInputs*148 + numP2WPKHInputs*68
-	outputSize := numP2PKHOutputs*34 + numP2WPKHOutputs*31
-	overhead := 10
+// maxECDSASigSize is the largest low-S DER signature, 71 bytes, with its
+// sighash byte.
+const maxECDSASigSize = 72
 
-	// Add witness overhead if there are segwit inputs
-	if numP2WPKHInputs > 0 || numP2WPKHOutputs > 0 {
-		overhead += 1 // witness marker/flag amortized
+// BIP141 weights of the inputs the wallet can spend, keyed by UTXO script
+// type. Non-witness bytes weigh 4 units and witness bytes 1. ECDSA
+// signatures are counted at their 72 byte maximum including the sighash byte.
+// P2WSH and P2SH-P2WSH inputs depend on their witness script and are sized by
+// witnessScriptInputWeight.
+var inputWeights = map[string]int{
+	// outpoint 36, scriptSig 1+107 (sig and pubkey pushes), sequence 4
+	"p2pkh": 148 * 4,
+	// outpoint 36, scriptSig 1+23 (redeem script push), sequence 4,
+	// witness 1+73+34 (item count, sig and pubkey)
+	"p2sh_p2wpkh": 64*4 + 108,
+	// outpoint 36, empty scriptSig 1, sequence 4, witness 1+73+34
+	"v0_p2wpkh": 41*4 + 108,
+	// outpoint 36, empty scriptSig 1, sequence 4, witness 1+65 (schnorr sig)
+	"v1_p2tr": 41*4 + 66,
+}
+
+// unsignedInputWeight is the weight of an input with an empty scriptSig and
+// no witness: outpoint 36, scriptSig length 1 and sequence 4.
+const unsignedInputWeight = 41 * 4
+
+// witnessScriptInputWeight is the weight of an input spending a P2WSH output
+// with a witness of stack items of the given sizes followed by
+// witnessScript. A P2SH-P2WSH input also pushes its redeem script, the
+// P2WSH witness program, in its scriptSig.
+func witnessScriptInputWeight(witnessScript, redeemScript []byte, stackItems ...int) int {
+	weight := unsignedInputWeight
+	if len(redeemScript) > 0 {
+		weight += (1 + len(redeemScript)) * 4
 	}
+	weight += varIntSize(len(stackItems) + 1)
+	for _, size := range append(stackItems, len(witnessScript)) {
+		weight += varIntSize(size) + size
+	}
+	return weight
+}
 
-	return inputSize + outputSize + overhead
+// multisigInputWeight is the weight of an input spending a threshold-of-N
+// CHECKMULTISIG witness script once finalized: a witness of the empty
+// CHECKMULTISIG dummy, threshold signatures of at most 72 bytes and the
+// witness script, and the redeem script push of a nested multisig.
+func multisigInputWeight(threshold int, witnessScript, redeemScript []byte) int {
+	stackItems := make([]int, 1+threshold)
+	for i := range threshold {
+		stackItems[1+i] = maxECDSASigSize
+	}
+	return witnessScriptInputWeight(witnessScript, redeemScript, stackItems...)
 }
 
-func countInputsByType(inputTypes []string) (p2pkh, p2wpkh int) {
-	for _, inputType := range inputTypes {
-		switch inputType {
-		case "p2pkh":
-			p2pkh++
-		case "v0_p2wpkh":
-			p2wpkh++
+// scriptPubKey lengths of the outputs the wallet can pay to, keyed by
+// address type.
+var outputScriptSizes = map[string]int{
+	"p2pkh":  25,
+	"p2sh":   23,
+	"p2wpkh": 22,
+	"p2wsh":  34,
+	"p2tr":   34,
+}
+
+// Weights of the transaction fields outside inputs and outputs: version and
+// locktime, and the segwit marker and flag.
+const (
+	txOverheadWeight = (4 + 4) * 4
+	segwitWeight     = 2
+)
+
+// varIntSize is the serialized size of a compact size integer.
+func varIntSize(n int) int {
+	switch {
+	case n < 0xfd:
+		return 1
+	case n <= 0xffff:
+		return 3
+	default:
+		return 5
+	}
+}
+
+// outputWeight is the weight of an output with a script of scriptLen bytes:
+// value 8, script length and script.
+func outputWeight(scriptLen int) int {
+	return (8 + varIntSize(scriptLen) + scriptLen) * 4
+}
+
+// nullDataScriptSize is the length of an OP_RETURN script carrying dataLen
+// bytes in a single push.
+func nullDataScriptSize(dataLen int) int {
+	switch {
+	case dataLen <= 75:
+		return 1 + 1 + dataLen
+	case dataLen <= 255:
+		return 1 + 2 + dataLen
+	default:
+		return 1 + 3 + dataLen
+	}
+}
+
+// calculateTransactionWeight returns the weight of a transaction spending
+// inputTypes into outputs with the given script lengths. Legacy inputs of a
+// segwit transaction carry an empty witness.
+func calculateTransactionWeight(inputTypes []string, outputScriptLens []int) int {
+	weights := make([]int, len(inputTypes))
+	legacyInputs := 0
+	for i, inputType := range inputTypes {
+		weights[i] = inputWeights[inputType]
+		if inputType == "p2pkh" {
+			legacyInputs++
 		}
 	}
-	return p2pkh, p2wpkh
+	return transactionWeight(weights, legacyInputs, outputScriptLens)
+}
+
+// transactionWeight returns the weight of a transaction with inputs of the
+// given signed weights, legacyInputs of them without a witness, and outputs
+// with scripts of outputScriptLens bytes.
+func transactionWeight(inputWeights []int, legacyInputs int, outputScriptLens []int) int {
+	weight := txOverheadWeight + (varIntSize(len(inputWeights))+varIntSize(len(outputScriptLens)))*4
+	for _, inputWeight := range inputWeights {
+		weight += inputWeight
+	}
+	if legacyInputs < len(inputWeights) {
+		weight += segwitWeight + legacyInputs
+	}
+
+	for _, scriptLen := range outputScriptLens {
+		weight += outputWeight(scriptLen)
+	}
+	return weight
+}
+
+// calculateTransactionSize returns the virtual size in vbytes of a
+// transaction spending inputTypes into outputTypes and OP_RETURN outputs
+// carrying nullDataSizes bytes.
+func calculateTransactionSize(inputTypes, outputTypes []string, nullDataSizes []int) int {
+	scriptLens := make([]int, 0, len(outputTypes)+len(nullDataSizes))
+	for _, outputType := range outputTypes {
+		scriptLens = append(scriptLens, outputScriptSizes[outputType])
+	}
+	for _, dataLen := range nullDataSizes {
+		scriptLens = append(scriptLens, nullDataScriptSize(dataLen))
+	}
+	return weightToVSize(calculateTransactionWeight(inputTypes, scriptLens))
+}
+
+// weightToVSize converts weight units to vbytes, rounding up.
+func weightToVSize(weight int) int {
+	return (weight + 3) / 4
+}
+
+// feeForSize returns the fee in satoshis for size vbytes at feeRate sat/vbyte.
+func feeForSize(feeRate float64, size int) int64 {
+	return decimal.NewFromFloat(feeRate).Mul(decimal.NewFromInt(int64(size))).Round(0).IntPart()
+}
+
+// dustThreshold is the smallest change, in satoshis, that is created: the
+// dust limit of a P2PKH output, the highest of the standard outputs, so
+// change of any type is above its own limit. Change below it is added to the
+// fee.
+const dustThreshold = 546
+
+// dustLimit is the smallest value of an output paying pkScript that nodes
+// relay, as they compute it at the default minimum relay fee: 546 sats for
+// P2PKH, 540 for P2SH, 294 for P2WPKH and 330 for P2WSH and P2TR outputs.
+func dustLimit(pkScript []byte) int64 {
+	return mempool.GetDustThreshold(&wire.TxOut{PkScript: pkScript})
+}
+
+// FeeParams describes the transaction CalculateFee sizes.
+type FeeParams struct {
+	InputTypes  []string // UTXO script types of the inputs
+	OutputTypes []string // address types of the payment outputs
+	// NullDataSizes are the data lengths of OP_RETURN outputs, which carry
+	// no value and are never change.
+	NullDataSizes []int
+	ChangeType    string  // address type of the change output, if one is added
+	Amount        int64   // sum of the payment outputs
+	TotalInput    int64   // sum of the inputs
+	FeeRate       float64 // sat/vbyte
+	// SendMax sizes a single payment of everything the inputs hold less the
+	// fee, with no change. Amount and ChangeType are ignored.
+	SendMax bool
+	// AbsoluteFee, when set, is the fee paid whatever the size, instead of
+	// FeeRate per vbyte.
+	AbsoluteFee int64
+	// SubtractFee takes the fee out of the payment outputs instead of adding
+	// it to Amount, so all of TotalInput beyond Amount is change.
+	SubtractFee bool
 }
 
 type FeeInfo struct {
@@ -36,33 +206,68 @@ type FeeInfo struct {
 	ChangeValue  int64
 	NumOutputs   int
 	TxSize       int
+	DustAbsorbed bool // change too small for an output was added to the fee
+	// SendAmount is what a SendMax payment pays. It may be below dust, or
+	// negative when the inputs do not cover the fee; callers check it.
+	SendAmount int64
+	// Subtracted is the part of the fee a SubtractFee transaction takes out
+	// of its payment outputs. Dust change is given back to the payments by
+	// subtracting less.
+	Subtracted int64
 }
 
-/*
-README: calculate FEE ASSUMES CHAIN ADDRESS IS v0_p2wpkh
-so if there is change the numP2WPKHOutputs increases by 1 thus affecting the gas cost
-*/
-func CalculateFee(destType string, inputTypes []string, amount, totalInputValue int64, feeRate float64) (*FeeInfo, error) {
-	const dustThreshold = 546
-
-	// Count inputs
-	numP2PKHInputs, numP2WPKHInputs := countInputsByType(inputTypes)
+// CalculateFee sizes a transaction paying params.OutputTypes from
+// params.InputTypes, adding a change output when the change is above dust.
+func CalculateFee(params FeeParams) (*FeeInfo, error) {
+	inputTypes, amount, totalInputValue, feeRate := params.InputTypes, params.Amount, params.TotalInput, params.FeeRate
 
-	// Set destination output
-	numP2PKHOutputs := 0
-	numP2WPKHOutputs := 1
-	if destType == "p2pkh" {
-		numP2PKHOutputs = 1
-		numP2WPKHOutputs = 0
+	if len(params.OutputTypes) == 0 && len(params.NullDataSizes) == 0 {
+		return nil, fmt.Errorf("at least one output is required")
 	}
+	for _, inputType := range inputTypes {
+		if _, ok := inputWeights[inputType]; !ok {
+			return nil, fmt.Errorf("unsupported input type: %s", inputType)
+		}
+	}
+	withChange := append(append([]string{}, params.OutputTypes...), params.ChangeType)
+	if params.SendMax {
+		if len(params.OutputTypes) != 1 {
+			return nil, fmt.Errorf("send max needs exactly one payment output")
+		}
+		withChange = params.OutputTypes
+	}
+	for _, outputType := range withChange {
+		if _, ok := outputScriptSizes[outputType]; !ok {
+			return nil, fmt.Errorf("unsupported output type: %s", outputType)
+		}
+	}
+	numOutputs := len(params.OutputTypes) + len(params.NullDataSizes)
 
 	// Step 1: Calculate transaction size without change
-	txSizeNoChange := calculateTransactionSize(numP2PKHInputs, numP2WPKHInputs, numP2PKHOutputs, numP2WPKHOutputs)
-	estimatedFeeNoChange := decimal.NewFromFloat(feeRate).Mul(decimal.NewFromInt(int64(txSizeNoChange))).Round(0).IntPart()
+	feeFor := func(size int) int64 {
+		if params.AbsoluteFee != 0 {
+			return params.AbsoluteFee
+		}
+		return feeForSize(feeRate, size)
+	}
+	txSizeNoChange := calculateTransactionSize(inputTypes, params.OutputTypes, params.NullDataSizes)
+	estimatedFeeNoChange := feeFor(txSizeNoChange)
+
+	if params.SendMax {
+		return &FeeInfo{
+			EstimatedFee: estimatedFeeNoChange,
+			NumOutputs:   numOutputs,
+			TxSize:       txSizeNoChange,
+			SendAmount:   totalInputValue - estimatedFeeNoChange,
+		}, nil
+	}
+	if params.SubtractFee {
+		return subtractedFee(params, withChange, txSizeNoChange, feeFor)
+	}
 
 	// Check for insufficient funds
 	if totalInputValue < amount+estimatedFeeNoChange {
-		return nil, fmt.Errorf("insufficient funds. Total: %d, Amount: %d, Fee: %d", totalInputValue, amount, estimatedFeeNoChange)
+		return nil, invalidField("utxos", "insufficient funds. Total: %d, Amount: %d, Fee: %d", totalInputValue, amount, estimatedFeeNoChange)
 	}
 
 	// Calculate potential change without change output
@@ -73,7 +278,7 @@ func CalculateFee(destType string, inputTypes []string, amount, totalInputValue
 		return &FeeInfo{
 			EstimatedFee: estimatedFeeNoChange,
 			ChangeValue:  0,
-			NumOutputs:   1, // Only destination
+			NumOutputs:   numOutputs, // Only destinations
 			TxSize:       txSizeNoChange,
 		}, nil
 	}
@@ -84,15 +289,16 @@ func CalculateFee(destType string, inputTypes []string, amount, totalInputValue
 		return &FeeInfo{
 			EstimatedFee: finalFee,
 			ChangeValue:  0,
-			NumOutputs:   1, // Only destination
+			NumOutputs:   numOutputs, // Only destinations
 			TxSize:       txSizeNoChange,
+			DustAbsorbed: true,
 		}, nil
 	}
 
 	// Step 4: Try with change output if change is sufficient
 	if changeValue >= dustThreshold {
-		txSizeWithChange := calculateTransactionSize(numP2PKHInputs, numP2WPKHInputs, numP2PKHOutputs, numP2WPKHOutputs+1)
-		estimatedFeeWithChange := decimal.NewFromFloat(feeRate).Mul(decimal.NewFromInt(int64(txSizeWithChange))).Round(0).IntPart()
+		txSizeWithChange := calculateTransactionSize(inputTypes, withChange, params.NullDataSizes)
+		estimatedFeeWithChange := feeFor(txSizeWithChange)
 		// Check if funds are sufficient with change
 		if totalInputValue >= amount+estimatedFeeWithChange {
 			newChangeValue := totalInputValue - amount - estimatedFeeWithChange
@@ -100,7 +306,7 @@ func CalculateFee(destType string, inputTypes []string, amount, totalInputValue
 				return &FeeInfo{
 					EstimatedFee: estimatedFeeWithChange,
 					ChangeValue:  newChangeValue,
-					NumOutputs:   2, // Destination + change
+					NumOutputs:   numOutputs + 1, // Destinations + change
 					TxSize:       txSizeWithChange,
 				}, nil
 			}
@@ -109,6 +315,7 @@ func CalculateFee(destType string, inputTypes []string, amount, totalInputValue
 
 	// Step 5: No change output (insufficient funds for change or dust)
 	finalFee := estimatedFeeNoChange
+	dustAbsorbed := changeValue > 0
 	if changeValue > 0 {
 		finalFee += changeValue
 		changeValue = 0
@@ -117,7 +324,41 @@ func CalculateFee(destType string, inputTypes []string, amount, totalInputValue
 	return &FeeInfo{
 		EstimatedFee: finalFee,
 		ChangeValue:  changeValue,
-		NumOutputs:   1, // Only destination
+		NumOutputs:   numOutputs, // Only destinations
+		TxSize:       txSizeNoChange,
+		DustAbsorbed: dustAbsorbed,
+	}, nil
+}
+
+// subtractedFee sizes a SubtractFee transaction. The payments pay the fee, so
+// everything beyond Amount is change; change below dust is dropped and the
+// payments pay that much less of the fee.
+func subtractedFee(params FeeParams, withChange []string, txSizeNoChange int, feeFor func(int) int64) (*FeeInfo, error) {
+	if params.TotalInput < params.Amount {
+		return nil, invalidField("utxos", "insufficient funds. Total: %d, Amount: %d", params.TotalInput, params.Amount)
+	}
+	numOutputs := len(params.OutputTypes) + len(params.NullDataSizes)
+	changeValue := params.TotalInput - params.Amount
+
+	if changeValue >= dustThreshold {
+		txSize := calculateTransactionSize(params.InputTypes, withChange, params.NullDataSizes)
+		fee := feeFor(txSize)
+		return &FeeInfo{
+			EstimatedFee: fee,
+			ChangeValue:  changeValue,
+			NumOutputs:   numOutputs + 1,
+			TxSize:       txSize,
+			Subtracted:   fee,
+		}, nil
+	}
+
+	fee := feeFor(txSizeNoChange)
+	subtracted := max(fee-changeValue, 0)
+	return &FeeInfo{
+		EstimatedFee: subtracted + changeValue,
+		NumOutputs:   numOutputs,
 		TxSize:       txSizeNoChange,
+		DustAbsorbed: changeValue > 0,
+		Subtracted:   subtracted,
 	}, nil
 }
@@ -1,7 +1,20 @@
 package adapters
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
 	"testing"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/btcec/v2/ecdsa"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/mempool"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/stretchr/testify/require"
 )
 
 // Test case structure
@@ -10,8 +23,9 @@ type TestCase struct {
 	TotalInput      int64
 	Amount          int64
 	FeeRate         float64
-	InputTypes      []string // "p2pkh" or "v0_p2wpkh"
-	DestinationType string   // "p2pkh" or "p2wpkh"
+	InputTypes      []string // "p2pkh", "v0_p2wpkh", "v1_p2tr" or "p2sh_p2wpkh"
+	DestinationType string   // "p2pkh", "p2wpkh", "p2wsh", "p2tr" or "p2sh"
+	ChangeType      string   // defaults to "p2wpkh"
 
 	// Expected results
 	ExpectedFee     int64
@@ -30,10 +44,10 @@ var testCases = []TestCase{
 		InputTypes:      []string{"p2pkh"},
 		DestinationType: "p2pkh",
 
-		ExpectedFee:     224,   // (148 + 34 + 31 + 11) * 1 = 224 (P2PKH input + P2PKH dest + P2WPKH change + segwit overhead)
-		ExpectedChange:  49776, // 100000 - 50000 - 224 = 49776
+		ExpectedFee:     223,   // (10 + 148 + 34 + 31) * 1 = 223 (overhead + P2PKH input + P2PKH dest + P2WPKH change, no witness)
+		ExpectedChange:  49777, // 100000 - 50000 - 223 = 49777
 		ExpectedOutputs: 2,
-		ExpectedTxSize:  224,
+		ExpectedTxSize:  223,
 	},
 
 	{
@@ -44,10 +58,10 @@ var testCases = []TestCase{
 		InputTypes:      []string{"p2pkh"},
 		DestinationType: "p2wpkh",
 
-		ExpectedFee:     221,   // (148 + 31 + 31 + 11) * 1 = 221
-		ExpectedChange:  49779, // 100000 - 50000 - 221 = 49779
+		ExpectedFee:     220,   // (10 + 148 + 31 + 31) * 1 = 220
+		ExpectedChange:  49780, // 100000 - 50000 - 220 = 49780
 		ExpectedOutputs: 2,
-		ExpectedTxSize:  221,
+		ExpectedTxSize:  220,
 	},
 
 	{
@@ -58,7 +72,7 @@ var testCases = []TestCase{
 		InputTypes:      []string{"v0_p2wpkh"},
 		DestinationType: "p2wpkh",
 
-		ExpectedFee:     141,   // (68 + 31 + 31 + 11) * 1 = 141
+		ExpectedFee:     141,   // 562 WU = 40 + 2 + 272 + 124 + 124, ceil(562 / 4) = 141
 		ExpectedChange:  49859, // 100000 - 50000 - 141 = 49859
 		ExpectedOutputs: 2,
 		ExpectedTxSize:  141,
@@ -72,10 +86,10 @@ var testCases = []TestCase{
 		InputTypes:      []string{"p2pkh", "p2pkh"},
 		DestinationType: "p2wpkh",
 
-		ExpectedFee:     369,   // (148*2 + 31 + 31 + 11) * 1 = 369
-		ExpectedChange:  49631, // 100000 - 50000 - 369 = 49631
+		ExpectedFee:     368,   // (10 + 148*2 + 31 + 31) * 1 = 368
+		ExpectedChange:  49632, // 100000 - 50000 - 368 = 49632
 		ExpectedOutputs: 2,
-		ExpectedTxSize:  369,
+		ExpectedTxSize:  368,
 	},
 
 	{
@@ -86,7 +100,7 @@ var testCases = []TestCase{
 		InputTypes:      []string{"p2pkh", "v0_p2wpkh"},
 		DestinationType: "p2wpkh",
 
-		ExpectedFee:     289,   // (148 + 68 + 31 + 31 + 11) * 1 = 289
+		ExpectedFee:     289,   // 1155 WU = 40 + 2 + (592 + 1) + 272 + 124 + 124, the P2PKH input has an empty witness
 		ExpectedChange:  49711, // 100000 - 50000 - 289 = 49711
 		ExpectedOutputs: 2,
 		ExpectedTxSize:  289,
@@ -94,30 +108,30 @@ var testCases = []TestCase{
 
 	{
 		Name:            "Change exactly at dust threshold",
-		TotalInput:      50767, // Calculated to make change exactly 546
+		TotalInput:      50766, // Calculated to make change exactly 546
 		Amount:          50000,
 		FeeRate:         1,
 		InputTypes:      []string{"p2pkh"},
 		DestinationType: "p2wpkh",
 
-		ExpectedFee:     221, // (148 + 31 + 31 + 11) * 1 = 221
-		ExpectedChange:  546, // 50767 - 50000 - 221 = 546 (exactly dust threshold)
+		ExpectedFee:     220, // (10 + 148 + 31 + 31) * 1 = 220
+		ExpectedChange:  546, // 50766 - 50000 - 220 = 546 (exactly dust threshold)
 		ExpectedOutputs: 2,
-		ExpectedTxSize:  221,
+		ExpectedTxSize:  220,
 	},
 
 	{
 		Name:            "Change just below dust threshold - becomes fee",
-		TotalInput:      50766, // One sat less than above
+		TotalInput:      50765, // One sat less than above
 		Amount:          50000,
 		FeeRate:         1,
 		InputTypes:      []string{"p2pkh"},
 		DestinationType: "p2wpkh",
 
-		ExpectedFee:     766, // Base: (148 + 31 + 11) * 1 = 190, plus dust: 50766 - 50000 - 221 = 545, total = 190 + 545 = 735 (but since 545 < 546, no change output, fee = 766)
+		ExpectedFee:     765, // Base: (10 + 148 + 31) * 1 = 189, change after a change output would be 545 < 546, so 50765 - 50000 - 189 = 576 is added, fee = 765
 		ExpectedChange:  0,   // No change output
 		ExpectedOutputs: 1,
-		ExpectedTxSize:  190, // Without change output
+		ExpectedTxSize:  189, // Without change output
 	},
 
 	{
@@ -128,24 +142,24 @@ var testCases = []TestCase{
 		InputTypes:      []string{"p2pkh"},
 		DestinationType: "p2wpkh",
 
-		ExpectedFee:     500, // Base: (148 + 31 + 11) * 1 = 190, dust: 50500 - 50000 - 190 = 310, total = 500
+		ExpectedFee:     500, // Base: (10 + 148 + 31) * 1 = 189, dust: 50500 - 50000 - 189 = 311, total = 500
 		ExpectedChange:  0,
 		ExpectedOutputs: 1,
-		ExpectedTxSize:  190,
+		ExpectedTxSize:  189,
 	},
 
 	{
 		Name:            "Exact amount - no change",
-		TotalInput:      50190, // Exactly amount + fee
+		TotalInput:      50189, // Exactly amount + fee
 		Amount:          50000,
 		FeeRate:         1,
 		InputTypes:      []string{"p2pkh"},
 		DestinationType: "p2wpkh",
 
-		ExpectedFee:     190, // (148 + 31 + 11) * 1 = 190
+		ExpectedFee:     189, // (10 + 148 + 31) * 1 = 189
 		ExpectedChange:  0,
 		ExpectedOutputs: 1,
-		ExpectedTxSize:  190,
+		ExpectedTxSize:  189,
 	},
 
 	{
@@ -156,10 +170,10 @@ var testCases = []TestCase{
 		InputTypes:      []string{"p2pkh"},
 		DestinationType: "p2wpkh",
 
-		ExpectedFee:     2210,  // (148 + 31 + 31 + 11) * 10 = 2210
-		ExpectedChange:  47790, // 100000 - 50000 - 2210 = 47790
+		ExpectedFee:     2200,  // (10 + 148 + 31 + 31) * 10 = 2200
+		ExpectedChange:  47800, // 100000 - 50000 - 2200 = 47800
 		ExpectedOutputs: 2,
-		ExpectedTxSize:  221,
+		ExpectedTxSize:  220,
 	},
 
 	{
@@ -170,7 +184,7 @@ var testCases = []TestCase{
 		InputTypes:      []string{"v0_p2wpkh"},
 		DestinationType: "p2wpkh",
 
-		ExpectedFee:     141, // (68 + 31 + 31 + 11) * 1 = 141
+		ExpectedFee:     141, // ceil(562 / 4) = 141
 		ExpectedChange:  546, // 50687 - 50000 - 141 = 546
 		ExpectedOutputs: 2,
 		ExpectedTxSize:  141,
@@ -184,12 +198,56 @@ var testCases = []TestCase{
 		InputTypes:      []string{"v0_p2wpkh"},
 		DestinationType: "p2wpkh",
 
-		ExpectedFee:     686, // Base: (68 + 31 + 11) * 1 = 110, dust: 50686 - 50000 - 141 = 545, total = 110 + 545 = 655 (but since 545 < 546, no change output, fee = 686)
+		ExpectedFee:     686, // Base: ceil(438 / 4) = 110, change after a change output would be 545 < 546, so 50686 - 50000 - 110 = 576 is added, fee = 686
 		ExpectedChange:  0,
 		ExpectedOutputs: 1,
 		ExpectedTxSize:  110,
 	},
 
+	{
+		Name:            "P2TR to P2TR with change",
+		TotalInput:      100000,
+		Amount:          50000,
+		FeeRate:         1,
+		InputTypes:      []string{"v1_p2tr"},
+		DestinationType: "p2tr",
+		ChangeType:      "p2tr",
+
+		ExpectedFee:     154,   // 616 WU = 40 + 2 + 230 + 172 + 172, 616 / 4 = 154
+		ExpectedChange:  49846, // 100000 - 50000 - 154 = 49846
+		ExpectedOutputs: 2,
+		ExpectedTxSize:  154,
+	},
+
+	{
+		Name:            "Mixed inputs (P2WPKH + P2TR) to P2WPKH with P2TR change",
+		TotalInput:      100000,
+		Amount:          50000,
+		FeeRate:         2,
+		InputTypes:      []string{"v0_p2wpkh", "v1_p2tr"},
+		DestinationType: "p2wpkh",
+		ChangeType:      "p2tr",
+
+		ExpectedFee:     420,   // 840 WU = 40 + 2 + 272 + 230 + 124 + 172, 840 / 4 * 2 = 420
+		ExpectedChange:  49580, // 100000 - 50000 - 420 = 49580
+		ExpectedOutputs: 2,
+		ExpectedTxSize:  210,
+	},
+
+	{
+		Name:            "P2SH-P2WPKH to P2SH with change",
+		TotalInput:      100000,
+		Amount:          50000,
+		FeeRate:         1,
+		InputTypes:      []string{"p2sh_p2wpkh"},
+		DestinationType: "p2sh",
+
+		ExpectedFee:     165,   // 658 WU = 40 + 2 + 364 + 128 + 124, ceil(658 / 4) = 165
+		ExpectedChange:  49835, // 100000 - 50000 - 165 = 49835
+		ExpectedOutputs: 2,
+		ExpectedTxSize:  165,
+	},
+
 	{
 		Name:            "Insufficient funds",
 		TotalInput:      1000,
@@ -210,7 +268,18 @@ func TestFeeCalculationCases(t *testing.T) {
 	for i, tc := range testCases {
 		t.Run(tc.Name, func(t *testing.T) {
 
-			feeInfo, err := CalculateFee(tc.DestinationType, tc.InputTypes, tc.Amount, tc.TotalInput, tc.FeeRate)
+			changeType := tc.ChangeType
+			if changeType == "" {
+				changeType = "p2wpkh"
+			}
+			feeInfo, err := CalculateFee(FeeParams{
+				InputTypes:  tc.InputTypes,
+				OutputTypes: []string{tc.DestinationType},
+				ChangeType:  changeType,
+				Amount:      tc.Amount,
+				TotalInput:  tc.TotalInput,
+				FeeRate:     tc.FeeRate,
+			})
 			if err != nil && !tc.ExpectError {
 				t.Errorf("Test %d (%s): unexpected error: %v", i+1, tc.Name, err)
 				return
@@ -248,3 +317,220 @@ func TestFeeCalculationCases(t *testing.T) {
 		})
 	}
 }
+
+func TestCalculateFee_FeeModes(t *testing.T) {
+	inputs := []string{"v0_p2wpkh"}
+	outputs := []string{"p2wpkh"}
+	sizeNoChange := calculateTransactionSize(inputs, outputs, nil)
+	sizeWithChange := calculateTransactionSize(inputs, []string{"p2wpkh", "p2wpkh"}, nil)
+	params := func(totalInput int64, feeRate float64, absoluteFee int64, subtract bool) FeeParams {
+		return FeeParams{
+			InputTypes:  inputs,
+			OutputTypes: outputs,
+			ChangeType:  "p2wpkh",
+			Amount:      50000,
+			TotalInput:  totalInput,
+			FeeRate:     feeRate,
+			AbsoluteFee: absoluteFee,
+			SubtractFee: subtract,
+		}
+	}
+
+	t.Run("Subtract fee with change - pass", func(t *testing.T) {
+		feeInfo, err := CalculateFee(params(100000, 2, 0, true))
+		require.NoError(t, err)
+		require.Equal(t, int64(2*sizeWithChange), feeInfo.EstimatedFee)
+		require.Equal(t, feeInfo.EstimatedFee, feeInfo.Subtracted)
+		require.Equal(t, int64(50000), feeInfo.ChangeValue, "the wallet keeps everything beyond the amount")
+		require.Equal(t, 2, feeInfo.NumOutputs)
+	})
+
+	t.Run("Subtract fee with dust change - pass", func(t *testing.T) {
+		feeInfo, err := CalculateFee(params(50300, 5, 0, true))
+		require.NoError(t, err)
+		require.Equal(t, int64(5*sizeNoChange), feeInfo.EstimatedFee)
+		require.Equal(t, int64(5*sizeNoChange-300), feeInfo.Subtracted, "the dust change pays part of the fee")
+		require.Equal(t, int64(0), feeInfo.ChangeValue)
+		require.True(t, feeInfo.DustAbsorbed)
+
+		feeInfo, err = CalculateFee(params(50500, 1, 0, true))
+		require.NoError(t, err)
+		require.Equal(t, int64(500), feeInfo.EstimatedFee, "dust above the fee is not given back")
+		require.Equal(t, int64(0), feeInfo.Subtracted)
+	})
+
+	t.Run("Subtract fee insufficient funds - fail", func(t *testing.T) {
+		_, err := CalculateFee(params(49999, 1, 0, true))
+		require.ErrorContains(t, err, "insufficient funds")
+	})
+
+	t.Run("Absolute fee - pass", func(t *testing.T) {
+		feeInfo, err := CalculateFee(params(100000, 0, 1234, false))
+		require.NoError(t, err)
+		require.Equal(t, int64(1234), feeInfo.EstimatedFee)
+		require.Equal(t, int64(100000-50000-1234), feeInfo.ChangeValue)
+		require.Equal(t, sizeWithChange, feeInfo.TxSize)
+
+		feeInfo, err = CalculateFee(params(100000, 0, 1234, true))
+		require.NoError(t, err)
+		require.Equal(t, int64(1234), feeInfo.Subtracted)
+		require.Equal(t, int64(50000), feeInfo.ChangeValue)
+	})
+}
+
+// sigShortfall returns the weight by which the ECDSA signatures of tx fall
+// short of the 72 bytes the estimator counts them at. Low-S signatures are 71
+// or 72 bytes with the sighash byte, and only rarely shorter.
+func sigShortfall(tx *wire.MsgTx) int {
+	isSig := func(data []byte) bool {
+		if len(data) < 2 {
+			return false
+		}
+		_, err := ecdsa.ParseDERSignature(data[:len(data)-1])
+		return err == nil
+	}
+	shortfall := 0
+	for _, txIn := range tx.TxIn {
+		pushes, err := txscript.PushedData(txIn.SignatureScript)
+		if err != nil {
+			panic(err)
+		}
+		for _, push := range pushes {
+			if isSig(push) {
+				shortfall += (maxECDSASigSize - len(push)) * 4
+			}
+		}
+		for _, item := range txIn.Witness {
+			if isSig(item) {
+				shortfall += maxECDSASigSize - len(item)
+			}
+		}
+	}
+	return shortfall
+}
+
+// requireEstimatedWeight checks the estimated weight of tx against its real
+// weight: they differ by exactly the bytes its signatures fall short of their
+// maximum, and the estimated virtual size is never below the real one.
+func requireEstimatedWeight(t *testing.T, estimated int, tx *wire.MsgTx) {
+	t.Helper()
+	actual := int(blockchain.GetTransactionWeight(btcutil.NewTx(tx)))
+	require.Equal(t, estimated, actual+sigShortfall(tx))
+	require.GreaterOrEqual(t, weightToVSize(estimated), int(mempool.GetTxVirtualSize(btcutil.NewTx(tx))))
+}
+
+// TestEstimatedSizeMatchesSignedTx signs transactions of every input and
+// output type and checks the estimated weight against the real one, allowing
+// only for signatures shorter than their maximum.
+func TestEstimatedSizeMatchesSignedTx(t *testing.T) {
+	net := &chaincfg.TestNet4Params
+	a := NewBtcAdapter(net)
+
+	wallet, err := a.DeriveWallet()
+	require.NoError(t, err)
+	wif, err := btcutil.DecodeWIF(wallet.PrivateKey)
+	require.NoError(t, err)
+	scripts := walletScripts(wif)
+
+	witnessScriptHash := sha256.Sum256([]byte("estimator"))
+	p2wsh, err := btcutil.NewAddressWitnessScriptHash(witnessScriptHash[:], net)
+	require.NoError(t, err)
+	destinations := map[string]string{
+		"p2wpkh": "tb1qpn5dddjnc2qwurpsm449l6uvggnjxwsetrnksx",
+		"p2sh":   "2N3oefVeg6stiTb5Kh3ozCSkaqmx91FDbsm",
+		"p2wsh":  p2wsh.EncodeAddress(),
+	}
+	p2tr, err := walletAddress(wif, AddressTypeP2TR, net)
+	require.NoError(t, err)
+	destinations["p2tr"] = p2tr.EncodeAddress()
+	p2pkh, err := btcutil.NewAddressPubKeyHash(btcutil.Hash160(wif.PrivKey.PubKey().SerializeCompressed()), net)
+	require.NoError(t, err)
+	destinations["p2pkh"] = p2pkh.EncodeAddress()
+
+	cases := []struct {
+		InputTypes  []string
+		AddressType string // wallet address type receiving change
+	}{
+		{[]string{"p2pkh"}, AddressTypeP2WPKH},
+		{[]string{"v0_p2wpkh"}, AddressTypeP2WPKH},
+		{[]string{"p2sh_p2wpkh"}, AddressTypeP2SHP2WPKH},
+		{[]string{"v1_p2tr"}, AddressTypeP2TR},
+		{[]string{"p2pkh", "p2pkh", "p2pkh"}, AddressTypeP2WPKH},
+		{[]string{"p2pkh", "v0_p2wpkh", "p2sh_p2wpkh", "v1_p2tr"}, AddressTypeP2TR},
+	}
+
+	for _, tc := range cases {
+		for destType, destination := range destinations {
+			t.Run(fmt.Sprintf("%v to %s - pass", tc.InputTypes, destType), func(t *testing.T) {
+				utxos := make([]UTXO, len(tc.InputTypes))
+				for i, inputType := range tc.InputTypes {
+					utxos[i] = UTXO{
+						Txid:             "5555555555555555555555555555555555555555555555555555555555555555",
+						Vout:             uint32(i),
+						Value:            100000,
+						ScriptPubKey:     hex.EncodeToString(scripts[inputType]),
+						ScriptPubKeyType: inputType,
+					}
+				}
+				tx, err := a.NewTxWithInputsAndOutputs(wif, tc.AddressType, []BtcOutput{{Address: destination, Amount: 50000}}, utxos, 1)
+				require.NoError(t, err)
+				require.Len(t, tx.TxOut, 2)
+
+				changeAddr, err := walletAddress(wif, tc.AddressType, net)
+				require.NoError(t, err)
+				changeType, err := a.getOutputType(changeAddr.EncodeAddress())
+				require.NoError(t, err)
+
+				estimated := calculateTransactionWeight(tc.InputTypes, []int{outputScriptSizes[destType], outputScriptSizes[changeType]})
+				requireEstimatedWeight(t, estimated, tx)
+				require.Equal(t, weightToVSize(estimated), calculateTransactionSize(tc.InputTypes, []string{destType, changeType}, nil))
+			})
+		}
+	}
+
+	for _, multisigType := range []string{MultisigTypeP2WSH, MultisigTypeP2SHP2WSH} {
+		t.Run(fmt.Sprintf("2-of-3 %s multisig - pass", multisigType), func(t *testing.T) {
+			cosigners := make([]*Wallet, 3)
+			for i := range cosigners {
+				cosigners[i], err = a.DeriveWallet()
+				require.NoError(t, err)
+			}
+			multisig, err := a.NewMultisig(2, cosigners, nil, multisigType)
+			require.NoError(t, err)
+			witnessScript, err := hex.DecodeString(multisig.WitnessScript)
+			require.NoError(t, err)
+			redeemScript, err := hex.DecodeString(multisig.RedeemScript)
+			require.NoError(t, err)
+
+			addr, err := btcutil.DecodeAddress(multisig.Address, net)
+			require.NoError(t, err)
+			pkScript, err := txscript.PayToAddrScript(addr)
+			require.NoError(t, err)
+			funding := fundingTx(pkScript, 80000)
+			packet := newTestPSBT(t, []*wire.MsgTx{funding}, 79000)
+			packet.Inputs[0].WitnessUtxo = funding.TxOut[0]
+			packet.Inputs[0].NonWitnessUtxo = funding
+			encoded, err := packet.B64Encode()
+			require.NoError(t, err)
+			result, err := a.SignMultisigPSBT(multisig, cosigners[0], encoded, false)
+			require.NoError(t, err)
+			result, err = a.SignMultisigPSBT(multisig, cosigners[1], result.PSBT, true)
+			require.NoError(t, err)
+			raw, err := hex.DecodeString(result.Tx)
+			require.NoError(t, err)
+			var tx wire.MsgTx
+			require.NoError(t, tx.Deserialize(bytes.NewReader(raw)))
+
+			estimated := transactionWeight([]int{multisigInputWeight(2, witnessScript, redeemScript)}, 0, []int{outputScriptSizes["p2wpkh"]})
+			requireEstimatedWeight(t, estimated, &tx)
+		})
+	}
+
+	t.Run("OP_RETURN outputs - pass", func(t *testing.T) {
+		for _, dataLen := range []int{0, 1, 75, 76, 80} {
+			script, err := txscript.NullDataScript(bytes.Repeat([]byte{0xaa}, dataLen))
+			require.NoError(t, err)
+			require.Equal(t, len(script), nullDataScriptSize(dataLen))
+		}
+	})
+}
@@ -0,0 +1,274 @@
+package adapters
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	btcec "github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/ecdsa"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/psbt"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// Message signature formats.
+const (
+	// MessageFormatBIP137 is the legacy "Bitcoin Signed Message" compact
+	// signature, for P2PKH, P2SH-P2WPKH and P2WPKH addresses.
+	MessageFormatBIP137 = "bip137"
+	// MessageFormatBIP322 is the BIP322 simple signature, for P2WPKH and P2TR
+	// addresses.
+	MessageFormatBIP322 = "bip322"
+)
+
+const bip137Magic = "Bitcoin Signed Message:\n"
+
+// bip137HeaderBases is the header byte of a BIP137 signature by a compressed
+// key with recovery id 0, by address type.
+var bip137HeaderBases = map[string]byte{
+	"p2pkh":       31,
+	"p2sh_p2wpkh": 35,
+	"p2wpkh":      39,
+}
+
+// SignMessage signs message with the wallet key to prove ownership of the
+// wallet address, returning the base64 signature and its format. An empty
+// format picks BIP322 for taproot addresses and BIP137 otherwise.
+func (a *btcAdapter) SignMessage(wallet *Wallet, message, format string) (string, string, error) {
+	wif, err := btcutil.DecodeWIF(wallet.PrivateKey)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to decode WIF: %w", err)
+	}
+	if !wif.IsForNet(a.net) {
+		return "", "", fmt.Errorf("wif network mismatch: wallet WIF not for %s", a.net.Name)
+	}
+	addr, addrType, err := a.messageAddress(wallet.PublicKey)
+	if err != nil {
+		return "", "", err
+	}
+	pkScript, err := txscript.PayToAddrScript(addr)
+	if err != nil {
+		return "", "", err
+	}
+	if _, ok := walletScripts(wif).match(pkScript); !ok {
+		return "", "", fmt.Errorf("wallet key does not match address %s", wallet.PublicKey)
+	}
+	format, err = messageFormat(format, addrType)
+	if err != nil {
+		return "", "", err
+	}
+
+	if format == MessageFormatBIP137 {
+		sig := ecdsa.SignCompact(wif.PrivKey, bip137Hash(message), true)
+		// SignCompact marks a compressed key with 31-34; BIP137 also encodes
+		// the address type in the header.
+		sig[0] = bip137HeaderBases[addrType] + sig[0] - 31
+		return base64.StdEncoding.EncodeToString(sig), format, nil
+	}
+
+	toSign, sigHashes, _ := bip322Txs(pkScript, message)
+	var witness wire.TxWitness
+	if addrType == "p2tr" {
+		sig, err := txscript.RawTxInTaprootSignature(toSign, sigHashes, 0, 0, pkScript, nil, txscript.SigHashDefault, wif.PrivKey)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to sign message: %w", err)
+		}
+		witness = wire.TxWitness{sig}
+	} else {
+		witness, err = txscript.WitnessSignature(toSign, sigHashes, 0, 0, pkScript, txscript.SigHashAll, wif.PrivKey, true)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to sign message: %w", err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := psbt.WriteTxWitness(&buf, witness); err != nil {
+		return "", "", err
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), format, nil
+}
+
+// VerifyMessage reports whether signature is a valid signature of message by
+// the key of address. Malformed input is an ErrInvalidPayload; a well formed
+// signature by another key is reported as invalid.
+func (a *btcAdapter) VerifyMessage(address, message, signature, format string) (bool, error) {
+	addr, addrType, err := a.messageAddress(address)
+	if err != nil {
+		return false, err
+	}
+	format, err = messageFormat(format, addrType)
+	if err != nil {
+		return false, err
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(signature))
+	if err != nil {
+		return false, invalidField("signature", "invalid base64: %v", err)
+	}
+
+	if format == MessageFormatBIP137 {
+		if len(sig) != 65 || sig[0] < 27 || sig[0] > 42 {
+			return false, invalidField("signature", "not a 65 byte BIP137 signature")
+		}
+		// Headers 27-30 are uncompressed P2PKH keys, 31-42 compressed keys.
+		recID := (sig[0] - 27) & 3
+		compressed := sig[0] >= 31
+		compact := append([]byte{27 + recID}, sig[1:]...)
+		if compressed {
+			compact[0] += 4
+		}
+		pubKey, _, err := ecdsa.RecoverCompact(compact, bip137Hash(message))
+		if err != nil {
+			return false, nil
+		}
+		signer, err := a.pubKeyAddress(pubKey, compressed, addrType)
+		if err != nil {
+			return false, nil
+		}
+		return signer.EncodeAddress() == addr.EncodeAddress(), nil
+	}
+
+	witness, err := decodeWitness(sig)
+	if err != nil {
+		return false, invalidField("signature", "not a BIP322 simple signature: %v", err)
+	}
+	pkScript, err := txscript.PayToAddrScript(addr)
+	if err != nil {
+		return false, err
+	}
+	toSign, sigHashes, fetcher := bip322Txs(pkScript, message)
+	toSign.TxIn[0].Witness = witness
+	vm, err := txscript.NewEngine(pkScript, toSign, 0, txscript.StandardVerifyFlags, nil, sigHashes, 0, fetcher)
+	if err != nil {
+		return false, nil
+	}
+	return vm.Execute() == nil, nil
+}
+
+// messageAddress decodes an address messages can be signed for and returns
+// its type.
+func (a *btcAdapter) messageAddress(address string) (btcutil.Address, string, error) {
+	addr, err := btcutil.DecodeAddress(address, a.net)
+	if err != nil || !addr.IsForNet(a.net) {
+		return nil, "", invalidField("address", "%s is not a %s address", address, a.net.Name)
+	}
+	switch addr.(type) {
+	case *btcutil.AddressPubKeyHash:
+		return addr, "p2pkh", nil
+	case *btcutil.AddressScriptHash:
+		// Only P2SH-P2WPKH wallets sign for script hash addresses.
+		return addr, "p2sh_p2wpkh", nil
+	case *btcutil.AddressWitnessPubKeyHash:
+		return addr, "p2wpkh", nil
+	case *btcutil.AddressTaproot:
+		return addr, "p2tr", nil
+	default:
+		return nil, "", invalidField("address", "messages cannot be signed for %s", address)
+	}
+}
+
+// messageFormat resolves the signature format for an address type.
+func messageFormat(format, addrType string) (string, error) {
+	switch format {
+	case "":
+		if addrType == "p2tr" {
+			return MessageFormatBIP322, nil
+		}
+		return MessageFormatBIP137, nil
+	case MessageFormatBIP137:
+		if addrType == "p2tr" {
+			return "", invalidField("format", "BIP137 does not cover taproot addresses, use %s", MessageFormatBIP322)
+		}
+	case MessageFormatBIP322:
+		if addrType != "p2wpkh" && addrType != "p2tr" {
+			return "", invalidField("format", "BIP322 simple signatures cover p2wpkh and p2tr addresses, use %s", MessageFormatBIP137)
+		}
+	default:
+		return "", invalidField("format", "unsupported format %q, use %q or %q", format, MessageFormatBIP137, MessageFormatBIP322)
+	}
+	return format, nil
+}
+
+// pubKeyAddress returns the address of addrType paying to pubKey.
+func (a *btcAdapter) pubKeyAddress(pubKey *btcec.PublicKey, compressed bool, addrType string) (btcutil.Address, error) {
+	serialized := pubKey.SerializeUncompressed()
+	if compressed {
+		serialized = pubKey.SerializeCompressed()
+	}
+	keyHash := btcutil.Hash160(serialized)
+	switch {
+	case addrType == "p2pkh":
+		return btcutil.NewAddressPubKeyHash(keyHash, a.net)
+	case !compressed:
+		return nil, fmt.Errorf("segwit addresses need a compressed key")
+	case addrType == "p2wpkh":
+		return btcutil.NewAddressWitnessPubKeyHash(keyHash, a.net)
+	default:
+		return btcutil.NewAddressScriptHash(append([]byte{txscript.OP_0, txscript.OP_DATA_20}, keyHash...), a.net)
+	}
+}
+
+// bip137Hash is the double SHA256 of the magic prefix and message, each
+// serialized as a var string.
+func bip137Hash(message string) []byte {
+	var buf bytes.Buffer
+	_ = wire.WriteVarString(&buf, 0, bip137Magic)
+	_ = wire.WriteVarString(&buf, 0, message)
+	return chainhash.DoubleHashB(buf.Bytes())
+}
+
+// bip322MessageHash is the BIP340 tagged hash of message.
+func bip322MessageHash(message string) *chainhash.Hash {
+	return chainhash.TaggedHash([]byte("BIP0322-signed-message"), []byte(message))
+}
+
+// bip322Txs returns the BIP322 to_sign transaction for a message signed by
+// pkScript, with the sighash midstate and fetcher of the to_spend output it
+// spends.
+func bip322Txs(pkScript []byte, message string) (*wire.MsgTx, *txscript.TxSigHashes, txscript.PrevOutputFetcher) {
+	toSpend := wire.NewMsgTx(0)
+	messageHash := bip322MessageHash(message)
+	sigScript := append([]byte{txscript.OP_0, txscript.OP_DATA_32}, messageHash[:]...)
+	toSpend.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: wire.OutPoint{Index: wire.MaxPrevOutIndex},
+		SignatureScript:  sigScript,
+		Sequence:         0,
+	})
+	toSpend.AddTxOut(wire.NewTxOut(0, pkScript))
+
+	toSign := wire.NewMsgTx(0)
+	toSign.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: wire.OutPoint{Hash: toSpend.TxHash(), Index: 0},
+		Sequence:         0,
+	})
+	toSign.AddTxOut(wire.NewTxOut(0, []byte{txscript.OP_RETURN}))
+
+	fetcher := txscript.NewCannedPrevOutputFetcher(pkScript, 0)
+	return toSign, txscript.NewTxSigHashes(toSign, fetcher), fetcher
+}
+
+// decodeWitness decodes a consensus serialized witness stack.
+func decodeWitness(raw []byte) (wire.TxWitness, error) {
+	r := bytes.NewReader(raw)
+	count, err := wire.ReadVarInt(r, 0)
+	if err != nil {
+		return nil, err
+	}
+	if count > uint64(len(raw)) {
+		return nil, fmt.Errorf("witness has too many items")
+	}
+	witness := make(wire.TxWitness, count)
+	for i := range witness {
+		witness[i], err = wire.ReadVarBytes(r, 0, txscript.MaxScriptSize, "witness item")
+		if err != nil {
+			return nil, err
+		}
+	}
+	if r.Len() != 0 {
+		return nil, fmt.Errorf("unexpected data after the witness")
+	}
+	return witness, nil
+}
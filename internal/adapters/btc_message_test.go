@@ -0,0 +1,117 @@
+package adapters
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignMessage(t *testing.T) {
+	t.Run("BIP322 test vectors - pass", func(t *testing.T) {
+		require.Equal(t, "c90c269c4f8fcbe6880f72a721ddfbf1914268a794cbb21cfafee13770ae19f1", hex.EncodeToString(bip322MessageHash("")[:]))
+		require.Equal(t, "f0eb03b1a75ac6d9847f55c624a99169b5dccba2a31f5b23bea77ba270de0a7a", hex.EncodeToString(bip322MessageHash("Hello World")[:]))
+
+		a := NewBtcAdapter(&chaincfg.MainNetParams)
+		for _, tc := range []struct {
+			address, message, signature string
+		}{
+			{"bc1q9vza2e8x573nczrlzms0wvx3gsqjx7vavgkx0l", "", "AkcwRAIgM2gBAQqvZX15ZiysmKmQpDrG83avLIT492QBzLnQIxYCIBaTpOaD20qRlEylyxFSeEA2ba9YOixpX8z46TSDtS40ASECx/EgAxlkQpQ9hYjgGu6EBCPMVPwVIVJqO4XCsMvViHI="},
+			{"bc1q9vza2e8x573nczrlzms0wvx3gsqjx7vavgkx0l", "Hello World", "AkcwRAIgZRfIY3p7/DoVTty6YZbWS71bc5Vct9p9Fia83eRmw2QCICK/ENGfwLtptFluMGs2KsqoNSk89pO7F29zJLUx9a/sASECx/EgAxlkQpQ9hYjgGu6EBCPMVPwVIVJqO4XCsMvViHI="},
+			{"bc1ppv609nr0vr25u07u95waq5lucwfm6tde4nydujnu8npg4q75mr5sxq8lt3", "Hello World", "AUHd69PrJQEv+oKTfZ8l+WROBHuy9HKrbFCJu7U1iK2iiEy1vMU5EfMtjc+VSHM7aU0SDbak5IUZRVno2P5mjSafAQ=="},
+		} {
+			valid, err := a.VerifyMessage(tc.address, tc.message, tc.signature, MessageFormatBIP322)
+			require.NoError(t, err)
+			require.True(t, valid, "%s signing %q", tc.address, tc.message)
+
+			valid, err = a.VerifyMessage(tc.address, tc.message+"!", tc.signature, MessageFormatBIP322)
+			require.NoError(t, err)
+			require.False(t, valid)
+		}
+	})
+
+	net := &chaincfg.TestNet4Params
+	a := NewBtcAdapter(net)
+	other, err := a.DeriveWallet()
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		addressType string
+		formats     []string
+		header      byte
+	}{
+		{AddressTypeP2WPKH, []string{MessageFormatBIP137, MessageFormatBIP322}, 39},
+		{AddressTypeP2SHP2WPKH, []string{MessageFormatBIP137}, 35},
+		{AddressTypeP2TR, []string{MessageFormatBIP322}, 0},
+	} {
+		wallet, err := a.DeriveWalletOfType(tc.addressType)
+		require.NoError(t, err)
+
+		t.Run("Sign and verify "+tc.addressType+" - pass", func(t *testing.T) {
+			signature, format, err := a.SignMessage(wallet, "proof of reserves 2026-10", "")
+			require.NoError(t, err)
+			require.Equal(t, tc.formats[0], format, "default format")
+
+			for _, format := range tc.formats {
+				signature, used, err := a.SignMessage(wallet, "proof of reserves 2026-10", format)
+				require.NoError(t, err)
+				require.Equal(t, format, used)
+				if format == MessageFormatBIP137 {
+					raw, err := base64.StdEncoding.DecodeString(signature)
+					require.NoError(t, err)
+					require.Len(t, raw, 65)
+					require.GreaterOrEqual(t, raw[0], tc.header)
+					require.Less(t, raw[0], tc.header+4)
+				}
+
+				valid, err := a.VerifyMessage(wallet.PublicKey, "proof of reserves 2026-10", signature, format)
+				require.NoError(t, err)
+				require.True(t, valid)
+
+				valid, err = a.VerifyMessage(wallet.PublicKey, "proof of reserves 2026-11", signature, format)
+				require.NoError(t, err)
+				require.False(t, valid)
+
+				valid, err = a.VerifyMessage(other.PublicKey, "proof of reserves 2026-10", signature, format)
+				require.NoError(t, err)
+				require.False(t, valid, "signed by another key")
+			}
+
+			valid, err := a.VerifyMessage(wallet.PublicKey, "proof of reserves 2026-10", signature, "")
+			require.NoError(t, err)
+			require.True(t, valid)
+		})
+	}
+
+	t.Run("Unsupported format - fail", func(t *testing.T) {
+		taproot, err := a.DeriveWalletOfType(AddressTypeP2TR)
+		require.NoError(t, err)
+		_, _, err = a.SignMessage(taproot, "hello", MessageFormatBIP137)
+		require.ErrorIs(t, err, ErrInvalidPayload)
+		require.ErrorContains(t, err, "format")
+
+		nested, err := a.DeriveWalletOfType(AddressTypeP2SHP2WPKH)
+		require.NoError(t, err)
+		_, _, err = a.SignMessage(nested, "hello", MessageFormatBIP322)
+		require.ErrorContains(t, err, "format")
+
+		_, _, err = a.SignMessage(other, "hello", "bip0")
+		require.ErrorContains(t, err, "format")
+	})
+
+	t.Run("Malformed signature - fail", func(t *testing.T) {
+		_, err := a.VerifyMessage(other.PublicKey, "hello", "not base64!", "")
+		require.ErrorIs(t, err, ErrInvalidPayload)
+
+		_, err = a.VerifyMessage(other.PublicKey, "hello", base64.StdEncoding.EncodeToString([]byte{1, 2, 3}), MessageFormatBIP137)
+		require.ErrorContains(t, err, "signature")
+
+		_, err = a.VerifyMessage(other.PublicKey, "hello", base64.StdEncoding.EncodeToString([]byte{5, 1}), MessageFormatBIP322)
+		require.ErrorContains(t, err, "signature")
+
+		_, err = a.VerifyMessage("bc1q9vza2e8x573nczrlzms0wvx3gsqjx7vavgkx0l", "hello", "", "")
+		require.ErrorContains(t, err, "address")
+	})
+}
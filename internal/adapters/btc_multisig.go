@@ -0,0 +1,351 @@
+package adapters
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	btcec "github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/ecdsa"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/btcutil/psbt"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// Address types a multisig wallet can be created with.
+const (
+	MultisigTypeP2WSH     = "p2wsh"
+	MultisigTypeP2SHP2WSH = "p2sh_p2wsh"
+)
+
+// Multisig is an M-of-N sortedmulti wallet. It holds only public keys; the
+// private keys stay in the wallets that sign for it.
+type Multisig struct {
+	Address     string `json:"address"`
+	AddressType string `json:"address_type"`
+	Threshold   int    `json:"threshold"`
+	// PublicKeys are the compressed keys in hex, in the order of the script.
+	PublicKeys    []string `json:"public_keys"`
+	WitnessScript string   `json:"witness_script"`
+	// RedeemScript is the P2SH script wrapping the witness program. It is
+	// only set for p2sh_p2wsh.
+	RedeemScript string `json:"redeem_script,omitempty"`
+}
+
+// NewMultisig builds the threshold-of-N multisig wallet of the keys of the
+// internal wallets and the external keys. External keys are hex compressed
+// public keys, or extended public keys optionally followed by a non-hardened
+// derivation path such as "tpub.../0/3".
+func (a *btcAdapter) NewMultisig(threshold int, internal []*Wallet, external []string, addressType string) (*Multisig, error) {
+	if addressType == "" {
+		addressType = MultisigTypeP2WSH
+	}
+	if addressType != MultisigTypeP2WSH && addressType != MultisigTypeP2SHP2WSH {
+		return nil, invalidField("address_type", "unsupported multisig address type %q, use %q or %q", addressType, MultisigTypeP2WSH, MultisigTypeP2SHP2WSH)
+	}
+
+	keys := make([][]byte, 0, len(internal)+len(external))
+	for _, wallet := range internal {
+		wif, err := btcutil.DecodeWIF(wallet.PrivateKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode WIF: %w", err)
+		}
+		if !wif.IsForNet(a.net) {
+			return nil, invalidField("internal_keys", "wallet %s is not a %s wallet", wallet.PublicKey, a.net.Name)
+		}
+		keys = append(keys, wif.PrivKey.PubKey().SerializeCompressed())
+	}
+	for i, key := range external {
+		pubKey, err := a.externalKey(key)
+		if err != nil {
+			return nil, invalidField(fmt.Sprintf("public_keys[%d]", i), "%v", err)
+		}
+		keys = append(keys, pubKey)
+	}
+
+	if len(keys) == 0 || len(keys) > txscript.MaxPubKeysPerMultiSig {
+		return nil, invalidField("public_keys", "a multisig needs 1 to %d keys, got %d", txscript.MaxPubKeysPerMultiSig, len(keys))
+	}
+	if threshold < 1 || threshold > len(keys) {
+		return nil, invalidField("threshold", "must be between 1 and the %d keys", len(keys))
+	}
+	slices.SortFunc(keys, bytes.Compare)
+	for i := 1; i < len(keys); i++ {
+		if bytes.Equal(keys[i-1], keys[i]) {
+			return nil, invalidField("public_keys", "key %x is listed twice", keys[i])
+		}
+	}
+
+	builder := txscript.NewScriptBuilder().AddInt64(int64(threshold))
+	publicKeys := make([]string, len(keys))
+	for i, key := range keys {
+		builder.AddData(key)
+		publicKeys[i] = hex.EncodeToString(key)
+	}
+	witnessScript, err := builder.AddInt64(int64(len(keys))).AddOp(txscript.OP_CHECKMULTISIG).Script()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build witness script: %w", err)
+	}
+
+	multisig := &Multisig{
+		AddressType:   addressType,
+		Threshold:     threshold,
+		PublicKeys:    publicKeys,
+		WitnessScript: hex.EncodeToString(witnessScript),
+	}
+	scriptHash := sha256.Sum256(witnessScript)
+	var addr btcutil.Address
+	if addressType == MultisigTypeP2SHP2WSH {
+		redeemScript := append([]byte{txscript.OP_0, txscript.OP_DATA_32}, scriptHash[:]...)
+		multisig.RedeemScript = hex.EncodeToString(redeemScript)
+		addr, err = btcutil.NewAddressScriptHash(redeemScript, a.net)
+	} else {
+		addr, err = btcutil.NewAddressWitnessScriptHash(scriptHash[:], a.net)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create multisig address: %w", err)
+	}
+	multisig.Address = addr.EncodeAddress()
+	return multisig, nil
+}
+
+// externalKey parses an external multisig key into a compressed public key.
+func (a *btcAdapter) externalKey(key string) ([]byte, error) {
+	key = strings.TrimSpace(key)
+	if raw, err := hex.DecodeString(key); err == nil {
+		if len(raw) != btcec.PubKeyBytesLenCompressed {
+			return nil, fmt.Errorf("segwit multisig keys must be %d byte compressed public keys", btcec.PubKeyBytesLenCompressed)
+		}
+		pubKey, err := btcec.ParsePubKey(raw)
+		if err != nil {
+			return nil, err
+		}
+		return pubKey.SerializeCompressed(), nil
+	}
+
+	parts := strings.Split(key, "/")
+	extKey, err := hdkeychain.NewKeyFromString(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("not a hex public key or extended public key: %v", err)
+	}
+	if extKey.IsPrivate() {
+		return nil, fmt.Errorf("extended private keys are not accepted, pass the xpub")
+	}
+	if !extKey.IsForNet(a.net) {
+		return nil, fmt.Errorf("extended key is not for %s", a.net.Name)
+	}
+	for _, part := range parts[1:] {
+		index, err := strconv.ParseUint(part, 10, 32)
+		if err != nil || index >= hdkeychain.HardenedKeyStart {
+			return nil, fmt.Errorf("derivation step %q must be a non-hardened index", part)
+		}
+		extKey, err = extKey.Derive(uint32(index))
+		if err != nil {
+			return nil, err
+		}
+	}
+	pubKey, err := extKey.ECPubKey()
+	if err != nil {
+		return nil, err
+	}
+	return pubKey.SerializeCompressed(), nil
+}
+
+// SignMultisigPSBT adds the signer's signature to every input of a base64
+// PSBT that spends the multisig and does not carry it yet. With finalize set,
+// the multisig inputs are finalized with threshold signatures and every other
+// input must be finalizable too.
+func (a *btcAdapter) SignMultisigPSBT(multisig *Multisig, signer *Wallet, psbtB64 string, finalize bool) (*PSBTResult, error) {
+	packet, err := decodePSBT(psbtB64)
+	if err != nil {
+		return nil, err
+	}
+
+	wif, err := btcutil.DecodeWIF(signer.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode WIF: %w", err)
+	}
+	if !wif.IsForNet(a.net) {
+		return nil, fmt.Errorf("wif network mismatch: wallet WIF not for %s", a.net.Name)
+	}
+	pubKey := wif.PrivKey.PubKey().SerializeCompressed()
+	if !slices.Contains(multisig.PublicKeys, hex.EncodeToString(pubKey)) {
+		return nil, invalidField("signer", "wallet %s is not a key of multisig %s", signer.PublicKey, multisig.Address)
+	}
+
+	witnessScript, redeemScript, pkScript, err := a.multisigScripts(multisig)
+	if err != nil {
+		return nil, err
+	}
+
+	prevOuts, err := psbtPrevOuts(packet)
+	if err != nil {
+		return nil, err
+	}
+	tx := packet.UnsignedTx
+	sigHashes := psbtSigHashes(packet, prevOuts)
+
+	updater, err := psbt.NewUpdater(packet)
+	if err != nil {
+		return nil, invalidField("psbt", "%v", err)
+	}
+
+	spendsMultisig := func(script []byte) bool {
+		return bytes.Equal(script, pkScript)
+	}
+	inputWeight := func(script []byte) (int, bool) {
+		return multisigInputWeight(multisig.Threshold, witnessScript, redeemScript), spendsMultisig(script)
+	}
+	if err := a.checkPSBTFee(packet, prevOuts, inputWeight, spendsMultisig); err != nil {
+		return nil, err
+	}
+
+	var signed, spending []int
+	for i, pInput := range packet.Inputs {
+		if !spendsMultisig(prevOuts[i].PkScript) || len(pInput.FinalScriptWitness) > 0 {
+			continue
+		}
+		spending = append(spending, i)
+		if slices.ContainsFunc(pInput.PartialSigs, func(sig *psbt.PartialSig) bool { return bytes.Equal(sig.PubKey, pubKey) }) {
+			continue
+		}
+		if pInput.SighashType != 0 && pInput.SighashType != txscript.SigHashAll {
+			return nil, invalidField("psbt", "input %d requests sighash type %v, only SIGHASH_ALL is signed", i, pInput.SighashType)
+		}
+		// As for single key inputs, only the non-witness UTXO proves the
+		// amount a segwit v0 signature commits to.
+		if pInput.NonWitnessUtxo == nil {
+			return nil, invalidField("psbt", "input %d spends a %s output and needs a non-witness UTXO", i, scriptTypeName(multisig.AddressType))
+		}
+
+		sig, err := txscript.RawTxInWitnessSignature(tx, sigHashes, i, prevOuts[i].Value, witnessScript, txscript.SigHashAll, wif.PrivKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to sign input %d: %w", i, err)
+		}
+		if _, err := updater.Sign(i, sig, pubKey, redeemScript, witnessScript); err != nil {
+			return nil, fmt.Errorf("failed to add signature to input %d: %w", i, err)
+		}
+		signed = append(signed, i)
+	}
+
+	if len(spending) == 0 {
+		return nil, invalidField("psbt", "no inputs spend from multisig %s", multisig.Address)
+	}
+	if finalize {
+		for _, i := range spending {
+			if err := finalizeMultisigInput(packet, i, multisig, witnessScript, redeemScript, sigHashes, prevOuts[i].Value); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return finishPSBT(packet, prevOuts, signed, finalize)
+}
+
+// multisigScripts decodes the multisig's witness and redeem scripts and
+// returns them with the scriptPubKey of its address.
+func (a *btcAdapter) multisigScripts(multisig *Multisig) ([]byte, []byte, []byte, error) {
+	witnessScript, err := hex.DecodeString(multisig.WitnessScript)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("invalid multisig witness script: %w", err)
+	}
+	var redeemScript []byte
+	if multisig.RedeemScript != "" {
+		redeemScript, err = hex.DecodeString(multisig.RedeemScript)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("invalid multisig redeem script: %w", err)
+		}
+	}
+	addr, err := btcutil.DecodeAddress(multisig.Address, a.net)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("invalid multisig address: %w", err)
+	}
+	pkScript, err := txscript.PayToAddrScript(addr)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return witnessScript, redeemScript, pkScript, nil
+}
+
+// finalizeMultisigInput finalizes input i of packet, which spends value sats
+// of the multisig, with the first threshold signatures of its keys in script
+// order. The generic PSBT finalizer would push every partial signature, which
+// OP_CHECKMULTISIG rejects once there are more than the threshold. Every
+// signature is checked before it goes into the witness, so a bad signature of
+// a cosigner is reported here rather than by the node at broadcast.
+func finalizeMultisigInput(packet *psbt.Packet, i int, multisig *Multisig, witnessScript, redeemScript []byte, sigHashes *txscript.TxSigHashes, value int64) error {
+	pInput := &packet.Inputs[i]
+	if len(pInput.FinalScriptWitness) > 0 {
+		return nil
+	}
+
+	witness := wire.TxWitness{nil}
+	for _, key := range multisig.PublicKeys {
+		if len(witness)-1 == multisig.Threshold {
+			break
+		}
+		for _, partial := range pInput.PartialSigs {
+			if hex.EncodeToString(partial.PubKey) != key {
+				continue
+			}
+			if err := checkMultisigSig(packet.UnsignedTx, sigHashes, i, value, witnessScript, partial); err != nil {
+				return invalidField("psbt", "input %d signature of key %s %v", i, key, err)
+			}
+			witness = append(witness, partial.Signature)
+			break
+		}
+	}
+	if signatures := len(witness) - 1; signatures < multisig.Threshold {
+		return invalidField("psbt", "input %d has %d of the %d signatures multisig %s needs", i, signatures, multisig.Threshold, multisig.Address)
+	}
+	witness = append(witness, witnessScript)
+
+	var buf bytes.Buffer
+	if err := psbt.WriteTxWitness(&buf, witness); err != nil {
+		return err
+	}
+	if len(redeemScript) > 0 {
+		sigScript, err := txscript.NewScriptBuilder().AddData(redeemScript).Script()
+		if err != nil {
+			return err
+		}
+		pInput.FinalScriptSig = sigScript
+	}
+	pInput.FinalScriptWitness = buf.Bytes()
+	pInput.PartialSigs = nil
+	pInput.SighashType = 0
+	pInput.RedeemScript = nil
+	pInput.WitnessScript = nil
+	pInput.Bip32Derivation = nil
+	return nil
+}
+
+// checkMultisigSig checks that partial is a valid SIGHASH_ALL signature of
+// its key over input i of tx, which spends value sats with witnessScript.
+func checkMultisigSig(tx *wire.MsgTx, sigHashes *txscript.TxSigHashes, i int, value int64, witnessScript []byte, partial *psbt.PartialSig) error {
+	n := len(partial.Signature)
+	if n == 0 || txscript.SigHashType(partial.Signature[n-1]) != txscript.SigHashAll {
+		return fmt.Errorf("is not a SIGHASH_ALL signature")
+	}
+	sig, err := ecdsa.ParseDERSignature(partial.Signature[:n-1])
+	if err != nil {
+		return fmt.Errorf("is malformed: %v", err)
+	}
+	pubKey, err := btcec.ParsePubKey(partial.PubKey)
+	if err != nil {
+		return fmt.Errorf("has an invalid key: %v", err)
+	}
+	hash, err := txscript.CalcWitnessSigHash(witnessScript, sigHashes, txscript.SigHashAll, tx, i, value)
+	if err != nil {
+		return err
+	}
+	if !sig.Verify(hash, pubKey) {
+		return fmt.Errorf("does not verify")
+	}
+	return nil
+}
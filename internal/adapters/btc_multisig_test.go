@@ -0,0 +1,185 @@
+package adapters
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/btcutil/psbt"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMultisig(t *testing.T) {
+	net := &chaincfg.TestNet4Params
+	a := NewBtcAdapter(net)
+
+	wallets := make([]*Wallet, 3)
+	for i := range wallets {
+		wallet, err := a.DeriveWallet()
+		require.NoError(t, err)
+		wallets[i] = wallet
+	}
+	master, err := hdkeychain.NewMaster(bytes.Repeat([]byte{0x42}, 32), net)
+	require.NoError(t, err)
+	xpub, err := master.Neuter()
+	require.NoError(t, err)
+	child, err := xpub.Derive(0)
+	require.NoError(t, err)
+	child, err = child.Derive(3)
+	require.NoError(t, err)
+	childKey, err := child.ECPubKey()
+	require.NoError(t, err)
+
+	// spend funds the multisig and returns a PSBT spending it.
+	spend := func(multisig *Multisig) (string, *wire.TxOut) {
+		addr, err := btcutil.DecodeAddress(multisig.Address, net)
+		require.NoError(t, err)
+		pkScript, err := txscript.PayToAddrScript(addr)
+		require.NoError(t, err)
+		funding := fundingTx(pkScript, 80000)
+		packet := newTestPSBT(t, []*wire.MsgTx{funding}, 79000)
+		packet.Inputs[0].WitnessUtxo = funding.TxOut[0]
+		packet.Inputs[0].NonWitnessUtxo = funding
+		encoded, err := packet.B64Encode()
+		require.NoError(t, err)
+		return encoded, funding.TxOut[0]
+	}
+	finalTx := func(result *PSBTResult) *wire.MsgTx {
+		raw, err := hex.DecodeString(result.Tx)
+		require.NoError(t, err)
+		var tx wire.MsgTx
+		require.NoError(t, tx.Deserialize(bytes.NewReader(raw)))
+		return &tx
+	}
+
+	t.Run("2-of-3 with an external xpub - pass", func(t *testing.T) {
+		multisig, err := a.NewMultisig(2, wallets[:2], []string{xpub.String() + "/0/3"}, "")
+		require.NoError(t, err)
+		require.Equal(t, MultisigTypeP2WSH, multisig.AddressType)
+		require.Contains(t, multisig.PublicKeys, hex.EncodeToString(childKey.SerializeCompressed()))
+		require.Empty(t, multisig.RedeemScript)
+
+		addr, err := btcutil.DecodeAddress(multisig.Address, net)
+		require.NoError(t, err)
+		require.IsType(t, &btcutil.AddressWitnessScriptHash{}, addr)
+
+		encoded, prevOut := spend(multisig)
+		first, err := a.SignMultisigPSBT(multisig, wallets[0], encoded, false)
+		require.NoError(t, err)
+		require.Equal(t, []int{0}, first.SignedInputs)
+		require.False(t, first.Complete)
+
+		_, err = a.SignMultisigPSBT(multisig, wallets[1], encoded, true)
+		require.ErrorIs(t, err, ErrInvalidPayload)
+		require.ErrorContains(t, err, "1 of the 2 signatures")
+
+		second, err := a.SignMultisigPSBT(multisig, wallets[1], first.PSBT, true)
+		require.NoError(t, err)
+		require.True(t, second.Complete)
+		verifyInputs(t, finalTx(second), []*wire.TxOut{prevOut})
+	})
+
+	t.Run("Nested P2SH-P2WSH with every key signing - pass", func(t *testing.T) {
+		multisig, err := a.NewMultisig(2, wallets, nil, MultisigTypeP2SHP2WSH)
+		require.NoError(t, err)
+		require.NotEmpty(t, multisig.RedeemScript)
+		addr, err := btcutil.DecodeAddress(multisig.Address, net)
+		require.NoError(t, err)
+		require.IsType(t, &btcutil.AddressScriptHash{}, addr)
+
+		encoded, prevOut := spend(multisig)
+		for _, wallet := range wallets {
+			result, err := a.SignMultisigPSBT(multisig, wallet, encoded, false)
+			require.NoError(t, err)
+			encoded = result.PSBT
+		}
+		packet, err := psbt.NewFromRawBytes(bytes.NewReader([]byte(encoded)), true)
+		require.NoError(t, err)
+		require.Len(t, packet.Inputs[0].PartialSigs, 3)
+
+		// Three signatures are one too many for OP_CHECKMULTISIG; only the
+		// threshold goes into the witness.
+		result, err := a.SignMultisigPSBT(multisig, wallets[0], encoded, true)
+		require.NoError(t, err)
+		require.Empty(t, result.SignedInputs)
+		verifyInputs(t, finalTx(result), []*wire.TxOut{prevOut})
+	})
+
+	t.Run("Invalid cosigner signature - fail", func(t *testing.T) {
+		multisig, err := a.NewMultisig(2, wallets[:1], []string{xpub.String() + "/0/3"}, "")
+		require.NoError(t, err)
+		encoded, prevOut := spend(multisig)
+		packet, err := psbt.NewFromRawBytes(bytes.NewReader([]byte(encoded)), true)
+		require.NoError(t, err)
+
+		// A signature by another key, claimed for the external key.
+		witnessScript, err := hex.DecodeString(multisig.WitnessScript)
+		require.NoError(t, err)
+		otherKey, err := btcec.NewPrivateKey()
+		require.NoError(t, err)
+		sigHashes := psbtSigHashes(packet, []*wire.TxOut{prevOut})
+		forged, err := txscript.RawTxInWitnessSignature(packet.UnsignedTx, sigHashes, 0, prevOut.Value, witnessScript, txscript.SigHashAll, otherKey)
+		require.NoError(t, err)
+		packet.Inputs[0].PartialSigs = []*psbt.PartialSig{{PubKey: childKey.SerializeCompressed(), Signature: forged}}
+		encoded, err = packet.B64Encode()
+		require.NoError(t, err)
+
+		_, err = a.SignMultisigPSBT(multisig, wallets[0], encoded, true)
+		require.ErrorIs(t, err, ErrInvalidPayload)
+		require.ErrorContains(t, err, "does not verify")
+	})
+
+	t.Run("Multisig input without non-witness UTXO - fail", func(t *testing.T) {
+		multisig, err := a.NewMultisig(1, wallets[:1], nil, "")
+		require.NoError(t, err)
+		encoded, _ := spend(multisig)
+		packet, err := psbt.NewFromRawBytes(bytes.NewReader([]byte(encoded)), true)
+		require.NoError(t, err)
+		packet.Inputs[0].NonWitnessUtxo = nil
+		encoded, err = packet.B64Encode()
+		require.NoError(t, err)
+
+		_, err = a.SignMultisigPSBT(multisig, wallets[0], encoded, false)
+		require.ErrorIs(t, err, ErrInvalidPayload)
+		require.ErrorContains(t, err, "needs a non-witness UTXO")
+	})
+
+	t.Run("Signer outside the multisig - fail", func(t *testing.T) {
+		multisig, err := a.NewMultisig(1, wallets[:2], nil, "")
+		require.NoError(t, err)
+		encoded, _ := spend(multisig)
+		_, err = a.SignMultisigPSBT(multisig, wallets[2], encoded, false)
+		require.ErrorIs(t, err, ErrInvalidPayload)
+		require.ErrorContains(t, err, "signer")
+	})
+
+	t.Run("Invalid definition - fail", func(t *testing.T) {
+		for name, tc := range map[string]struct {
+			threshold int
+			internal  []*Wallet
+			external  []string
+			field     string
+		}{
+			"threshold above keys": {3, wallets[:2], nil, "threshold"},
+			"zero threshold":       {0, wallets[:2], nil, "threshold"},
+			"duplicate key":        {1, []*Wallet{wallets[0], wallets[0]}, nil, "public_keys"},
+			"xprv":                 {1, nil, []string{master.String()}, "public_keys[0]"},
+			"hardened path":        {1, nil, []string{xpub.String() + "/0'"}, "public_keys[0]"},
+			"uncompressed key":     {1, nil, []string{"04" + hex.EncodeToString(bytes.Repeat([]byte{1}, 64))}, "public_keys[0]"},
+			"no keys":              {1, nil, nil, "public_keys"},
+		} {
+			_, err := a.NewMultisig(tc.threshold, tc.internal, tc.external, "")
+			require.ErrorIs(t, err, ErrInvalidPayload, name)
+			require.ErrorContains(t, err, tc.field, name)
+		}
+
+		_, err := a.NewMultisig(1, wallets[:1], nil, "p2tr")
+		require.ErrorContains(t, err, "address_type")
+	})
+}
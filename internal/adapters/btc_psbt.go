@@ -0,0 +1,329 @@
+package adapters
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/psbt"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// PSBTResult is the outcome of signing a PSBT.
+type PSBTResult struct {
+	PSBT         string // base64 PSBT including the new signatures
+	SignedInputs []int  // indexes of the inputs signed by the wallet
+	Complete     bool   // every input is finalized
+	Tx           string // raw transaction hex, set when finalized
+}
+
+// SignPSBT adds the wallet's signatures to every input of a base64 PSBT that
+// spends one of the wallet key's scripts, or the script of an HD account key
+// its BIP32 derivation names. Other inputs are left untouched. When
+// finalize is set every input must be finalizable, and the extracted network
+// transaction is returned as well.
+func (a *btcAdapter) SignPSBT(wallet *Wallet, psbtB64 string, finalize bool) (*PSBTResult, error) {
+	packet, err := decodePSBT(psbtB64)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, _, err := a.walletKey(wallet)
+	if err != nil {
+		return nil, err
+	}
+
+	prevOuts, err := psbtPrevOuts(packet)
+	if err != nil {
+		return nil, err
+	}
+	tx := packet.UnsignedTx
+	sigHashes := psbtSigHashes(packet, prevOuts)
+
+	updater, err := psbt.NewUpdater(packet)
+	if err != nil {
+		return nil, invalidField("psbt", "%v", err)
+	}
+
+	inputKeys := make([]*btcutil.WIF, len(packet.Inputs))
+	inputTypes := map[string]string{}
+	for i, pInput := range packet.Inputs {
+		key, scriptType, err := keys.psbtKey(prevOuts[i].PkScript, pInput.Bip32Derivation, pInput.TaprootBip32Derivation)
+		if err != nil {
+			return nil, err
+		}
+		if key != nil {
+			inputKeys[i] = key
+			inputTypes[string(prevOuts[i].PkScript)] = scriptType
+		}
+	}
+	changeScripts := map[string]bool{}
+	for i, pOutput := range packet.Outputs {
+		pkScript := tx.TxOut[i].PkScript
+		key, _, err := keys.psbtKey(pkScript, pOutput.Bip32Derivation, pOutput.TaprootBip32Derivation)
+		if err != nil {
+			return nil, err
+		}
+		if key != nil {
+			changeScripts[string(pkScript)] = true
+		}
+	}
+
+	inputWeight := func(pkScript []byte) (int, bool) {
+		scriptType, ok := inputTypes[string(pkScript)]
+		return inputWeights[scriptType], ok
+	}
+	isChange := func(pkScript []byte) bool {
+		return changeScripts[string(pkScript)]
+	}
+	if err := a.checkPSBTFee(packet, prevOuts, inputWeight, isChange); err != nil {
+		return nil, err
+	}
+
+	var signed []int
+	for i, pInput := range packet.Inputs {
+		if len(pInput.FinalScriptSig) > 0 || len(pInput.FinalScriptWitness) > 0 || len(pInput.TaprootKeySpendSig) > 0 {
+			continue
+		}
+		wif := inputKeys[i]
+		if wif == nil {
+			continue
+		}
+		scriptType := inputTypes[string(prevOuts[i].PkScript)]
+
+		if scriptType == "v1_p2tr" {
+			if pInput.SighashType != 0 && pInput.SighashType != txscript.SigHashDefault {
+				return nil, invalidField("psbt", "input %d requests sighash type %v, only SIGHASH_DEFAULT is signed", i, pInput.SighashType)
+			}
+			sig, err := txscript.RawTxInTaprootSignature(tx, sigHashes, i, prevOuts[i].Value, prevOuts[i].PkScript, nil, txscript.SigHashDefault, wif.PrivKey)
+			if err != nil {
+				return nil, fmt.Errorf("failed to sign input %d: %w", i, err)
+			}
+			packet.Inputs[i].TaprootKeySpendSig = sig
+			packet.Inputs[i].TaprootInternalKey = schnorr.SerializePubKey(wif.PrivKey.PubKey())
+			signed = append(signed, i)
+			continue
+		}
+
+		if pInput.SighashType != 0 && pInput.SighashType != txscript.SigHashAll {
+			return nil, invalidField("psbt", "input %d requests sighash type %v, only SIGHASH_ALL is signed", i, pInput.SighashType)
+		}
+
+		// A segwit v0 signature commits only to the amount of its own input,
+		// so a witness UTXO alone could understate what is spent and hide
+		// the fee. The non-witness UTXO proves the amount.
+		if pInput.NonWitnessUtxo == nil {
+			return nil, invalidField("psbt", "input %d spends a %s output and needs a non-witness UTXO", i, scriptTypeName(scriptType))
+		}
+
+		var sig, redeemScript []byte
+		switch scriptType {
+		case "v0_p2wpkh":
+			sig, err = txscript.RawTxInWitnessSignature(tx, sigHashes, i, prevOuts[i].Value, prevOuts[i].PkScript, txscript.SigHashAll, wif.PrivKey)
+		case "p2sh_p2wpkh":
+			redeemScript = walletScripts(wif)["v0_p2wpkh"]
+			sig, err = txscript.RawTxInWitnessSignature(tx, sigHashes, i, prevOuts[i].Value, redeemScript, txscript.SigHashAll, wif.PrivKey)
+		case "p2pkh":
+			sig, err = txscript.RawTxInSignature(tx, i, prevOuts[i].PkScript, txscript.SigHashAll, wif.PrivKey)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to sign input %d: %w", i, err)
+		}
+
+		if _, err := updater.Sign(i, sig, wif.PrivKey.PubKey().SerializeCompressed(), redeemScript, nil); err != nil {
+			return nil, fmt.Errorf("failed to add signature to input %d: %w", i, err)
+		}
+		signed = append(signed, i)
+	}
+
+	if len(signed) == 0 {
+		return nil, invalidField("psbt", "no inputs spend from wallet %s", wallet.PublicKey)
+	}
+	return finishPSBT(packet, prevOuts, signed, finalize)
+}
+
+// psbtKey returns the key of the wallet that pkScript, the script of a PSBT
+// input or output, pays and its script type: the wallet key, or a key of the
+// wallet's HD account that one of the BIP32 derivations names. The key is nil
+// when pkScript is not the wallet's.
+func (k btcKeys) psbtKey(pkScript []byte, derivations []*psbt.Bip32Derivation, taprootDerivations []*psbt.TaprootBip32Derivation) (*btcutil.WIF, string, error) {
+	if scriptType, ok := walletScripts(k.wif).match(pkScript); ok {
+		return k.wif, scriptType, nil
+	}
+	if k.wallet == nil || k.wallet.AccountKey == "" {
+		return nil, "", nil
+	}
+
+	var paths []string
+	for _, derivation := range derivations {
+		if path, ok := k.wallet.Account.childPath(derivation.MasterKeyFingerprint, derivation.Bip32Path); ok {
+			paths = append(paths, path)
+		}
+	}
+	for _, derivation := range taprootDerivations {
+		if path, ok := k.wallet.Account.childPath(derivation.MasterKeyFingerprint, derivation.Bip32Path); ok {
+			paths = append(paths, path)
+		}
+	}
+	for _, path := range paths {
+		key, err := k.child(path)
+		if err != nil {
+			return nil, "", err
+		}
+		if scriptType, ok := walletScripts(key).match(pkScript); ok {
+			return key, scriptType, nil
+		}
+	}
+	return nil, "", nil
+}
+
+// decodePSBT decodes a base64 PSBT.
+func decodePSBT(psbtB64 string) (*psbt.Packet, error) {
+	packet, err := psbt.NewFromRawBytes(strings.NewReader(strings.TrimSpace(psbtB64)), true)
+	if err != nil {
+		return nil, invalidField("psbt", "failed to decode base64 PSBT: %v", err)
+	}
+	return packet, nil
+}
+
+// psbtSigHashes returns the sighash midstate of the PSBT's unsigned
+// transaction spending prevOuts.
+func psbtSigHashes(packet *psbt.Packet, prevOuts []*wire.TxOut) *txscript.TxSigHashes {
+	return txscript.NewTxSigHashes(packet.UnsignedTx, psbtPrevOutFetcher(packet.UnsignedTx, prevOuts))
+}
+
+// psbtPrevOutFetcher returns a fetcher of prevOuts, the outputs spent by the
+// inputs of tx in order.
+func psbtPrevOutFetcher(tx *wire.MsgTx, prevOuts []*wire.TxOut) *txscript.MultiPrevOutFetcher {
+	fetcher := txscript.NewMultiPrevOutFetcher(nil)
+	for i, txIn := range tx.TxIn {
+		fetcher.AddPrevOut(txIn.PreviousOutPoint, prevOuts[i])
+	}
+	return fetcher
+}
+
+// checkPSBTFee checks the fee of the PSBT's transaction, which spends
+// prevOuts, against the signing policy's fee limits before anything is
+// signed. inputWeight returns the signed weight of an input spending
+// pkScript where it is known; other unfinalized inputs count at their
+// unsigned weight, so the fee rate checked is never below the rate paid.
+// Outputs isChange reports true for return to the signer and are not part of
+// the amount paid.
+func (a *btcAdapter) checkPSBTFee(packet *psbt.Packet, prevOuts []*wire.TxOut, inputWeight func(pkScript []byte) (int, bool), isChange func(pkScript []byte) bool) error {
+	tx := packet.UnsignedTx
+	var fee, amount int64
+	for _, prevOut := range prevOuts {
+		fee += prevOut.Value
+	}
+	for _, txOut := range tx.TxOut {
+		if txOut.Value < 0 || txOut.Value > btcutil.MaxSatoshi {
+			return invalidField("psbt", "output value %d is out of range", txOut.Value)
+		}
+		fee -= txOut.Value
+		if !isChange(txOut.PkScript) {
+			amount += txOut.Value
+		}
+	}
+	if fee < 0 {
+		return invalidField("psbt", "outputs exceed inputs by %d sats", -fee)
+	}
+
+	weight := tx.SerializeSizeStripped() * 4
+	for i, pInput := range packet.Inputs {
+		switch {
+		case len(pInput.FinalScriptSig) > 0 || len(pInput.FinalScriptWitness) > 0:
+			weight += len(pInput.FinalScriptSig)*4 + len(pInput.FinalScriptWitness)
+		default:
+			if inputW, ok := inputWeight(prevOuts[i].PkScript); ok {
+				weight += inputW - unsignedInputWeight
+			}
+		}
+	}
+
+	limits := a.feeLimits()
+	if err := limits.checkFeeRate(float64(fee) / float64(weightToVSize(weight))); err != nil {
+		return err
+	}
+	return limits.checkFee(fee, amount)
+}
+
+// finishPSBT encodes a PSBT after signing the inputs in signed. With finalize
+// set every input is finalized and the network transaction extracted, then
+// verified against prevOuts like every transaction the adapter signs.
+func finishPSBT(packet *psbt.Packet, prevOuts []*wire.TxOut, signed []int, finalize bool) (*PSBTResult, error) {
+	var err error
+	result := &PSBTResult{SignedInputs: signed}
+	if finalize {
+		for i := range packet.Inputs {
+			if _, err := psbt.MaybeFinalize(packet, i); err != nil {
+				return nil, invalidField("psbt", "input %d cannot be finalized: %v", i, err)
+			}
+		}
+		finalTx, err := psbt.Extract(packet)
+		if err != nil {
+			return nil, invalidField("psbt", "failed to extract transaction: %v", err)
+		}
+		// Other signers' inputs are only checked here, so a failure is the
+		// PSBT's fault and nothing is returned.
+		if err := verifySignedTx(finalTx, psbtPrevOutFetcher(finalTx, prevOuts)); err != nil {
+			return nil, invalidField("psbt", "%v", err)
+		}
+		var raw bytes.Buffer
+		if err := finalTx.Serialize(&raw); err != nil {
+			return nil, fmt.Errorf("failed to serialize transaction: %w", err)
+		}
+		result.Tx = hex.EncodeToString(raw.Bytes())
+	}
+	result.Complete = packet.IsComplete()
+
+	result.PSBT, err = packet.B64Encode()
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode PSBT: %w", err)
+	}
+	return result, nil
+}
+
+// psbtPrevOuts returns the output spent by each input. Every input needs
+// UTXO information, as the fee cannot be checked otherwise. A witness UTXO
+// must agree with the non-witness UTXO when both are present, and every value
+// must be in range.
+func psbtPrevOuts(packet *psbt.Packet) ([]*wire.TxOut, error) {
+	prevOuts := make([]*wire.TxOut, len(packet.Inputs))
+	for i, pInput := range packet.Inputs {
+		outPoint := packet.UnsignedTx.TxIn[i].PreviousOutPoint
+
+		var fromTx *wire.TxOut
+		if pInput.NonWitnessUtxo != nil {
+			if pInput.NonWitnessUtxo.TxHash() != outPoint.Hash {
+				return nil, invalidField("psbt", "input %d non-witness UTXO does not match the spent txid", i)
+			}
+			if int(outPoint.Index) >= len(pInput.NonWitnessUtxo.TxOut) {
+				return nil, invalidField("psbt", "input %d spends a missing output of its non-witness UTXO", i)
+			}
+			fromTx = pInput.NonWitnessUtxo.TxOut[outPoint.Index]
+		}
+
+		prevOut := pInput.WitnessUtxo
+		switch {
+		case prevOut != nil && fromTx != nil:
+			if prevOut.Value != fromTx.Value || !bytes.Equal(prevOut.PkScript, fromTx.PkScript) {
+				return nil, invalidField("psbt", "input %d witness UTXO (%d sat) does not match its non-witness UTXO (%d sat)", i, prevOut.Value, fromTx.Value)
+			}
+		case prevOut == nil:
+			prevOut = fromTx
+		}
+
+		if prevOut == nil {
+			return nil, invalidField("psbt", "input %d has no witness or non-witness UTXO, so its amount and the fee are unknown", i)
+		}
+		if prevOut.Value <= 0 || prevOut.Value > btcutil.MaxSatoshi {
+			return nil, invalidField("psbt", "input %d UTXO value %d is out of range", i, prevOut.Value)
+		}
+		prevOuts[i] = prevOut
+	}
+	return prevOuts, nil
+}
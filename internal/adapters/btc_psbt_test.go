@@ -0,0 +1,290 @@
+package adapters
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/psbt"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/stretchr/testify/require"
+)
+
+// fundingTx returns a transaction paying value to pkScript at output 0.
+func fundingTx(pkScript []byte, value int64) *wire.MsgTx {
+	tx := wire.NewMsgTx(wire.TxVersion)
+	tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{0x01}, 0), nil, nil))
+	tx.AddTxOut(wire.NewTxOut(value, pkScript))
+	return tx
+}
+
+func walletPkScript(t *testing.T, wallet *Wallet, net *chaincfg.Params) []byte {
+	t.Helper()
+	addr, err := btcutil.DecodeAddress(wallet.PublicKey, net)
+	require.NoError(t, err)
+	pkScript, err := txscript.PayToAddrScript(addr)
+	require.NoError(t, err)
+	return pkScript
+}
+
+func newTestPSBT(t *testing.T, funding []*wire.MsgTx, outValue int64) *psbt.Packet {
+	t.Helper()
+	tx := wire.NewMsgTx(2)
+	for _, f := range funding {
+		hash := f.TxHash()
+		tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&hash, 0), nil, nil))
+	}
+	recipient, err := hex.DecodeString("00140ce8d6b653c280ee0c30dd6a5feb8c42272339a1")
+	require.NoError(t, err)
+	tx.AddTxOut(wire.NewTxOut(outValue, recipient))
+
+	packet, err := psbt.NewFromUnsignedTx(tx)
+	require.NoError(t, err)
+	return packet
+}
+
+func verifyInputs(t *testing.T, tx *wire.MsgTx, prevOuts []*wire.TxOut) {
+	t.Helper()
+	fetcher := txscript.NewMultiPrevOutFetcher(nil)
+	for i, txIn := range tx.TxIn {
+		fetcher.AddPrevOut(txIn.PreviousOutPoint, prevOuts[i])
+	}
+	sigHashes := txscript.NewTxSigHashes(tx, fetcher)
+	for i := range tx.TxIn {
+		vm, err := txscript.NewEngine(prevOuts[i].PkScript, tx, i, txscript.StandardVerifyFlags, nil, sigHashes, prevOuts[i].Value, fetcher)
+		require.NoError(t, err)
+		require.NoError(t, vm.Execute(), "input %d failed to verify", i)
+	}
+}
+
+func TestSignPSBT(t *testing.T) {
+	net := &chaincfg.TestNet4Params
+	a := NewBtcAdapter(net)
+
+	wallet, err := a.DeriveWallet()
+	require.NoError(t, err)
+	ownScript := walletPkScript(t, wallet, net)
+
+	wif, err := btcutil.DecodeWIF(wallet.PrivateKey)
+	require.NoError(t, err)
+	ownP2PKH := walletScripts(wif)["p2pkh"]
+
+	foreignKey, err := btcec.NewPrivateKey()
+	require.NoError(t, err)
+	foreignScript := append([]byte{0x00, 0x14}, btcutil.Hash160(foreignKey.PubKey().SerializeCompressed())...)
+
+	t.Run("Sign and finalize own inputs - pass", func(t *testing.T) {
+		segwit := fundingTx(ownScript, 60000)
+		legacy := fundingTx(ownP2PKH, 40000)
+		packet := newTestPSBT(t, []*wire.MsgTx{segwit, legacy}, 99000)
+		packet.Inputs[0].WitnessUtxo = segwit.TxOut[0]
+		packet.Inputs[0].NonWitnessUtxo = segwit
+		packet.Inputs[1].NonWitnessUtxo = legacy
+		encoded, err := packet.B64Encode()
+		require.NoError(t, err)
+
+		result, err := a.SignPSBT(wallet, encoded, true)
+		require.NoError(t, err)
+		require.Equal(t, []int{0, 1}, result.SignedInputs)
+		require.True(t, result.Complete)
+		require.NotEmpty(t, result.Tx)
+
+		raw, err := hex.DecodeString(result.Tx)
+		require.NoError(t, err)
+		var tx wire.MsgTx
+		require.NoError(t, tx.Deserialize(bytes.NewReader(raw)))
+		verifyInputs(t, &tx, []*wire.TxOut{segwit.TxOut[0], legacy.TxOut[0]})
+	})
+
+	t.Run("Finalize with a P2WPKH output at its dust limit - pass", func(t *testing.T) {
+		funding := fundingTx(ownScript, 60000)
+		packet := newTestPSBT(t, []*wire.MsgTx{funding}, 59000-294)
+		packet.UnsignedTx.AddTxOut(wire.NewTxOut(294, foreignScript))
+		packet.Outputs = append(packet.Outputs, psbt.POutput{})
+		packet.Inputs[0].WitnessUtxo = funding.TxOut[0]
+		packet.Inputs[0].NonWitnessUtxo = funding
+		encoded, err := packet.B64Encode()
+		require.NoError(t, err)
+
+		result, err := a.SignPSBT(wallet, encoded, true)
+		require.NoError(t, err, "a 294 sat P2WPKH output is standard")
+		require.True(t, result.Complete)
+	})
+
+	t.Run("Sign only own inputs - pass", func(t *testing.T) {
+		own := fundingTx(ownScript, 60000)
+		foreign := fundingTx(foreignScript, 40000)
+		packet := newTestPSBT(t, []*wire.MsgTx{own, foreign}, 99000)
+		packet.Inputs[0].WitnessUtxo = own.TxOut[0]
+		packet.Inputs[0].NonWitnessUtxo = own
+		packet.Inputs[1].WitnessUtxo = foreign.TxOut[0]
+		encoded, err := packet.B64Encode()
+		require.NoError(t, err)
+
+		result, err := a.SignPSBT(wallet, encoded, false)
+		require.NoError(t, err)
+		require.Equal(t, []int{0}, result.SignedInputs)
+		require.False(t, result.Complete)
+		require.Empty(t, result.Tx)
+
+		signed, err := psbt.NewFromRawBytes(bytes.NewReader([]byte(result.PSBT)), true)
+		require.NoError(t, err)
+		require.Len(t, signed.Inputs[0].PartialSigs, 1)
+		require.Empty(t, signed.Inputs[1].PartialSigs)
+
+		_, err = a.SignPSBT(wallet, encoded, true)
+		require.ErrorIs(t, err, ErrInvalidPayload, "finalizing with a foreign unsigned input should fail")
+	})
+
+	t.Run("Sign and finalize taproot input - pass", func(t *testing.T) {
+		ownP2TR := walletScripts(wif)["v1_p2tr"]
+		taproot := fundingTx(ownP2TR, 70000)
+		segwit := fundingTx(ownScript, 30000)
+		packet := newTestPSBT(t, []*wire.MsgTx{taproot, segwit}, 99000)
+		packet.Inputs[0].WitnessUtxo = taproot.TxOut[0]
+		encoded, err := packet.B64Encode()
+		require.NoError(t, err)
+
+		_, err = a.SignPSBT(wallet, encoded, false)
+		require.ErrorIs(t, err, ErrInvalidPayload, "taproot signing needs every prevout")
+
+		packet.Inputs[1].WitnessUtxo = segwit.TxOut[0]
+		packet.Inputs[1].NonWitnessUtxo = segwit
+		encoded, err = packet.B64Encode()
+		require.NoError(t, err)
+
+		result, err := a.SignPSBT(wallet, encoded, true)
+		require.NoError(t, err)
+		require.Equal(t, []int{0, 1}, result.SignedInputs)
+		require.True(t, result.Complete)
+
+		raw, err := hex.DecodeString(result.Tx)
+		require.NoError(t, err)
+		var tx wire.MsgTx
+		require.NoError(t, tx.Deserialize(bytes.NewReader(raw)))
+		verifyInputs(t, &tx, []*wire.TxOut{taproot.TxOut[0], segwit.TxOut[0]})
+	})
+
+	t.Run("Sign and finalize nested segwit input - pass", func(t *testing.T) {
+		nested := fundingTx(walletScripts(wif)["p2sh_p2wpkh"], 80000)
+		packet := newTestPSBT(t, []*wire.MsgTx{nested}, 79000)
+		packet.Inputs[0].WitnessUtxo = nested.TxOut[0]
+		packet.Inputs[0].NonWitnessUtxo = nested
+		encoded, err := packet.B64Encode()
+		require.NoError(t, err)
+
+		result, err := a.SignPSBT(wallet, encoded, true)
+		require.NoError(t, err)
+		require.Equal(t, []int{0}, result.SignedInputs)
+
+		raw, err := hex.DecodeString(result.Tx)
+		require.NoError(t, err)
+		var tx wire.MsgTx
+		require.NoError(t, tx.Deserialize(bytes.NewReader(raw)))
+		verifyInputs(t, &tx, []*wire.TxOut{nested.TxOut[0]})
+	})
+
+	t.Run("Witness UTXO amount mismatch - fail", func(t *testing.T) {
+		own := fundingTx(ownScript, 60000)
+		packet := newTestPSBT(t, []*wire.MsgTx{own}, 59000)
+		packet.Inputs[0].WitnessUtxo = wire.NewTxOut(600000, ownScript)
+		packet.Inputs[0].NonWitnessUtxo = own
+		encoded, err := packet.B64Encode()
+		require.NoError(t, err)
+
+		_, err = a.SignPSBT(wallet, encoded, false)
+		require.ErrorIs(t, err, ErrInvalidPayload)
+		require.Contains(t, err.Error(), "does not match")
+	})
+
+	t.Run("Segwit input without non-witness UTXO - fail", func(t *testing.T) {
+		for _, script := range [][]byte{ownScript, walletScripts(wif)["p2sh_p2wpkh"]} {
+			own := fundingTx(script, 60000)
+			packet := newTestPSBT(t, []*wire.MsgTx{own}, 59000)
+			packet.Inputs[0].WitnessUtxo = own.TxOut[0]
+			encoded, err := packet.B64Encode()
+			require.NoError(t, err)
+
+			_, err = a.SignPSBT(wallet, encoded, false)
+			require.ErrorIs(t, err, ErrInvalidPayload)
+			require.ErrorContains(t, err, "needs a non-witness UTXO")
+		}
+	})
+
+	t.Run("Input without UTXO - fail", func(t *testing.T) {
+		own := fundingTx(ownScript, 60000)
+		foreign := fundingTx(foreignScript, 40000)
+		packet := newTestPSBT(t, []*wire.MsgTx{own, foreign}, 99000)
+		packet.Inputs[0].WitnessUtxo = own.TxOut[0]
+		packet.Inputs[0].NonWitnessUtxo = own
+		encoded, err := packet.B64Encode()
+		require.NoError(t, err)
+
+		_, err = a.SignPSBT(wallet, encoded, false)
+		require.ErrorIs(t, err, ErrInvalidPayload)
+		require.ErrorContains(t, err, "input 1 has no witness or non-witness UTXO")
+	})
+
+	t.Run("Outputs exceed inputs - fail", func(t *testing.T) {
+		own := fundingTx(ownScript, 60000)
+		packet := newTestPSBT(t, []*wire.MsgTx{own}, 70000)
+		packet.Inputs[0].NonWitnessUtxo = own
+		encoded, err := packet.B64Encode()
+		require.NoError(t, err)
+
+		_, err = a.SignPSBT(wallet, encoded, false)
+		require.ErrorIs(t, err, ErrInvalidPayload)
+		require.ErrorContains(t, err, "outputs exceed inputs by 10000 sats")
+	})
+
+	t.Run("Fee above the limits - fail", func(t *testing.T) {
+		// 100000 sats of fee for about 110 vbytes.
+		own := fundingTx(ownScript, 110000)
+		packet := newTestPSBT(t, []*wire.MsgTx{own}, 10000)
+		packet.Inputs[0].NonWitnessUtxo = own
+		encoded, err := packet.B64Encode()
+		require.NoError(t, err)
+
+		for name, tc := range map[string]struct {
+			limits BtcFeeLimits
+			error  string
+		}{
+			"fee rate": {BtcFeeLimits{MaxFeeRate: 500}, "max_fee_rate is 500 sat/vB"},
+			"fee":      {BtcFeeLimits{MaxFee: 50000}, "max_fee is 50000 sats, the fee is 100000 sats"},
+			"ratio":    {BtcFeeLimits{MaxFeeRatio: 0.5}, "max_fee_ratio is 0.5"},
+		} {
+			limited := NewBtcAdapter(net)
+			limited.SetPolicy(&Policy{FeeLimits: &tc.limits})
+			_, err = limited.SignPSBT(wallet, encoded, false)
+			require.ErrorIs(t, err, ErrCapExceeded, name)
+			require.ErrorContains(t, err, tc.error, name)
+		}
+
+		// A policy without fee limits, as with override_caps, signs it.
+		overriding := NewBtcAdapter(net)
+		overriding.SetPolicy(&Policy{})
+		_, err = overriding.SignPSBT(wallet, encoded, false)
+		require.NoError(t, err)
+	})
+
+	t.Run("No wallet inputs - fail", func(t *testing.T) {
+		foreign := fundingTx(foreignScript, 40000)
+		packet := newTestPSBT(t, []*wire.MsgTx{foreign}, 39000)
+		packet.Inputs[0].WitnessUtxo = foreign.TxOut[0]
+		encoded, err := packet.B64Encode()
+		require.NoError(t, err)
+
+		_, err = a.SignPSBT(wallet, encoded, false)
+		require.ErrorIs(t, err, ErrInvalidPayload)
+	})
+
+	t.Run("Garbage PSBT - fail", func(t *testing.T) {
+		_, err := a.SignPSBT(wallet, "bm90IGEgcHNidA==", false)
+		require.ErrorIs(t, err, ErrInvalidPayload)
+	})
+}
@@ -0,0 +1,140 @@
+package adapters
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcutil"
+)
+
+// MinRelayFeeRate is the lowest fee rate, in sat/vbyte, nodes relay by
+// default. Payments paying less would never propagate.
+const MinRelayFeeRate = 1.0
+
+// BtcFeeLimits bound the fee of a bitcoin transaction to stop a typo in a
+// fee rate from burning funds. A zero field means no limit.
+type BtcFeeLimits struct {
+	MaxFeeRate float64 `json:"max_fee_rate,omitempty"` // sat/vbyte
+	MaxFee     int64   `json:"max_fee,omitempty"`      // sats
+	// MaxFeeRatio is the highest fee as a fraction of the amount paid, e.g.
+	// 0.1 for 10%. Transactions paying no amount are not checked.
+	MaxFeeRatio float64 `json:"max_fee_ratio,omitempty"`
+}
+
+// DefaultBtcFeeLimits match Bitcoin Core's maxfeerate and maxtxfee defaults:
+// 0.1 BTC/kvB and 0.1 BTC.
+var DefaultBtcFeeLimits = BtcFeeLimits{
+	MaxFeeRate: 10000,
+	MaxFee:     10_000_000,
+}
+
+// WithDefaults returns l with its unset fee rate and fee limits taken from
+// DefaultBtcFeeLimits.
+func (l BtcFeeLimits) WithDefaults() BtcFeeLimits {
+	if l.MaxFeeRate == 0 {
+		l.MaxFeeRate = DefaultBtcFeeLimits.MaxFeeRate
+	}
+	if l.MaxFee == 0 {
+		l.MaxFee = DefaultBtcFeeLimits.MaxFee
+	}
+	return l
+}
+
+// checkRelayFeeRate checks that feeRate, in sat/vbyte, is at least the
+// minimum relay fee rate.
+func checkRelayFeeRate(feeRate float64) error {
+	if feeRate < MinRelayFeeRate {
+		return invalidField("fee_rate", "%v sat/vB is below the minimum relay fee rate of %v sat/vB", feeRate, MinRelayFeeRate)
+	}
+	return nil
+}
+
+// checkFeeRate checks feeRate, in sat/vbyte, against the fee rate limit.
+func (l *BtcFeeLimits) checkFeeRate(feeRate float64) error {
+	if l != nil && l.MaxFeeRate != 0 && feeRate > l.MaxFeeRate {
+		return fmt.Errorf("%w: max_fee_rate is %v sat/vB, fee_rate is %v sat/vB", ErrCapExceeded, l.MaxFeeRate, feeRate)
+	}
+	return nil
+}
+
+// checkAbsoluteFee checks that an absolute fee for vsize vbytes pays at least
+// the minimum relay fee rate and no more than the fee rate limit.
+func (l *BtcFeeLimits) checkAbsoluteFee(fee int64, vsize int) error {
+	feeRate := float64(fee) / float64(vsize)
+	if feeRate < MinRelayFeeRate {
+		return invalidField("absolute_fee", "%d sats for %d vbytes is %.2f sat/vB, below the minimum relay fee rate of %v sat/vB", fee, vsize, feeRate, MinRelayFeeRate)
+	}
+	if l != nil && l.MaxFeeRate != 0 && feeRate > l.MaxFeeRate {
+		return fmt.Errorf("%w: max_fee_rate is %v sat/vB, absolute_fee pays %.2f sat/vB", ErrCapExceeded, l.MaxFeeRate, feeRate)
+	}
+	return nil
+}
+
+// checkFee checks the fee of a transaction paying amount against the
+// absolute and relative fee limits.
+func (l *BtcFeeLimits) checkFee(fee, amount int64) error {
+	if l == nil {
+		return nil
+	}
+	if l.MaxFee != 0 && fee > l.MaxFee {
+		return fmt.Errorf("%w: max_fee is %d sats, the fee is %d sats", ErrCapExceeded, l.MaxFee, fee)
+	}
+	if l.MaxFeeRatio != 0 && amount > 0 && float64(fee) > l.MaxFeeRatio*float64(amount) {
+		return fmt.Errorf("%w: max_fee_ratio is %v, the fee of %d sats is %.4f of the %d sats paid", ErrCapExceeded, l.MaxFeeRatio, fee, float64(fee)/float64(amount), amount)
+	}
+	return nil
+}
+
+// feeLimits returns the fee limits of the signing policy. Without a policy the
+// default limits apply; a policy without limits only keeps the minimum relay
+// fee rate.
+func (a *btcAdapter) feeLimits() *BtcFeeLimits {
+	if a.policy == nil {
+		return &DefaultBtcFeeLimits
+	}
+	return a.policy.FeeLimits
+}
+
+// checkUtxos checks that utxos spend distinct outpoints with values that,
+// alone and together, are positive and within the 21M BTC supply.
+func checkUtxos(utxos []UTXO) error {
+	seen := make(map[string]int, len(utxos))
+	var total int64
+	for i, utxo := range utxos {
+		field := fmt.Sprintf("utxos[%d]", i)
+		if utxo.Value <= 0 {
+			return invalidField(field+".value", "must be positive")
+		}
+		if utxo.Value > btcutil.MaxSatoshi {
+			return invalidField(field+".value", "%d exceeds the %d sats in existence", utxo.Value, int64(btcutil.MaxSatoshi))
+		}
+		outpoint := fmt.Sprintf("%s:%d", strings.ToLower(utxo.Txid), utxo.Vout)
+		if j, ok := seen[outpoint]; ok {
+			return invalidField(field, "spends %s like utxos[%d]", outpoint, j)
+		}
+		seen[outpoint] = i
+		// Each value is at most MaxSatoshi, so checking the running total
+		// keeps it from overflowing.
+		total += utxo.Value
+		if total > btcutil.MaxSatoshi {
+			return invalidField("utxos", "total value exceeds the %d sats in existence", int64(btcutil.MaxSatoshi))
+		}
+	}
+	return nil
+}
+
+// checkAmounts checks that the payment amounts add up to at most the 21M BTC
+// supply and returns their sum.
+func checkAmounts(outputs []BtcOutput) (int64, error) {
+	var amount int64
+	for i, output := range outputs {
+		if output.Amount > btcutil.MaxSatoshi {
+			return 0, invalidField(fmt.Sprintf("outputs[%d].amount", i), "%d exceeds the %d sats in existence", output.Amount, int64(btcutil.MaxSatoshi))
+		}
+		amount += output.Amount
+		if amount > btcutil.MaxSatoshi {
+			return 0, invalidField("outputs", "total amount exceeds the %d sats in existence", int64(btcutil.MaxSatoshi))
+		}
+	}
+	return amount, nil
+}
@@ -0,0 +1,111 @@
+package adapters
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateSignedTransaction_Sanity(t *testing.T) {
+	a := NewBtcAdapter(&chaincfg.TestNet4Params)
+	wallet, err := a.DeriveWallet()
+	require.NoError(t, err)
+	wif, err := btcutil.DecodeWIF(wallet.PrivateKey)
+	require.NoError(t, err)
+	script := hex.EncodeToString(walletScripts(wif)["v0_p2wpkh"])
+
+	utxo := func(vout uint32, value int64) UTXO {
+		return UTXO{Txid: strings.Repeat("ab", 32), Vout: vout, Value: value, ScriptPubKey: script, ScriptPubKeyType: "v0_p2wpkh"}
+	}
+	sign := func(payload BtcPayload) error {
+		if payload.Recipient == "" && payload.Outputs == nil {
+			payload.Recipient, payload.Amount = "tb1qpn5dddjnc2qwurpsm449l6uvggnjxwsetrnksx", 100000
+		}
+		if payload.FeeRate == 0 {
+			payload.FeeRate = 2
+		}
+		payloadJSON, err := json.Marshal(payload)
+		require.NoError(t, err)
+		_, err = a.CreateSignedTransaction(wallet, string(payloadJSON))
+		return err
+	}
+
+	t.Run("Sane payment - pass", func(t *testing.T) {
+		require.NoError(t, sign(BtcPayload{Utxos: []UTXO{utxo(0, 200000), utxo(1, 50000)}}))
+	})
+
+	t.Run("Invalid inputs - fail", func(t *testing.T) {
+		for name, tc := range map[string]struct {
+			utxos []UTXO
+			field string
+		}{
+			"duplicate outpoint": {[]UTXO{utxo(0, 200000), utxo(1, 1000), utxo(0, 200000)}, "utxos[2]: spends"},
+			"zero value":         {[]UTXO{utxo(0, 0)}, "utxos[0].value"},
+			"negative value":     {[]UTXO{utxo(0, 200000), utxo(1, -100000)}, "utxos[1].value"},
+			"above supply":       {[]UTXO{utxo(0, btcutil.MaxSatoshi+1)}, "utxos[0].value"},
+			"total above supply": {[]UTXO{utxo(0, btcutil.MaxSatoshi), utxo(1, btcutil.MaxSatoshi)}, "utxos: total"},
+		} {
+			err := sign(BtcPayload{Utxos: tc.utxos})
+			require.ErrorIs(t, err, ErrInvalidPayload, name)
+			require.ErrorContains(t, err, tc.field, name)
+		}
+
+		// Txids are hex, so case does not make two outpoints distinct.
+		upper := utxo(0, 200000)
+		upper.Txid = strings.ToUpper(upper.Txid)
+		require.ErrorContains(t, sign(BtcPayload{Utxos: []UTXO{utxo(0, 200000), upper}}), "utxos[1]: spends")
+	})
+
+	t.Run("Amounts above supply - fail", func(t *testing.T) {
+		err := sign(BtcPayload{
+			Outputs: []BtcOutput{
+				{Address: "tb1qpn5dddjnc2qwurpsm449l6uvggnjxwsetrnksx", Amount: btcutil.MaxSatoshi},
+				{Address: "tb1qpn5dddjnc2qwurpsm449l6uvggnjxwsetrnksx", Amount: btcutil.MaxSatoshi},
+			},
+			Utxos: []UTXO{utxo(0, 200000)},
+		})
+		require.ErrorIs(t, err, ErrInvalidPayload)
+		require.ErrorContains(t, err, "outputs: total amount")
+	})
+
+	t.Run("Fee rate below minimum relay - fail", func(t *testing.T) {
+		err := sign(BtcPayload{FeeRate: 0.5, Utxos: []UTXO{utxo(0, 200000)}})
+		require.ErrorIs(t, err, ErrInvalidPayload)
+		require.ErrorContains(t, err, "minimum relay fee rate")
+	})
+
+	t.Run("Default fee limits - fail", func(t *testing.T) {
+		err := sign(BtcPayload{FeeRate: 100000, Utxos: []UTXO{utxo(0, 20_000_000)}})
+		require.ErrorIs(t, err, ErrCapExceeded)
+		require.ErrorContains(t, err, "max_fee_rate")
+
+		// 5000 sat/vB is under the rate limit, but spending 200 inputs takes
+		// over 13000 vbytes and so more than 0.1 BTC.
+		utxos := make([]UTXO, 200)
+		for i := range utxos {
+			utxos[i] = utxo(uint32(i), 1_000_000)
+		}
+		err = sign(BtcPayload{FeeRate: 5000, Utxos: utxos})
+		require.ErrorIs(t, err, ErrCapExceeded)
+		require.ErrorContains(t, err, "max_fee is 10000000")
+	})
+
+	t.Run("Policy fee limits - pass", func(t *testing.T) {
+		a.SetPolicy(&Policy{FeeLimits: &BtcFeeLimits{MaxFeeRatio: 0.01}})
+		defer a.SetPolicy(nil)
+
+		err := sign(BtcPayload{FeeRate: 20, Utxos: []UTXO{utxo(0, 200000)}})
+		require.ErrorIs(t, err, ErrCapExceeded)
+		require.ErrorContains(t, err, "max_fee_ratio")
+		require.NoError(t, sign(BtcPayload{FeeRate: 5, Utxos: []UTXO{utxo(0, 200000)}}), "the fee at 5 sat/vB is under 1% of the amount")
+
+		a.SetPolicy(&Policy{})
+		require.NoError(t, sign(BtcPayload{FeeRate: 100000, Utxos: []UTXO{utxo(0, 20_000_000)}}), "a policy without limits keeps only the relay minimum")
+		require.ErrorContains(t, sign(BtcPayload{FeeRate: 0.5, Utxos: []UTXO{utxo(0, 200000)}}), "minimum relay fee rate")
+	})
+}
@@ -0,0 +1,75 @@
+package adapters
+
+import (
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/txscript"
+)
+
+// checkSendMax checks that a send_max payload makes a single payment whose
+// amount is left for the plugin to compute, and no change.
+func (p *BtcPayload) checkSendMax(outputs []BtcOutput) error {
+	switch {
+	case len(outputs) != 1:
+		return invalidField("send_max", "needs exactly one recipient, got %d", len(outputs))
+	case outputs[0].Amount != 0:
+		return invalidField("amount", "is computed with send_max and must be left out")
+	case p.CoinSelection != "":
+		return invalidField("send_max", "spends every UTXO and cannot be combined with coin_selection")
+	case p.ChangeAddress != "" || p.ChangeType != "" || p.ChangePath != "":
+		return invalidField("send_max", "makes no change and cannot be combined with change_address, change_type or change_path")
+	case len(p.Utxos) == 0:
+		return invalidField("utxos", "send_max needs at least one UTXO")
+	}
+	return nil
+}
+
+// sendMaxOutputs returns the payment of a send_max payload, checked by
+// payments: everything utxos hold, less the fee at feeRate, to its single
+// recipient. A non-zero absoluteFee replaces feeRate. Payloads without
+// send_max keep their outputs and get no FeeInfo.
+func (a *btcAdapter) sendMaxOutputs(payload *BtcPayload, outputs []BtcOutput, nullData [][]byte, utxos []UTXO, feeRate float64, absoluteFee int64) ([]BtcOutput, *FeeInfo, error) {
+	if !payload.SendMax {
+		return outputs, nil, nil
+	}
+	if absoluteFee == 0 {
+		if err := checkRelayFeeRate(feeRate); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	destType, err := a.getOutputType(outputs[0].Address)
+	if err != nil {
+		return nil, nil, invalidField("outputs[0].address", "%v", err)
+	}
+	destAddr, err := btcutil.DecodeAddress(outputs[0].Address, a.net)
+	if err != nil {
+		return nil, nil, invalidField("outputs[0].address", "%v", err)
+	}
+	destScript, err := txscript.PayToAddrScript(destAddr)
+	if err != nil {
+		return nil, nil, invalidField("outputs[0].address", "%v", err)
+	}
+	var total int64
+	inputTypes := make([]string, 0, len(utxos))
+	for _, utxo := range utxos {
+		total += utxo.Value
+		inputTypes = append(inputTypes, utxo.ScriptPubKeyType)
+	}
+
+	feeInfo, err := CalculateFee(FeeParams{
+		InputTypes:    inputTypes,
+		OutputTypes:   []string{destType},
+		NullDataSizes: nullDataSizes(nullData),
+		TotalInput:    total,
+		FeeRate:       feeRate,
+		AbsoluteFee:   absoluteFee,
+		SendMax:       true,
+	})
+	if err != nil {
+		return nil, nil, invalidField("utxos", "%v", err)
+	}
+	if limit := dustLimit(destScript); feeInfo.SendAmount < limit {
+		return nil, nil, invalidField("send_max", "the %d sats of the UTXOs less the %d sat fee leave %d, below the dust threshold of %d", total, feeInfo.EstimatedFee, feeInfo.SendAmount, limit)
+	}
+	return []BtcOutput{{Address: outputs[0].Address, Amount: feeInfo.SendAmount}}, feeInfo, nil
+}
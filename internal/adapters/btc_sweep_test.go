@@ -0,0 +1,119 @@
+package adapters
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/mempool"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateSignedTransaction_SendMax(t *testing.T) {
+	a := NewBtcAdapter(&chaincfg.TestNet4Params)
+	wallet, err := a.DeriveWallet()
+	require.NoError(t, err)
+	wif, err := btcutil.DecodeWIF(wallet.PrivateKey)
+	require.NoError(t, err)
+	script := walletScripts(wif)["v0_p2wpkh"]
+
+	utxos := []UTXO{
+		{Txid: "7171717171717171717171717171717171717171717171717171717171717171", Vout: 0, Value: 120000, ScriptPubKey: hex.EncodeToString(script), ScriptPubKeyType: "v0_p2wpkh"},
+		{Txid: "7272727272727272727272727272727272727272727272727272727272727272", Vout: 3, Value: 35000, ScriptPubKey: hex.EncodeToString(script), ScriptPubKeyType: "v0_p2wpkh"},
+	}
+	recipient := "tb1pqqqqp399et2xygdj5xreqhjjvcmzhxw4aywxecjdzew6hylgvsesf3hn0c"
+	payloadJSON := func(payload BtcPayload) string {
+		if payload.Recipient == "" && payload.Outputs == nil {
+			payload.Recipient = recipient
+		}
+		if payload.Utxos == nil {
+			payload.Utxos = utxos
+		}
+		payload.SendMax = true
+		b, err := json.Marshal(payload)
+		require.NoError(t, err)
+		return string(b)
+	}
+
+	t.Run("Sweep every UTXO - pass", func(t *testing.T) {
+		payload := payloadJSON(BtcPayload{FeeRate: 3})
+		result, err := a.CreateSignedTransactionDetailed(wallet, payload)
+		require.NoError(t, err)
+		tx, err := decodeTx("tx", result.Tx)
+		require.NoError(t, err)
+
+		require.Len(t, tx.TxIn, 2)
+		require.Len(t, tx.TxOut, 1, "no change output")
+		fee := result.Details["fee"].(int64)
+		require.Equal(t, int64(155000)-fee, tx.TxOut[0].Value)
+		require.Equal(t, tx.TxOut[0].Value, result.Details["amount"])
+		vsize := mempool.GetTxVirtualSize(btcutil.NewTx(tx))
+		require.GreaterOrEqual(t, fee, 3*vsize)
+		require.Less(t, fee, 3*(vsize+2), "the fee is exact, not padded")
+		verifyInputs(t, tx, []*wire.TxOut{wire.NewTxOut(120000, script), wire.NewTxOut(35000, script)})
+
+		estimate, err := a.EstimateFee(wallet, payload)
+		require.NoError(t, err)
+		require.Equal(t, fee, estimate.EstimatedFee)
+		require.Equal(t, tx.TxOut[0].Value, estimate.SendAmount)
+		require.Equal(t, int64(0), estimate.ChangeValue)
+	})
+
+	t.Run("Sweep with data - pass", func(t *testing.T) {
+		result, err := a.CreateSignedTransactionDetailed(wallet, payloadJSON(BtcPayload{
+			FeeRate:  2,
+			OpReturn: []BtcOpReturn{{Text: "sweep 2026-10-18"}},
+		}))
+		require.NoError(t, err)
+		tx, err := decodeTx("tx", result.Tx)
+		require.NoError(t, err)
+		require.Len(t, tx.TxOut, 2)
+		require.Equal(t, int64(0), tx.TxOut[1].Value)
+		require.Equal(t, int64(155000)-result.Details["fee"].(int64), tx.TxOut[0].Value)
+	})
+
+	t.Run("Bump a sweep - pass", func(t *testing.T) {
+		payload := payloadJSON(BtcPayload{FeeRate: 2, RBF: true})
+		original, err := a.CreateSignedTransactionDetailed(wallet, payload)
+		require.NoError(t, err)
+
+		result, err := a.BumpFee(wallet, payload, original.Tx, 6)
+		require.NoError(t, err)
+		replacement, err := decodeTx("tx", result.Tx)
+		require.NoError(t, err)
+		require.Len(t, replacement.TxOut, 1)
+		require.Greater(t, result.Details["fee"].(int64), original.Details["fee"].(int64))
+		require.Equal(t, int64(155000)-result.Details["fee"].(int64), replacement.TxOut[0].Value, "the payment pays the extra fee")
+	})
+
+	t.Run("Sweep leaves dust - fail", func(t *testing.T) {
+		_, err := a.CreateSignedTransaction(wallet, payloadJSON(BtcPayload{FeeRate: 5, Utxos: utxos[1:]}))
+		require.NoError(t, err)
+
+		_, err = a.CreateSignedTransaction(wallet, payloadJSON(BtcPayload{FeeRate: 5000, Utxos: utxos[:1]}))
+		require.ErrorIs(t, err, ErrInvalidPayload)
+		require.ErrorContains(t, err, "below the dust threshold")
+	})
+
+	t.Run("Invalid send max payload - fail", func(t *testing.T) {
+		for name, tc := range map[string]struct {
+			payload BtcPayload
+			message string
+		}{
+			"amount":         {BtcPayload{Amount: 1000}, "amount: is computed"},
+			"two recipients": {BtcPayload{Outputs: []BtcOutput{{Address: recipient}, {Address: recipient}}}, "exactly one recipient"},
+			"no recipient":   {BtcPayload{Outputs: []BtcOutput{}, OpReturn: []BtcOpReturn{{Text: "a"}}}, "exactly one recipient"},
+			"coin selection": {BtcPayload{CoinSelection: CoinSelectionBnB}, "coin_selection"},
+			"change type":    {BtcPayload{ChangeType: AddressTypeP2TR}, "change_address, change_type or change_path"},
+			"no utxos":       {BtcPayload{Utxos: []UTXO{}}, "at least one UTXO"},
+		} {
+			tc.payload.FeeRate = 2
+			_, err := a.CreateSignedTransaction(wallet, payloadJSON(tc.payload))
+			require.ErrorIs(t, err, ErrInvalidPayload, name)
+			require.ErrorContains(t, err, tc.message, name)
+		}
+	})
+}
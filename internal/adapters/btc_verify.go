@@ -0,0 +1,72 @@
+package adapters
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// ErrTxVerification is returned when a transaction the adapter signed fails
+// its own checks. It points at a bug in building or signing the transaction,
+// not at the payload, and the transaction is never returned.
+var ErrTxVerification = errors.New("signed transaction failed verification")
+
+// maxStandardTxWeight is the heaviest transaction nodes relay by default.
+const maxStandardTxWeight = 400_000
+
+// verifySignedTx checks tx before it is handed out: it must be a sane,
+// standard transaction without outputs below the dust limit of their script
+// that spends no more than its
+// inputs, and every input's script must execute successfully against the
+// output it spends in prevOuts.
+func verifySignedTx(tx *wire.MsgTx, prevOuts txscript.PrevOutputFetcher) error {
+	if err := blockchain.CheckTransactionSanity(btcutil.NewTx(tx)); err != nil {
+		return fmt.Errorf("%w: %v", ErrTxVerification, err)
+	}
+	if weight := blockchain.GetTransactionWeight(btcutil.NewTx(tx)); weight > maxStandardTxWeight {
+		return fmt.Errorf("%w: weight %d exceeds the standard limit of %d", ErrTxVerification, weight, maxStandardTxWeight)
+	}
+	var fee int64
+	for i, txOut := range tx.TxOut {
+		fee -= txOut.Value
+		class := txscript.GetScriptClass(txOut.PkScript)
+		switch {
+		case class == txscript.NonStandardTy:
+			return fmt.Errorf("%w: output %d has a non-standard script", ErrTxVerification, i)
+		case class == txscript.NullDataTy:
+			if txOut.Value != 0 {
+				return fmt.Errorf("%w: OP_RETURN output %d burns %d sats", ErrTxVerification, i, txOut.Value)
+			}
+		case txOut.Value < dustLimit(txOut.PkScript):
+			return fmt.Errorf("%w: output %d pays %d, below the dust threshold of %d", ErrTxVerification, i, txOut.Value, dustLimit(txOut.PkScript))
+		}
+	}
+
+	spent := make([]*wire.TxOut, len(tx.TxIn))
+	for i, txIn := range tx.TxIn {
+		spent[i] = prevOuts.FetchPrevOutput(txIn.PreviousOutPoint)
+		if spent[i] == nil {
+			return fmt.Errorf("%w: input %d spends unknown output %s", ErrTxVerification, i, txIn.PreviousOutPoint)
+		}
+		fee += spent[i].Value
+	}
+	if fee < 0 {
+		return fmt.Errorf("%w: outputs exceed inputs by %d sats", ErrTxVerification, -fee)
+	}
+
+	sigHashes := txscript.NewTxSigHashes(tx, prevOuts)
+	for i, prevOut := range spent {
+		vm, err := txscript.NewEngine(prevOut.PkScript, tx, i, txscript.StandardVerifyFlags, nil, sigHashes, prevOut.Value, prevOuts)
+		if err != nil {
+			return fmt.Errorf("%w: input %d: %v", ErrTxVerification, i, err)
+		}
+		if err := vm.Execute(); err != nil {
+			return fmt.Errorf("%w: input %d spending %s: %v", ErrTxVerification, i, tx.TxIn[i].PreviousOutPoint, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package adapters
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifySignedTx(t *testing.T) {
+	net := &chaincfg.TestNet4Params
+	a := NewBtcAdapter(net)
+
+	wallet, err := a.DeriveWallet()
+	require.NoError(t, err)
+	wif, err := btcutil.DecodeWIF(wallet.PrivateKey)
+	require.NoError(t, err)
+	script := walletScripts(wif)["v0_p2wpkh"]
+
+	utxos := []UTXO{
+		{Txid: "f1f1f1f1f1f1f1f1f1f1f1f1f1f1f1f1f1f1f1f1f1f1f1f1f1f1f1f1f1f1f1f1", Vout: 0, Value: 80000, ScriptPubKey: hex.EncodeToString(script), ScriptPubKeyType: "v0_p2wpkh"},
+		{Txid: "f2f2f2f2f2f2f2f2f2f2f2f2f2f2f2f2f2f2f2f2f2f2f2f2f2f2f2f2f2f2f2f2", Vout: 3, Value: 40000, ScriptPubKey: hex.EncodeToString(script), ScriptPubKeyType: "v0_p2wpkh"},
+	}
+	outputs := []BtcOutput{{Address: "tb1qpn5dddjnc2qwurpsm449l6uvggnjxwsetrnksx", Amount: 100000}}
+	signed := func(t *testing.T) (*wire.MsgTx, *txscript.MultiPrevOutFetcher) {
+		t.Helper()
+		tx, err := a.NewTxWithInputsAndOutputs(wif, AddressTypeP2WPKH, outputs, utxos, 2)
+		require.NoError(t, err)
+		prevOuts := txscript.NewMultiPrevOutFetcher(nil)
+		for i, utxo := range utxos {
+			prevOuts.AddPrevOut(tx.TxIn[i].PreviousOutPoint, wire.NewTxOut(utxo.Value, script))
+		}
+		return tx, prevOuts
+	}
+
+	t.Run("Signed transaction - pass", func(t *testing.T) {
+		tx, prevOuts := signed(t)
+		require.NoError(t, verifySignedTx(tx, prevOuts))
+	})
+
+	t.Run("Output changed after signing - fail", func(t *testing.T) {
+		tx, prevOuts := signed(t)
+		tx.TxOut[0].Value--
+		err := verifySignedTx(tx, prevOuts)
+		require.ErrorIs(t, err, ErrTxVerification)
+		require.ErrorContains(t, err, "input 0")
+	})
+
+	t.Run("Signed for another input value - fail", func(t *testing.T) {
+		tx, prevOuts := signed(t)
+		prevOuts.AddPrevOut(tx.TxIn[1].PreviousOutPoint, wire.NewTxOut(utxos[1].Value+1, script))
+		err := verifySignedTx(tx, prevOuts)
+		require.ErrorIs(t, err, ErrTxVerification)
+		require.ErrorContains(t, err, "input 1")
+	})
+
+	t.Run("Missing witness - fail", func(t *testing.T) {
+		tx, prevOuts := signed(t)
+		tx.TxIn[1].Witness = nil
+		require.ErrorIs(t, verifySignedTx(tx, prevOuts), ErrTxVerification)
+	})
+
+	t.Run("Unknown prevout - fail", func(t *testing.T) {
+		tx, _ := signed(t)
+		err := verifySignedTx(tx, txscript.NewMultiPrevOutFetcher(nil))
+		require.ErrorIs(t, err, ErrTxVerification)
+		require.ErrorContains(t, err, "unknown output")
+	})
+
+	t.Run("Outputs at their dust limit - pass", func(t *testing.T) {
+		p2tr, err := walletAddress(wif, AddressTypeP2TR, net)
+		require.NoError(t, err)
+		p2wsh, err := btcutil.NewAddressWitnessScriptHash(bytes.Repeat([]byte{0x11}, 32), net)
+		require.NoError(t, err)
+		p2pkh, err := btcutil.NewAddressPubKeyHash(btcutil.Hash160(wif.SerializePubKey()), net)
+		require.NoError(t, err)
+
+		payments := []BtcOutput{
+			{Address: outputs[0].Address, Amount: 294},
+			{Address: p2tr.EncodeAddress(), Amount: 330},
+			{Address: p2wsh.EncodeAddress(), Amount: 330},
+			{Address: p2pkh.EncodeAddress(), Amount: 546},
+		}
+		tx, err := a.NewTxWithInputsAndOutputs(wif, AddressTypeP2WPKH, payments, utxos, 2)
+		require.NoError(t, err, "verified with each output at the dust limit of its script")
+		for i, payment := range payments {
+			require.Equal(t, payment.Amount, dustLimit(tx.TxOut[i].PkScript))
+		}
+	})
+
+	t.Run("Non-standard transaction - fail", func(t *testing.T) {
+		for name, tc := range map[string]struct {
+			tamper  func(tx *wire.MsgTx)
+			message string
+		}{
+			"dust output": {func(tx *wire.MsgTx) {
+				tx.AddTxOut(wire.NewTxOut(293, script))
+			}, "pays 293, below the dust threshold of 294"},
+			"non-standard script": {func(tx *wire.MsgTx) {
+				tx.AddTxOut(wire.NewTxOut(1000, []byte{txscript.OP_TRUE}))
+			}, "non-standard script"},
+			"burning op_return": {func(tx *wire.MsgTx) {
+				nullData, err := txscript.NullDataScript([]byte("burn"))
+				require.NoError(t, err)
+				tx.AddTxOut(wire.NewTxOut(1000, nullData))
+			}, "burns 1000 sats"},
+			"outputs exceed inputs": {func(tx *wire.MsgTx) {
+				tx.AddTxOut(wire.NewTxOut(50000, script))
+			}, "outputs exceed inputs"},
+			"duplicate input": {func(tx *wire.MsgTx) {
+				tx.AddTxIn(wire.NewTxIn(&tx.TxIn[0].PreviousOutPoint, nil, nil))
+			}, "duplicate"},
+			"oversized": {func(tx *wire.MsgTx) {
+				for range maxStandardTxWeight / 4 / 31 {
+					tx.AddTxOut(wire.NewTxOut(dustThreshold, script))
+				}
+			}, "exceeds the standard limit"},
+		} {
+			tx, prevOuts := signed(t)
+			tc.tamper(tx)
+			err := verifySignedTx(tx, prevOuts)
+			require.ErrorIs(t, err, ErrTxVerification, name)
+			require.ErrorContains(t, err, tc.message, name)
+		}
+	})
+
+}
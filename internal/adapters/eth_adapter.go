@@ -3,10 +3,11 @@ package adapters
 import (
 	"crypto/ecdsa"
 	"encoding/hex"
-	"encoding/json"
 	"fmt"
 	"math/big"
+	"strings"
 
+	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core/types"
@@ -22,20 +23,43 @@ type EthPayload struct {
 	GasLimit uint64 `json:"gas"`
 	GasPrice uint64 `json:"gasPrice"`
 	Nonce    uint64 `json:"nonce"`
+
+	// AllowZeroAddress must be set to send to 0x000...0, which is almost
+	// always a mistake.
+	AllowZeroAddress bool `json:"allowZeroAddress,omitempty"`
+	// Path signs with the key of the wallet's HD account at
+	// "<chain>/<index>", e.g. "0/1" for the account's second address,
+	// instead of the wallet key.
+	Path string `json:"path,omitempty"`
+
+	data []byte // Data, decoded by validatePayload
 }
 
 type ethereumAdapter struct {
+	policy *Policy
 }
 
 func NewEthAdapter() *ethereumAdapter {
 	return &ethereumAdapter{}
 }
 
+func (a *ethereumAdapter) SetPolicy(policy *Policy) {
+	a.policy = policy
+}
+
+// ethCoinType is the SLIP-44 coin type of ether.
+const ethCoinType = 60
+
+// DeriveWallet creates a wallet whose key is the first receive key of a new
+// HD account at m/44'/60'/0', the path wallets such as MetaMask derive from.
+// The wallet keeps the account key, so transactions can also be signed by the
+// account's other addresses.
 func (a *ethereumAdapter) DeriveWallet() (*Wallet, error) {
-	privateKey, err := crypto.GenerateKey()
+	account, accountKey, hdKey, err := deriveHDAccount(&chaincfg.MainNetParams, 44, ethCoinType, 0)
 	if err != nil {
 		return nil, err
 	}
+	privateKey := hdKey.ToECDSA()
 	privateKeyBytes := crypto.FromECDSA(privateKey)
 
 	publicKey := privateKey.Public()
@@ -48,17 +72,42 @@ func (a *ethereumAdapter) DeriveWallet() (*Wallet, error) {
 	return &Wallet{
 		PrivateKey: hexutil.Encode(privateKeyBytes)[2:],
 		PublicKey:  crypto.PubkeyToAddress(*publicKeyECDSA).Hex(),
+		Account:    account,
+		AccountKey: accountKey,
 	}, nil
 }
 
+// ExportAccount returns the public data of the wallet's HD account. Its
+// account key is an xpub, as ethereum has no extended key versions of its
+// own.
+func (a *ethereumAdapter) ExportAccount(wallet *Wallet) (*AccountExport, error) {
+	if wallet.Account == nil {
+		return nil, ErrNoHDAccount
+	}
+	return &AccountExport{HDAccount: *wallet.Account}, nil
+}
+
 func (a *ethereumAdapter) validatePayload(jsonPayload string) (*EthPayload, error) {
 	var payload EthPayload
-	if err := json.Unmarshal([]byte(jsonPayload), &payload); err != nil {
-		return nil, fmt.Errorf("failed to decode payload: %w", err)
+	if err := decodePayload(jsonPayload, &payload); err != nil {
+		return nil, err
+	}
+
+	if payload.ChainID == 0 {
+		return nil, invalidField("chainId", "must be nonzero; a chain ID of 0 produces a replayable signature")
+	}
+	if err := validateAddress("to", payload.To); err != nil {
+		return nil, err
+	}
+	if common.HexToAddress(payload.To) == (common.Address{}) && !payload.AllowZeroAddress {
+		return nil, invalidField("to", "is the zero address; set allowZeroAddress to send to it")
 	}
-	if payload.To == "" {
-		return nil, fmt.Errorf("payload must contain 'to' field")
+
+	data, err := decodeHexData(payload.Data)
+	if err != nil {
+		return nil, invalidField("data", "%v", err)
 	}
+	payload.data = data
 
 	if payload.GasLimit == 0 {
 		payload.GasLimit = 21000 // Default gas limit for a simple transaction
@@ -69,32 +118,42 @@ func (a *ethereumAdapter) validatePayload(jsonPayload string) (*EthPayload, erro
 	return &payload, nil
 }
 
+func (a *ethereumAdapter) checkCaps(payload *EthPayload) error {
+	if a.policy == nil || a.policy.Caps == nil {
+		return nil
+	}
+	caps, err := a.policy.Caps(payload.ChainID)
+	if err != nil {
+		return fmt.Errorf("failed to load safety caps: %w", err)
+	}
+	for _, c := range caps {
+		if err := c.Check(payload); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (a *ethereumAdapter) CreateSignedTransaction(wallet *Wallet, payload string) (string, error) {
 
 	ethPayload, err := a.validatePayload(payload)
 	if err != nil {
 		return "", err
 	}
+	if err := a.checkCaps(ethPayload); err != nil {
+		return "", err
+	}
 
-	privateKey, err := crypto.HexToECDSA(wallet.PrivateKey)
+	privateKey, err := signingKey(wallet, ethPayload.Path)
 	if err != nil {
-		return "", fmt.Errorf("failed to convert private key: %w", err)
+		return "", err
 	}
 
 	value := new(big.Int).SetUint64(ethPayload.Value)
 
 	gasPrice := new(big.Int).SetUint64(ethPayload.GasPrice)
 
-	// data is in hex, load hex as bytes
-	data := make([]byte, 0)
-	if ethPayload.Data != "" {
-		data, err = hex.DecodeString(ethPayload.Data[2:]) // Remove '0x' prefix
-		if err != nil {
-			return "", fmt.Errorf("failed to decode data: %w", err)
-		}
-
-	}
-	tx := types.NewTransaction(ethPayload.Nonce, common.HexToAddress(ethPayload.To), value, ethPayload.GasLimit, gasPrice, data)
+	tx := types.NewTransaction(ethPayload.Nonce, common.HexToAddress(ethPayload.To), value, ethPayload.GasLimit, gasPrice, ethPayload.data)
 
 	chainID := new(big.Int).SetUint64(ethPayload.ChainID)
 	signedTx, err := types.SignTx(tx, types.NewEIP155Signer(chainID), privateKey)
@@ -109,3 +168,49 @@ func (a *ethereumAdapter) CreateSignedTransaction(wallet *Wallet, payload string
 
 	return rawTxHex, nil
 }
+
+// signingKey returns the wallet key, or the key of the wallet's HD account at
+// path when one is given.
+func signingKey(wallet *Wallet, path string) (*ecdsa.PrivateKey, error) {
+	if path == "" {
+		privateKey, err := crypto.HexToECDSA(wallet.PrivateKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert private key: %w", err)
+		}
+		return privateKey, nil
+	}
+	hdKey, err := wallet.ChildKey(&chaincfg.MainNetParams, path)
+	if err != nil {
+		return nil, invalidField("path", "%v", err)
+	}
+	return hdKey.ToECDSA(), nil
+}
+
+// validateAddress accepts a 0x-prefixed address that is either all lowercase
+// or correctly EIP-55 checksummed.
+func validateAddress(field, address string) error {
+	if address == "" {
+		return invalidField(field, "is required")
+	}
+	if !strings.HasPrefix(address, "0x") || !common.IsHexAddress(address) {
+		return invalidField(field, "%q is not a 0x-prefixed 20 byte hex address", address)
+	}
+	if address != strings.ToLower(address) && address != common.HexToAddress(address).Hex() {
+		return invalidField(field, "%q has an invalid EIP-55 checksum", address)
+	}
+	return nil
+}
+
+// decodeHexData decodes hex with or without a 0x prefix. An empty string or a
+// bare "0x" is empty data.
+func decodeHexData(data string) ([]byte, error) {
+	data = strings.TrimPrefix(data, "0x")
+	if len(data)%2 != 0 {
+		return nil, fmt.Errorf("hex data has odd length %d", len(data))
+	}
+	decoded, err := hex.DecodeString(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid hex data: %w", err)
+	}
+	return decoded, nil
+}
@@ -0,0 +1,150 @@
+package adapters
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEthValidatePayload(t *testing.T) {
+	a := NewEthAdapter()
+
+	cases := []struct {
+		Name    string
+		Payload string
+		Field   string // offending field; empty means the payload is valid
+	}{
+		{
+			Name:    "Checksummed address",
+			Payload: `{"chainId": 1, "to": "0x337610d27c682E347C9cD60BD4b3b107C9d34dDd"}`,
+		},
+		{
+			Name:    "Lowercase address and unprefixed data",
+			Payload: `{"chainId": 1, "to": "0x337610d27c682e347c9cd60bd4b3b107c9d34ddd", "data": "a9059cbb"}`,
+		},
+		{
+			Name:    "Bare 0x data",
+			Payload: `{"chainId": 1, "to": "0x337610d27c682e347c9cd60bd4b3b107c9d34ddd", "data": "0x"}`,
+		},
+		{
+			Name:    "Zero address when allowed",
+			Payload: `{"chainId": 1, "to": "0x0000000000000000000000000000000000000000", "allowZeroAddress": true}`,
+		},
+		{
+			Name:    "Bad checksum",
+			Payload: `{"chainId": 1, "to": "0x337610d27c682E347C9cD60BD4b3b107C9d34ddd"}`,
+			Field:   "to",
+		},
+		{
+			Name:    "Uppercase address",
+			Payload: `{"chainId": 1, "to": "0x337610D27C682E347C9CD60BD4B3B107C9D34DDD"}`,
+			Field:   "to",
+		},
+		{
+			Name:    "Address without 0x",
+			Payload: `{"chainId": 1, "to": "337610d27c682e347c9cd60bd4b3b107c9d34ddd"}`,
+			Field:   "to",
+		},
+		{
+			Name:    "Garbage address",
+			Payload: `{"chainId": 1, "to": "0xnotanaddress"}`,
+			Field:   "to",
+		},
+		{
+			Name:    "Missing address",
+			Payload: `{"chainId": 1}`,
+			Field:   "to",
+		},
+		{
+			Name:    "Zero address",
+			Payload: `{"chainId": 1, "to": "0x0000000000000000000000000000000000000000"}`,
+			Field:   "to",
+		},
+		{
+			Name:    "Zero chain ID",
+			Payload: `{"chainId": 0, "to": "0x337610d27c682E347C9cD60BD4b3b107C9d34dDd"}`,
+			Field:   "chainId",
+		},
+		{
+			Name:    "Odd length data",
+			Payload: `{"chainId": 1, "to": "0x337610d27c682E347C9cD60BD4b3b107C9d34dDd", "data": "0xa"}`,
+			Field:   "data",
+		},
+		{
+			Name:    "Non hex data",
+			Payload: `{"chainId": 1, "to": "0x337610d27c682E347C9cD60BD4b3b107C9d34dDd", "data": "0xzz"}`,
+			Field:   "data",
+		},
+		{
+			Name:    "Unknown field",
+			Payload: `{"chainId": 1, "to": "0x337610d27c682E347C9cD60BD4b3b107C9d34dDd", "gasLimit": 21000}`,
+			Field:   "gasLimit",
+		},
+		{
+			Name:    "Wrong type",
+			Payload: `{"chainId": "1", "to": "0x337610d27c682E347C9cD60BD4b3b107C9d34dDd"}`,
+			Field:   "chainId",
+		},
+		{
+			Name:    "Trailing object",
+			Payload: `{"chainId": 1, "to": "0x337610d27c682E347C9cD60BD4b3b107C9d34dDd"} {}`,
+			Field:   "payload",
+		},
+		{
+			Name:    "Stray closing brace",
+			Payload: `{"chainId": 1, "to": "0x337610d27c682E347C9cD60BD4b3b107C9d34dDd"}}`,
+			Field:   "payload",
+		},
+		{
+			Name:    "Stray closing bracket",
+			Payload: `{"chainId": 1, "to": "0x337610d27c682E347C9cD60BD4b3b107C9d34dDd"}]`,
+			Field:   "payload",
+		},
+		{
+			Name:    "Trailing whitespace",
+			Payload: "{\"chainId\": 1, \"to\": \"0x337610d27c682E347C9cD60BD4b3b107C9d34dDd\"}\n",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			_, err := a.validatePayload(tc.Payload)
+			if tc.Field == "" {
+				require.NoError(t, err)
+				return
+			}
+
+			require.ErrorIs(t, err, ErrInvalidPayload)
+			var payloadErr *PayloadError
+			require.True(t, errors.As(err, &payloadErr))
+			require.Equal(t, tc.Field, payloadErr.Field)
+		})
+	}
+}
+
+func TestExportEthAccount(t *testing.T) {
+	a := NewEthAdapter()
+
+	t.Run("Export account - pass", func(t *testing.T) {
+		wallet, err := a.DeriveWallet()
+		require.NoError(t, err)
+
+		export, err := a.ExportAccount(wallet)
+		require.NoError(t, err)
+		require.Equal(t, "m/44h/60h/0h", export.Path)
+		require.True(t, strings.HasPrefix(export.ExtendedKey, "xpub"), export.ExtendedKey)
+		require.Empty(t, export.SLIP132Key)
+
+		// The wallet address is the account's first receive address.
+		pubKey := accountReceiveKey(t, &export.HDAccount)
+		require.Equal(t, wallet.PublicKey, crypto.PubkeyToAddress(*pubKey.ToECDSA()).Hex())
+	})
+
+	t.Run("Export wallet without account - fail", func(t *testing.T) {
+		_, err := a.ExportAccount(&Wallet{PublicKey: "0x337610d27c682E347C9cD60BD4b3b107C9d34dDd"})
+		require.ErrorIs(t, err, ErrNoHDAccount)
+	})
+}
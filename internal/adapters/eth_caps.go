@@ -0,0 +1,53 @@
+package adapters
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+var ErrCapExceeded = errors.New("transaction exceeds safety cap")
+
+// TxCaps holds the maximum values an ethereum transaction may carry before the
+// plugin refuses to sign it. A nil (or zero gas limit) field means no cap.
+type TxCaps struct {
+	// Scope describes where the caps were configured, e.g. "chain 1" or
+	// "wallet 0xabc...", and is only used in error messages.
+	Scope string `json:"-"`
+
+	MaxGasPrice *big.Int `json:"max_gas_price,omitempty"` // applies to gasPrice / max fee per gas
+	MaxGasLimit uint64   `json:"max_gas_limit,omitempty"`
+	MaxTotalFee *big.Int `json:"max_total_fee,omitempty"` // gas limit * gas price, in wei
+	MaxValue    *big.Int `json:"max_value,omitempty"`
+}
+
+// CapsLookup returns every set of caps that applies to a transaction on the
+// given chain.
+type CapsLookup func(chainID uint64) ([]TxCaps, error)
+
+// Check returns an error wrapping ErrCapExceeded naming the first cap the
+// payload exceeds.
+func (c *TxCaps) Check(payload *EthPayload) error {
+	gasPrice := new(big.Int).SetUint64(payload.GasPrice)
+	gasLimit := new(big.Int).SetUint64(payload.GasLimit)
+	totalFee := new(big.Int).Mul(gasPrice, gasLimit)
+	value := new(big.Int).SetUint64(payload.Value)
+
+	if c.MaxGasPrice != nil && gasPrice.Cmp(c.MaxGasPrice) > 0 {
+		return c.exceeded("max_gas_price", c.MaxGasPrice, "gasPrice", gasPrice)
+	}
+	if c.MaxGasLimit != 0 && payload.GasLimit > c.MaxGasLimit {
+		return c.exceeded("max_gas_limit", new(big.Int).SetUint64(c.MaxGasLimit), "gas", gasLimit)
+	}
+	if c.MaxTotalFee != nil && totalFee.Cmp(c.MaxTotalFee) > 0 {
+		return c.exceeded("max_total_fee", c.MaxTotalFee, "gas * gasPrice", totalFee)
+	}
+	if c.MaxValue != nil && value.Cmp(c.MaxValue) > 0 {
+		return c.exceeded("max_value", c.MaxValue, "value", value)
+	}
+	return nil
+}
+
+func (c *TxCaps) exceeded(capName string, limit *big.Int, field string, actual *big.Int) error {
+	return fmt.Errorf("%w: %s %s is %s, payload %s is %s", ErrCapExceeded, c.Scope, capName, limit, field, actual)
+}
@@ -0,0 +1,58 @@
+package adapters
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+var ErrKeystoreDecrypt = errors.New("could not decrypt keystore with the given password")
+
+// keystoreHeader holds the unencrypted keystore fields checked before and
+// after decryption.
+type keystoreHeader struct {
+	Address string `json:"address"`
+	Version int    `json:"version"`
+	Crypto  struct {
+		KDF string `json:"kdf"`
+	} `json:"crypto"`
+}
+
+// ImportKeystore decrypts a geth/clef v3 keystore and returns it as a wallet.
+// The password is only used for decryption and never appears in errors.
+func (a *ethereumAdapter) ImportKeystore(keystoreJSON []byte, password string) (*Wallet, error) {
+	var header keystoreHeader
+	if err := json.Unmarshal(keystoreJSON, &header); err != nil {
+		return nil, invalidField("keystore", "is not valid JSON")
+	}
+	if header.Version != 3 {
+		return nil, invalidField("keystore", "version %d is not supported, expected 3", header.Version)
+	}
+	if header.Crypto.KDF != "scrypt" && header.Crypto.KDF != "pbkdf2" {
+		return nil, invalidField("keystore", "kdf %q is not supported", header.Crypto.KDF)
+	}
+	if !common.IsHexAddress(header.Address) {
+		return nil, invalidField("keystore", "address is missing or invalid")
+	}
+
+	key, err := keystore.DecryptKey(keystoreJSON, password)
+	if err != nil {
+		if errors.Is(err, keystore.ErrDecrypt) {
+			return nil, ErrKeystoreDecrypt
+		}
+		return nil, invalidField("keystore", "failed to decrypt: %v", err)
+	}
+
+	if key.Address != common.HexToAddress(header.Address) {
+		return nil, invalidField("keystore", "address %s does not match the decrypted key's address %s", common.HexToAddress(header.Address).Hex(), key.Address.Hex())
+	}
+
+	return &Wallet{
+		PrivateKey: hexutil.Encode(crypto.FromECDSA(key.PrivateKey))[2:],
+		PublicKey:  key.Address.Hex(),
+	}, nil
+}
@@ -0,0 +1,111 @@
+package adapters
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+const (
+	SafeOperationCall         uint8 = 0
+	SafeOperationDelegateCall uint8 = 1
+)
+
+var (
+	safeDomainTypeHash = crypto.Keccak256Hash([]byte("EIP712Domain(uint256 chainId,address verifyingContract)"))
+	safeTxTypeHash     = crypto.Keccak256Hash([]byte("SafeTx(address to,uint256 value,bytes data,uint8 operation,uint256 safeTxGas,uint256 baseGas,uint256 gasPrice,address gasToken,address refundReceiver,uint256 nonce)"))
+)
+
+// SafeTransaction holds the SafeTx fields as the Safe Transaction Service
+// names them. Numeric fields accept JSON numbers or decimal / 0x hex strings.
+type SafeTransaction struct {
+	To             common.Address        `json:"to"`
+	Value          *math.HexOrDecimal256 `json:"value"`
+	Data           hexutil.Bytes         `json:"data"`
+	Operation      uint8                 `json:"operation"`
+	SafeTxGas      *math.HexOrDecimal256 `json:"safeTxGas"`
+	BaseGas        *math.HexOrDecimal256 `json:"baseGas"`
+	GasPrice       *math.HexOrDecimal256 `json:"gasPrice"`
+	GasToken       common.Address        `json:"gasToken"`
+	RefundReceiver common.Address        `json:"refundReceiver"`
+	Nonce          *math.HexOrDecimal256 `json:"nonce"`
+}
+
+// SafeTxHash computes the EIP-712 hash a Safe (v1.3.0 and later) at safe on
+// the given chain expects its owners to sign.
+func SafeTxHash(safe common.Address, chainID uint64, tx *SafeTransaction) common.Hash {
+	word := func(v *math.HexOrDecimal256) []byte {
+		if v == nil {
+			return make([]byte, 32)
+		}
+		return math.U256Bytes(new(big.Int).Set((*big.Int)(v)))
+	}
+	address := func(a common.Address) []byte {
+		return common.LeftPadBytes(a.Bytes(), 32)
+	}
+
+	domainSeparator := crypto.Keccak256(
+		safeDomainTypeHash.Bytes(),
+		math.U256Bytes(new(big.Int).SetUint64(chainID)),
+		address(safe),
+	)
+	structHash := crypto.Keccak256(
+		safeTxTypeHash.Bytes(),
+		address(tx.To),
+		word(tx.Value),
+		crypto.Keccak256(tx.Data),
+		common.LeftPadBytes([]byte{tx.Operation}, 32),
+		word(tx.SafeTxGas),
+		word(tx.BaseGas),
+		word(tx.GasPrice),
+		address(tx.GasToken),
+		address(tx.RefundReceiver),
+		word(tx.Nonce),
+	)
+	return crypto.Keccak256Hash([]byte{0x19, 0x01}, domainSeparator, structHash)
+}
+
+// SignSafeTransaction computes the SafeTx hash and returns it with the owner's
+// 65 byte r||s||v signature (v = 27/28), the format the Safe Transaction
+// Service accepts for EOA owners.
+func (a *ethereumAdapter) SignSafeTransaction(wallet *Wallet, safeAddress string, chainID uint64, safeTx string) (string, string, error) {
+	if chainID == 0 {
+		return "", "", invalidField("chain_id", "must be nonzero")
+	}
+	if err := validateAddress("safe_address", safeAddress); err != nil {
+		return "", "", err
+	}
+
+	var tx SafeTransaction
+	if err := decodePayload(safeTx, &tx); err != nil {
+		return "", "", err
+	}
+
+	switch tx.Operation {
+	case SafeOperationCall:
+	case SafeOperationDelegateCall:
+		if a.policy == nil || !a.policy.AllowDelegateCall {
+			return "", "", invalidField("operation", "delegatecall operations are not allowed for this wallet")
+		}
+	default:
+		return "", "", invalidField("operation", "must be 0 (call) or 1 (delegatecall)")
+	}
+
+	hash := SafeTxHash(common.HexToAddress(safeAddress), chainID, &tx)
+
+	privateKey, err := crypto.HexToECDSA(wallet.PrivateKey)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to convert private key: %w", err)
+	}
+	signature, err := crypto.Sign(hash.Bytes(), privateKey)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to sign safe transaction: %w", err)
+	}
+	signature[crypto.RecoveryIDOffset] += 27
+
+	return hash.Hex(), hexutil.Encode(signature), nil
+}
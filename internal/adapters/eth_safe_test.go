@@ -0,0 +1,73 @@
+package adapters
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSafeTxHash(t *testing.T) {
+	safe := common.HexToAddress("0x1c2d8E6B2a5F4D8e3cBb2d5bA8E2a3b1D9a1E6f4")
+	chainID := uint64(1)
+
+	var tx SafeTransaction
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"to": "0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48",
+		"value": "1000000000000000",
+		"data": "0xa9059cbb",
+		"operation": 0,
+		"safeTxGas": 0,
+		"baseGas": "0",
+		"gasPrice": "0x0",
+		"gasToken": "0x0000000000000000000000000000000000000000",
+		"refundReceiver": "0x0000000000000000000000000000000000000000",
+		"nonce": 42
+	}`), &tx))
+
+	// Hash the same message with go-ethereum's generic EIP-712 implementation.
+	typedData := apitypes.TypedData{
+		Types: apitypes.Types{
+			"EIP712Domain": {
+				{Name: "chainId", Type: "uint256"},
+				{Name: "verifyingContract", Type: "address"},
+			},
+			"SafeTx": {
+				{Name: "to", Type: "address"},
+				{Name: "value", Type: "uint256"},
+				{Name: "data", Type: "bytes"},
+				{Name: "operation", Type: "uint8"},
+				{Name: "safeTxGas", Type: "uint256"},
+				{Name: "baseGas", Type: "uint256"},
+				{Name: "gasPrice", Type: "uint256"},
+				{Name: "gasToken", Type: "address"},
+				{Name: "refundReceiver", Type: "address"},
+				{Name: "nonce", Type: "uint256"},
+			},
+		},
+		PrimaryType: "SafeTx",
+		Domain: apitypes.TypedDataDomain{
+			ChainId:           math.NewHexOrDecimal256(int64(chainID)),
+			VerifyingContract: safe.Hex(),
+		},
+		Message: apitypes.TypedDataMessage{
+			"to":             "0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48",
+			"value":          "1000000000000000",
+			"data":           "0xa9059cbb",
+			"operation":      "0",
+			"safeTxGas":      "0",
+			"baseGas":        "0",
+			"gasPrice":       "0",
+			"gasToken":       "0x0000000000000000000000000000000000000000",
+			"refundReceiver": "0x0000000000000000000000000000000000000000",
+			"nonce":          "42",
+		},
+	}
+	expected, _, err := apitypes.TypedDataAndHash(typedData)
+	require.NoError(t, err)
+
+	require.Equal(t, common.BytesToHash(expected), SafeTxHash(safe, chainID, &tx))
+}
@@ -0,0 +1,214 @@
+package adapters
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+type EntryPointVersion string
+
+const (
+	EntryPointV06 EntryPointVersion = "v0.6"
+	EntryPointV07 EntryPointVersion = "v0.7"
+)
+
+// AllowedEntryPoints maps the canonical ERC-4337 EntryPoint deployments to the
+// UserOperation format they expect. Only these contracts may be signed for.
+var AllowedEntryPoints = map[common.Address]EntryPointVersion{
+	common.HexToAddress("0x5FF137D4b0FDCD49DcA30c7CF57E578a026d2789"): EntryPointV06,
+	common.HexToAddress("0x0000000071727De22E5E9d8BAf0edAc6f37da032"): EntryPointV07,
+}
+
+// UserOperation is an ERC-4337 user operation in the JSON-RPC shape bundlers
+// accept. v0.6 operations use InitCode and PaymasterAndData; v0.7 operations use
+// the unpacked Factory and Paymaster fields instead.
+type UserOperation struct {
+	Sender               common.Address `json:"sender"`
+	Nonce                *hexutil.Big   `json:"nonce"`
+	CallData             hexutil.Bytes  `json:"callData"`
+	CallGasLimit         *hexutil.Big   `json:"callGasLimit"`
+	VerificationGasLimit *hexutil.Big   `json:"verificationGasLimit"`
+	PreVerificationGas   *hexutil.Big   `json:"preVerificationGas"`
+	MaxFeePerGas         *hexutil.Big   `json:"maxFeePerGas"`
+	MaxPriorityFeePerGas *hexutil.Big   `json:"maxPriorityFeePerGas"`
+	Signature            hexutil.Bytes  `json:"signature,omitempty"`
+
+	// v0.6
+	InitCode         hexutil.Bytes `json:"initCode,omitempty"`
+	PaymasterAndData hexutil.Bytes `json:"paymasterAndData,omitempty"`
+
+	// v0.7
+	Factory                       *common.Address `json:"factory,omitempty"`
+	FactoryData                   hexutil.Bytes   `json:"factoryData,omitempty"`
+	Paymaster                     *common.Address `json:"paymaster,omitempty"`
+	PaymasterVerificationGasLimit *hexutil.Big    `json:"paymasterVerificationGasLimit,omitempty"`
+	PaymasterPostOpGasLimit       *hexutil.Big    `json:"paymasterPostOpGasLimit,omitempty"`
+	PaymasterData                 hexutil.Bytes   `json:"paymasterData,omitempty"`
+}
+
+// UserOpHash computes the hash the EntryPoint at entryPoint reports from
+// getUserOpHash for op on the given chain.
+func UserOpHash(op *UserOperation, entryPoint common.Address, chainID uint64) (common.Hash, error) {
+	version, ok := AllowedEntryPoints[entryPoint]
+	if !ok {
+		return common.Hash{}, fmt.Errorf("entry point %s is not in the allowlist", entryPoint.Hex())
+	}
+
+	var packed []byte
+	var err error
+	switch version {
+	case EntryPointV06:
+		packed, err = packUserOpV06(op)
+	case EntryPointV07:
+		packed, err = packUserOpV07(op)
+	}
+	if err != nil {
+		return common.Hash{}, err
+	}
+
+	return crypto.Keccak256Hash(
+		crypto.Keccak256(packed),
+		common.LeftPadBytes(entryPoint.Bytes(), 32),
+		math.U256Bytes(new(big.Int).SetUint64(chainID)),
+	), nil
+}
+
+func packUserOpV06(op *UserOperation) ([]byte, error) {
+	if op.Factory != nil || op.Paymaster != nil || len(op.FactoryData) > 0 || len(op.PaymasterData) > 0 {
+		return nil, fmt.Errorf("v0.6 user operations use initCode and paymasterAndData")
+	}
+	words, err := uint256Words(op.Nonce, op.CallGasLimit, op.VerificationGasLimit, op.PreVerificationGas, op.MaxFeePerGas, op.MaxPriorityFeePerGas)
+	if err != nil {
+		return nil, err
+	}
+
+	packed := common.LeftPadBytes(op.Sender.Bytes(), 32)
+	packed = append(packed, words[0]...)
+	packed = append(packed, crypto.Keccak256(op.InitCode)...)
+	packed = append(packed, crypto.Keccak256(op.CallData)...)
+	for _, w := range words[1:] {
+		packed = append(packed, w...)
+	}
+	packed = append(packed, crypto.Keccak256(op.PaymasterAndData)...)
+	return packed, nil
+}
+
+func packUserOpV07(op *UserOperation) ([]byte, error) {
+	if len(op.InitCode) > 0 || len(op.PaymasterAndData) > 0 {
+		return nil, fmt.Errorf("v0.7 user operations use factory/factoryData and paymaster fields")
+	}
+	words, err := uint256Words(op.Nonce, op.PreVerificationGas)
+	if err != nil {
+		return nil, err
+	}
+	accountGasLimits, err := packUint128Pair(op.VerificationGasLimit, op.CallGasLimit)
+	if err != nil {
+		return nil, err
+	}
+	gasFees, err := packUint128Pair(op.MaxPriorityFeePerGas, op.MaxFeePerGas)
+	if err != nil {
+		return nil, err
+	}
+
+	var initCode []byte
+	if op.Factory != nil {
+		initCode = append(op.Factory.Bytes(), op.FactoryData...)
+	} else if len(op.FactoryData) > 0 {
+		return nil, fmt.Errorf("factoryData requires factory")
+	}
+
+	var paymasterAndData []byte
+	if op.Paymaster != nil {
+		limits, err := packUint128Pair(op.PaymasterVerificationGasLimit, op.PaymasterPostOpGasLimit)
+		if err != nil {
+			return nil, err
+		}
+		paymasterAndData = append(op.Paymaster.Bytes(), limits...)
+		paymasterAndData = append(paymasterAndData, op.PaymasterData...)
+	} else if len(op.PaymasterData) > 0 {
+		return nil, fmt.Errorf("paymasterData requires paymaster")
+	}
+
+	packed := common.LeftPadBytes(op.Sender.Bytes(), 32)
+	packed = append(packed, words[0]...)
+	packed = append(packed, crypto.Keccak256(initCode)...)
+	packed = append(packed, crypto.Keccak256(op.CallData)...)
+	packed = append(packed, accountGasLimits...)
+	packed = append(packed, words[1]...)
+	packed = append(packed, gasFees...)
+	packed = append(packed, crypto.Keccak256(paymasterAndData)...)
+	return packed, nil
+}
+
+// uint256Words ABI-encodes each value as a 32 byte word. Missing values are zero.
+func uint256Words(values ...*hexutil.Big) ([][]byte, error) {
+	words := make([][]byte, len(values))
+	for i, v := range values {
+		n := new(big.Int)
+		if v != nil {
+			n = v.ToInt()
+		}
+		if n.Sign() < 0 || n.BitLen() > 256 {
+			return nil, fmt.Errorf("value %s does not fit in uint256", n)
+		}
+		words[i] = math.U256Bytes(new(big.Int).Set(n))
+	}
+	return words, nil
+}
+
+// packUint128Pair packs high and low into a single bytes32, as v0.7 does for
+// gas limits and fees.
+func packUint128Pair(high, low *hexutil.Big) ([]byte, error) {
+	word := make([]byte, 32)
+	for i, v := range []*hexutil.Big{high, low} {
+		if v == nil {
+			continue
+		}
+		n := v.ToInt()
+		if n.Sign() < 0 || n.BitLen() > 128 {
+			return nil, fmt.Errorf("value %s does not fit in uint128", n)
+		}
+		n.FillBytes(word[i*16 : (i+1)*16])
+	}
+	return word, nil
+}
+
+// SignUserOperation computes the userOpHash for the operation and signs it as
+// an EIP-191 personal message, which is what owner-validated smart accounts
+// recover the owner from.
+func (a *ethereumAdapter) SignUserOperation(wallet *Wallet, userOp string, entryPoint string, chainID uint64) (string, string, error) {
+	if chainID == 0 {
+		return "", "", invalidField("chain_id", "must be nonzero")
+	}
+	if err := validateAddress("entry_point", entryPoint); err != nil {
+		return "", "", err
+	}
+
+	var op UserOperation
+	if err := decodePayload(userOp, &op); err != nil {
+		return "", "", err
+	}
+
+	hash, err := UserOpHash(&op, common.HexToAddress(entryPoint), chainID)
+	if err != nil {
+		return "", "", invalidField("user_operation", "%v", err)
+	}
+
+	privateKey, err := crypto.HexToECDSA(wallet.PrivateKey)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to convert private key: %w", err)
+	}
+	signature, err := crypto.Sign(accounts.TextHash(hash.Bytes()), privateKey)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to sign user operation: %w", err)
+	}
+	signature[crypto.RecoveryIDOffset] += 27
+
+	return hash.Hex(), hexutil.Encode(signature), nil
+}
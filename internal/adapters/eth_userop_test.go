@@ -0,0 +1,118 @@
+package adapters
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/require"
+)
+
+func hexBig(v int64) *hexutil.Big {
+	return (*hexutil.Big)(big.NewInt(v))
+}
+
+// abiHash hashes values with the go-ethereum ABI encoder, mirroring the
+// abi.encode calls in the EntryPoint contracts.
+func abiHash(t *testing.T, types []string, values ...interface{}) common.Hash {
+	t.Helper()
+	args := abi.Arguments{}
+	for _, name := range types {
+		typ, err := abi.NewType(name, "", nil)
+		require.NoError(t, err)
+		args = append(args, abi.Argument{Type: typ})
+	}
+	packed, err := args.Pack(values...)
+	require.NoError(t, err)
+	return crypto.Keccak256Hash(packed)
+}
+
+func TestUserOpHash(t *testing.T) {
+	sender := common.HexToAddress("0x9406Cc6185a346906296840746125a0E44976454")
+	callData := hexutil.MustDecode("0xb61d27f6000000000000000000000000")
+	chainID := uint64(11155111)
+
+	t.Run("v0.6", func(t *testing.T) {
+		entryPoint := common.HexToAddress("0x5FF137D4b0FDCD49DcA30c7CF57E578a026d2789")
+		op := &UserOperation{
+			Sender:               sender,
+			Nonce:                hexBig(7),
+			InitCode:             hexutil.MustDecode("0x9406cc6185a346906296840746125a0e44976454aabb"),
+			CallData:             callData,
+			CallGasLimit:         hexBig(100000),
+			VerificationGasLimit: hexBig(200000),
+			PreVerificationGas:   hexBig(50000),
+			MaxFeePerGas:         hexBig(3000000000),
+			MaxPriorityFeePerGas: hexBig(1000000000),
+			PaymasterAndData:     hexutil.MustDecode("0x1234"),
+		}
+
+		inner := abiHash(t,
+			[]string{"address", "uint256", "bytes32", "bytes32", "uint256", "uint256", "uint256", "uint256", "uint256", "bytes32"},
+			sender, big.NewInt(7), crypto.Keccak256Hash(op.InitCode), crypto.Keccak256Hash(callData),
+			big.NewInt(100000), big.NewInt(200000), big.NewInt(50000), big.NewInt(3000000000), big.NewInt(1000000000),
+			crypto.Keccak256Hash(op.PaymasterAndData))
+		expected := abiHash(t, []string{"bytes32", "address", "uint256"}, inner, entryPoint, new(big.Int).SetUint64(chainID))
+
+		hash, err := UserOpHash(op, entryPoint, chainID)
+		require.NoError(t, err)
+		require.Equal(t, expected, hash)
+	})
+
+	t.Run("v0.7", func(t *testing.T) {
+		entryPoint := common.HexToAddress("0x0000000071727De22E5E9d8BAf0edAc6f37da032")
+		factory := common.HexToAddress("0x91E60e0613810449d098b0b5Ec8b51A0FE8c8985")
+		paymaster := common.HexToAddress("0x0000000000325602a77416A16136FDafd04b299f")
+		op := &UserOperation{
+			Sender:                        sender,
+			Nonce:                         hexBig(1),
+			Factory:                       &factory,
+			FactoryData:                   hexutil.MustDecode("0x5fbfb9cf"),
+			CallData:                      callData,
+			CallGasLimit:                  hexBig(100000),
+			VerificationGasLimit:          hexBig(200000),
+			PreVerificationGas:            hexBig(50000),
+			MaxFeePerGas:                  hexBig(3000000000),
+			MaxPriorityFeePerGas:          hexBig(1000000000),
+			Paymaster:                     &paymaster,
+			PaymasterVerificationGasLimit: hexBig(30000),
+			PaymasterPostOpGasLimit:       hexBig(10000),
+			PaymasterData:                 hexutil.MustDecode("0xdeadbeef"),
+		}
+
+		initCode := append(factory.Bytes(), op.FactoryData...)
+		paymasterAndData := append(paymaster.Bytes(), common.LeftPadBytes(big.NewInt(30000).Bytes(), 16)...)
+		paymasterAndData = append(paymasterAndData, common.LeftPadBytes(big.NewInt(10000).Bytes(), 16)...)
+		paymasterAndData = append(paymasterAndData, op.PaymasterData...)
+		accountGasLimits := new(big.Int).Lsh(big.NewInt(200000), 128)
+		accountGasLimits.Or(accountGasLimits, big.NewInt(100000))
+		gasFees := new(big.Int).Lsh(big.NewInt(1000000000), 128)
+		gasFees.Or(gasFees, big.NewInt(3000000000))
+
+		inner := abiHash(t,
+			[]string{"address", "uint256", "bytes32", "bytes32", "bytes32", "uint256", "bytes32", "bytes32"},
+			sender, big.NewInt(1), crypto.Keccak256Hash(initCode), crypto.Keccak256Hash(callData),
+			common.BigToHash(accountGasLimits), big.NewInt(50000), common.BigToHash(gasFees),
+			crypto.Keccak256Hash(paymasterAndData))
+		expected := abiHash(t, []string{"bytes32", "address", "uint256"}, inner, entryPoint, new(big.Int).SetUint64(chainID))
+
+		hash, err := UserOpHash(op, entryPoint, chainID)
+		require.NoError(t, err)
+		require.Equal(t, expected, hash)
+	})
+
+	t.Run("v0.7 fields on v0.6 entry point", func(t *testing.T) {
+		factory := common.HexToAddress("0x91E60e0613810449d098b0b5Ec8b51A0FE8c8985")
+		op := &UserOperation{Sender: sender, Factory: &factory}
+		_, err := UserOpHash(op, common.HexToAddress("0x5FF137D4b0FDCD49DcA30c7CF57E578a026d2789"), chainID)
+		require.Error(t, err)
+	})
+
+	t.Run("entry point not allowlisted", func(t *testing.T) {
+		_, err := UserOpHash(&UserOperation{Sender: sender}, common.HexToAddress("0x0000000000000000000000000000000000000001"), chainID)
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,192 @@
+package adapters
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	btcec "github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/chaincfg"
+)
+
+// ErrNoHDAccount is returned when exporting the account of a wallet that was
+// not derived from an HD seed.
+var ErrNoHDAccount = errors.New("wallet was not derived from an HD seed")
+
+// errNoAccountKey is returned for keys of the HD account of a wallet that
+// did not keep its account key.
+var errNoAccountKey = errors.New("wallet was created before its account key was kept and only signs with its own key")
+
+// HDAccount is the BIP32 account a wallet's key was derived from. It holds
+// public data only: the wallet key is the account's first receive key,
+// <Path>/0/0. The seed is discarded and the account private key is kept in
+// the wallet's AccountKey, which is never exported.
+type HDAccount struct {
+	Fingerprint string `json:"fingerprint"`  // master key fingerprint, hex
+	Path        string `json:"path"`         // e.g. m/84h/0h/0h
+	ExtendedKey string `json:"extended_key"` // account xpub or tpub
+}
+
+// AccountExport is the public data of a wallet's HD account.
+type AccountExport struct {
+	HDAccount
+	// SLIP132Key is the account key with the SLIP-132 version of its address
+	// type, e.g. a zpub for p2wpkh. Empty when the type has none.
+	SLIP132Key string
+}
+
+// deriveHDAccount derives the account at the hardened path from a new random
+// seed and returns it with the account's extended private key and the private
+// key of its first receive address.
+func deriveHDAccount(net *chaincfg.Params, path ...uint32) (*HDAccount, string, *btcec.PrivateKey, error) {
+	seed, err := hdkeychain.GenerateSeed(hdkeychain.RecommendedSeedLen)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	defer clear(seed)
+	master, err := hdkeychain.NewMaster(seed, net)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	defer master.Zero()
+	masterPub, err := master.ECPubKey()
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	account := master
+	steps := make([]string, len(path))
+	for i, index := range path {
+		account, err = account.Derive(hdkeychain.HardenedKeyStart + index)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		steps[i] = fmt.Sprintf("%dh", index)
+	}
+	defer account.Zero()
+	privKey, err := childKey(account, 0, 0)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	accountPub, err := account.Neuter()
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	return &HDAccount{
+		Fingerprint: hex.EncodeToString(btcutil.Hash160(masterPub.SerializeCompressed())[:4]),
+		Path:        "m/" + strings.Join(steps, "/"),
+		ExtendedKey: accountPub.String(),
+	}, account.String(), privKey, nil
+}
+
+// childKey derives the private key at <chain>/<index> below account.
+func childKey(account *hdkeychain.ExtendedKey, chain, index uint32) (*btcec.PrivateKey, error) {
+	chainKey, err := account.Derive(chain)
+	if err != nil {
+		return nil, err
+	}
+	key, err := chainKey.Derive(index)
+	if err != nil {
+		return nil, err
+	}
+	return key.ECPrivKey()
+}
+
+// ChildKey returns the private key of the wallet's HD account at path,
+// "<chain>/<index>" below the account, where chain is 0 for receive and 1 for
+// change keys. Wallets without an HD account fail with ErrNoHDAccount.
+func (w *Wallet) ChildKey(net *chaincfg.Params, path string) (*btcec.PrivateKey, error) {
+	if w == nil || w.Account == nil {
+		return nil, ErrNoHDAccount
+	}
+	if w.AccountKey == "" {
+		return nil, errNoAccountKey
+	}
+	chain, index, err := parseChildPath(path)
+	if err != nil {
+		return nil, err
+	}
+	account, err := hdkeychain.NewKeyFromString(w.AccountKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode account key: %w", err)
+	}
+	defer account.Zero()
+	if !account.IsPrivate() || !account.IsForNet(net) {
+		return nil, fmt.Errorf("account key is not a private key for %s", net.Name)
+	}
+	return childKey(account, chain, index)
+}
+
+// publicChildKey returns the public key of the account at path, derived from
+// the account's extended public key.
+func (acc *HDAccount) publicChildKey(net *chaincfg.Params, path string) (*btcec.PublicKey, error) {
+	if acc == nil {
+		return nil, ErrNoHDAccount
+	}
+	chain, index, err := parseChildPath(path)
+	if err != nil {
+		return nil, err
+	}
+	account, err := hdkeychain.NewKeyFromString(acc.ExtendedKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode account key: %w", err)
+	}
+	if account.IsPrivate() || !account.IsForNet(net) {
+		return nil, fmt.Errorf("account extended key is not a public key for %s", net.Name)
+	}
+	chainKey, err := account.Derive(chain)
+	if err != nil {
+		return nil, err
+	}
+	key, err := chainKey.Derive(index)
+	if err != nil {
+		return nil, err
+	}
+	return key.ECPubKey()
+}
+
+// parseChildPath parses a path below an HD account, "<chain>/<index>" with
+// chain 0 or 1 and a non-hardened index.
+func parseChildPath(path string) (uint32, uint32, error) {
+	chainStr, indexStr, ok := strings.Cut(path, "/")
+	chain, chainErr := strconv.ParseUint(chainStr, 10, 32)
+	index, indexErr := strconv.ParseUint(indexStr, 10, 32)
+	if !ok || chainErr != nil || indexErr != nil || chain > 1 || index >= hdkeychain.HardenedKeyStart {
+		return 0, 0, fmt.Errorf("path %q is not <chain>/<index> with chain 0 (receive) or 1 (change) and a non-hardened index", path)
+	}
+	return uint32(chain), uint32(index), nil
+}
+
+// childPath returns the path below the account, "<chain>/<index>", of a
+// BIP32 derivation given as the master key fingerprint, in the little endian
+// order of a PSBT, and the full path. It reports false for derivations
+// outside the account.
+func (acc *HDAccount) childPath(fingerprint uint32, path []uint32) (string, bool) {
+	var fp [4]byte
+	binary.LittleEndian.PutUint32(fp[:], fingerprint)
+	if acc == nil || hex.EncodeToString(fp[:]) != acc.Fingerprint || len(path) < 2 {
+		return "", false
+	}
+	steps := make([]string, len(path)-2)
+	for i, index := range path[:len(path)-2] {
+		if index >= hdkeychain.HardenedKeyStart {
+			steps[i] = fmt.Sprintf("%dh", index-hdkeychain.HardenedKeyStart)
+		} else {
+			steps[i] = fmt.Sprint(index)
+		}
+	}
+	if "m/"+strings.Join(steps, "/") != acc.Path {
+		return "", false
+	}
+	childPath := fmt.Sprintf("%d/%d", path[len(path)-2], path[len(path)-1])
+	if _, _, err := parseChildPath(childPath); err != nil {
+		return "", false
+	}
+	return childPath, true
+}
@@ -0,0 +1,241 @@
+package adapters
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/btcutil/psbt"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/stretchr/testify/require"
+)
+
+// legacyBtcWallet returns a wallet of a random key with no HD account, like
+// wallets created before HD derivation.
+func legacyBtcWallet(t *testing.T, net *chaincfg.Params) (*Wallet, *btcutil.WIF) {
+	t.Helper()
+	privateKey, err := btcec.NewPrivateKey()
+	require.NoError(t, err)
+	wif, err := btcutil.NewWIF(privateKey, net, true)
+	require.NoError(t, err)
+	addr, err := walletAddress(wif, AddressTypeP2WPKH, net)
+	require.NoError(t, err)
+	return &Wallet{PrivateKey: wif.String(), PublicKey: addr.EncodeAddress()}, wif
+}
+
+func TestAccountKey(t *testing.T) {
+	net := &chaincfg.TestNet4Params
+	a := NewBtcAdapter(net)
+
+	t.Run("New wallets keep the account key - pass", func(t *testing.T) {
+		btcWallet, err := a.DeriveWallet()
+		require.NoError(t, err)
+		ethWallet, err := NewEthAdapter().DeriveWallet()
+		require.NoError(t, err)
+
+		for _, wallet := range []*Wallet{btcWallet, ethWallet} {
+			accountKey, err := hdkeychain.NewKeyFromString(wallet.AccountKey)
+			require.NoError(t, err)
+			require.True(t, accountKey.IsPrivate())
+			accountPub, err := accountKey.Neuter()
+			require.NoError(t, err)
+			require.Equal(t, wallet.Account.ExtendedKey, accountPub.String())
+		}
+
+		// The wallet key is still the account's first receive key.
+		wif, err := btcutil.DecodeWIF(btcWallet.PrivateKey)
+		require.NoError(t, err)
+		key, err := btcWallet.ChildKey(net, "0/0")
+		require.NoError(t, err)
+		require.True(t, key.PubKey().IsEqual(wif.PrivKey.PubKey()))
+	})
+
+	t.Run("Bad child path - fail", func(t *testing.T) {
+		wallet, err := a.DeriveWallet()
+		require.NoError(t, err)
+		for _, path := range []string{"", "0", "2/0", "0/2147483648", "0/1/2", "m/0/1", "a/b"} {
+			_, err := wallet.ChildKey(net, path)
+			require.ErrorContains(t, err, "is not <chain>/<index>", path)
+		}
+		_, err = wallet.ChildKey(&chaincfg.MainNetParams, "0/1")
+		require.ErrorContains(t, err, "not a private key for mainnet")
+	})
+
+	t.Run("Sign for other keys of the account - pass", func(t *testing.T) {
+		wallet, err := a.DeriveWallet()
+		require.NoError(t, err)
+		recipient, err := a.DeriveWallet()
+		require.NoError(t, err)
+
+		// UTXOs of addresses a watch-only wallet derives from the account
+		// xpub, next to one of the wallet address.
+		utxos := []UTXO{{
+			Txid:             "1b0e5d0c4cf4a1e0d3a5e0c8f3f5b5a9c9b2d4e6f8a0b2c4d6e8f0a2b4c6d8e0",
+			Value:            40000,
+			ScriptPubKey:     hex.EncodeToString(walletPkScript(t, wallet, net)),
+			ScriptPubKeyType: "v0_p2wpkh",
+		}}
+		for i, path := range []struct{ chain, index uint32 }{{0, 3}, {1, 7}} {
+			pubKey := accountChildKey(t, wallet.Account, path.chain, path.index)
+			utxos = append(utxos, UTXO{
+				Txid:             utxos[0].Txid,
+				Vout:             uint32(i + 1),
+				Value:            30000,
+				ScriptPubKey:     hex.EncodeToString(pubKeyHashScripts(btcutil.Hash160(pubKey.SerializeCompressed()))["v0_p2wpkh"]),
+				ScriptPubKeyType: "v0_p2wpkh",
+				Path:             []string{"0/3", "1/7"}[i],
+			})
+		}
+		payload := BtcPayload{Recipient: recipient.PublicKey, Amount: 90000, FeeRate: 2, Utxos: utxos}
+
+		hexTx, err := a.CreateSignedTransaction(wallet, mustJSON(t, payload))
+		require.NoError(t, err)
+		tx := decodeTestTx(t, hexTx)
+		prevOuts := make([]*wire.TxOut, len(utxos))
+		for i, utxo := range utxos {
+			script, err := hex.DecodeString(utxo.ScriptPubKey)
+			require.NoError(t, err)
+			prevOuts[i] = wire.NewTxOut(utxo.Value, script)
+		}
+		verifyInputs(t, tx, prevOuts)
+
+		// A path must name the key the UTXO pays.
+		payload.Utxos[1].Path = "0/4"
+		_, err = a.CreateSignedTransaction(wallet, mustJSON(t, payload))
+		require.ErrorContains(t, err, "does not match the wallet account's P2WPKH address at 0/4")
+	})
+
+	t.Run("Sign a PSBT input of another account key - pass", func(t *testing.T) {
+		wallet, err := a.DeriveWallet()
+		require.NoError(t, err)
+		pubKey := accountChildKey(t, wallet.Account, 0, 2)
+		funding := fundingTx(pubKeyHashScripts(btcutil.Hash160(pubKey.SerializeCompressed()))["v0_p2wpkh"], 60000)
+
+		packet := newTestPSBT(t, []*wire.MsgTx{funding}, 59000)
+		packet.Inputs[0].NonWitnessUtxo = funding
+		fingerprint, err := hex.DecodeString(wallet.Account.Fingerprint)
+		require.NoError(t, err)
+		packet.Inputs[0].Bip32Derivation = []*psbt.Bip32Derivation{{
+			PubKey:               pubKey.SerializeCompressed(),
+			MasterKeyFingerprint: binary.LittleEndian.Uint32(fingerprint),
+			Bip32Path:            []uint32{hdkeychain.HardenedKeyStart + 84, hdkeychain.HardenedKeyStart + 1, hdkeychain.HardenedKeyStart, 0, 2},
+		}}
+		encoded, err := packet.B64Encode()
+		require.NoError(t, err)
+
+		result, err := a.SignPSBT(wallet, encoded, true)
+		require.NoError(t, err)
+		require.Equal(t, []int{0}, result.SignedInputs)
+		verifyInputs(t, decodeTestTx(t, result.Tx), []*wire.TxOut{funding.TxOut[0]})
+
+		// Without the derivation the input is not recognised as the wallet's.
+		packet.Inputs[0].Bip32Derivation = nil
+		encoded, err = packet.B64Encode()
+		require.NoError(t, err)
+		_, err = a.SignPSBT(wallet, encoded, false)
+		require.ErrorContains(t, err, "no inputs spend from wallet")
+	})
+
+	t.Run("Wallets without an account key sign as before - pass", func(t *testing.T) {
+		legacy, wif := legacyBtcWallet(t, net)
+		created, err := a.DeriveWallet()
+		require.NoError(t, err)
+		created.AccountKey = "" // an HD wallet stored before the account key was kept
+		createdWIF, err := btcutil.DecodeWIF(created.PrivateKey)
+		require.NoError(t, err)
+
+		for _, tc := range []struct {
+			wallet *Wallet
+			wif    *btcutil.WIF
+			err    string
+		}{
+			{legacy, wif, "wallet was not derived from an HD seed"},
+			{created, createdWIF, "only signs with its own key"},
+		} {
+			utxo := UTXO{
+				Txid:             "1b0e5d0c4cf4a1e0d3a5e0c8f3f5b5a9c9b2d4e6f8a0b2c4d6e8f0a2b4c6d8e0",
+				Value:            40000,
+				ScriptPubKey:     hex.EncodeToString(walletScripts(tc.wif)["v0_p2wpkh"]),
+				ScriptPubKeyType: "v0_p2wpkh",
+			}
+			payload := BtcPayload{Recipient: tc.wallet.PublicKey, Amount: 30000, FeeRate: 2, Utxos: []UTXO{utxo}}
+			_, err := a.CreateSignedTransaction(tc.wallet, mustJSON(t, payload))
+			require.NoError(t, err)
+
+			payload.Utxos[0].Path = "0/1"
+			_, err = a.CreateSignedTransaction(tc.wallet, mustJSON(t, payload))
+			require.ErrorIs(t, err, ErrInvalidPayload)
+			require.ErrorContains(t, err, tc.err)
+		}
+	})
+
+	t.Run("Sign ETH transactions from another account address - pass", func(t *testing.T) {
+		eth := NewEthAdapter()
+		wallet, err := eth.DeriveWallet()
+		require.NoError(t, err)
+		address := crypto.PubkeyToAddress(*accountChildKey(t, wallet.Account, 0, 1).ToECDSA())
+
+		for path, sender := range map[string]string{"": wallet.PublicKey, "0/1": address.Hex()} {
+			payload := `{"chainId": 1, "to": "0x337610d27c682E347C9cD60BD4b3b107C9d34dDd", "value": 1, "path": "` + path + `"}`
+			rawTx, err := eth.CreateSignedTransaction(wallet, payload)
+			require.NoError(t, err)
+			raw, err := hex.DecodeString(rawTx)
+			require.NoError(t, err)
+			var tx types.Transaction
+			require.NoError(t, rlp.DecodeBytes(raw, &tx))
+			from, err := types.Sender(types.NewEIP155Signer(big.NewInt(1)), &tx)
+			require.NoError(t, err)
+			require.Equal(t, sender, from.Hex(), path)
+		}
+
+		// Wallets without an account only sign with their own key.
+		legacy := &Wallet{PrivateKey: wallet.PrivateKey, PublicKey: wallet.PublicKey}
+		_, err = eth.CreateSignedTransaction(legacy, `{"chainId": 1, "to": "0x337610d27c682E347C9cD60BD4b3b107C9d34dDd", "path": "0/1"}`)
+		require.ErrorIs(t, err, ErrInvalidPayload)
+		require.ErrorContains(t, err, "wallet was not derived from an HD seed")
+	})
+}
+
+// accountChangeScript returns the script of scriptType paying the change key
+// at 1/index of an exported account, as a watch-only wallet derives it.
+func accountChangeScript(t *testing.T, account *HDAccount, scriptType string, index uint32) []byte {
+	t.Helper()
+	return accountChildScript(t, account, scriptType, 1, index)
+}
+
+// accountChildScript returns the script of scriptType of the account key at
+// <chain>/<index>.
+func accountChildScript(t *testing.T, account *HDAccount, scriptType string, chain, index uint32) []byte {
+	t.Helper()
+	pubKey := accountChildKey(t, account, chain, index)
+	if scriptType == "v1_p2tr" {
+		script, err := txscript.PayToTaprootScript(txscript.ComputeTaprootKeyNoScript(pubKey))
+		require.NoError(t, err)
+		return script
+	}
+	return pubKeyHashScripts(btcutil.Hash160(pubKey.SerializeCompressed()))[scriptType]
+}
+
+func mustJSON(t *testing.T, v interface{}) string {
+	t.Helper()
+	b, err := json.Marshal(v)
+	require.NoError(t, err)
+	return string(b)
+}
+
+func decodeTestTx(t *testing.T, hexTx string) *wire.MsgTx {
+	t.Helper()
+	tx, err := decodeTx("tx", hexTx)
+	require.NoError(t, err)
+	return tx
+}
@@ -5,18 +5,35 @@ type BlockchainType string
 type Wallet struct {
 	PublicKey  string `json:"public_key"`
 	PrivateKey string `json:"private_key"`
+	// Account is the HD account the key was derived from. Wallets created
+	// before HD derivation, and imported ones, have none.
+	Account *HDAccount `json:"account,omitempty"`
+	// AccountKey is the extended private key of Account, kept so the wallet
+	// can sign for every key of the account. It stays in the wallet's
+	// storage entry and is never exported. Wallets created before it was
+	// kept only sign with their own key.
+	AccountKey string `json:"account_key,omitempty"`
+	// ChangeIndex counts the change keys of the account handed out, so the
+	// next change goes to the fresh key <Account.Path>/1/<ChangeIndex>.
+	ChangeIndex uint32 `json:"change_index,omitempty"`
 }
 
 const (
-	BlockchainETH        BlockchainType = "eth"
-	BlockchainBTC        BlockchainType = "btc"
-	BlockchainBTCTestnet BlockchainType = "tbtc"
+	BlockchainETH         BlockchainType = "eth"
+	BlockchainBTC         BlockchainType = "btc"
+	BlockchainBTCTestnet  BlockchainType = "tbtc" // testnet4
+	BlockchainBTCTestnet3 BlockchainType = "btc-testnet3"
+	BlockchainBTCSignet   BlockchainType = "btc-signet"
+	BlockchainBTCRegtest  BlockchainType = "btc-regtest"
 )
 
 var SupportedBlockchains = []BlockchainType{
 	BlockchainETH,
 	BlockchainBTC,
 	BlockchainBTCTestnet,
+	BlockchainBTCTestnet3,
+	BlockchainBTCSignet,
+	BlockchainBTCRegtest,
 }
 
 // validate
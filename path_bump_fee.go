@@ -0,0 +1,176 @@
+package vaultpoly
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/igwedaniel/vaultpoly/internal/adapters"
+)
+
+func pathBumpFee(b *pluginBackend) []*framework.Path {
+	walletFields := func() map[string]*framework.FieldSchema {
+		return map[string]*framework.FieldSchema{
+			"blockchainType": {
+				Type:          framework.TypeString,
+				Required:      true,
+				Description:   "The blockchain type for the account. Currently supported: 'btc', 'tbtc', 'btc-testnet3', 'btc-signet', 'btc-regtest'.",
+				AllowedValues: adapters.AllowedBlockchains(),
+			},
+			"address": {
+				Type:        framework.TypeString,
+				Required:    true,
+				Description: "The address of the wallet that signed the original transaction.",
+			},
+			"fee_rate": {
+				Type:        framework.TypeFloat,
+				Required:    true,
+				Description: "The new fee rate in sat/vbyte.",
+			},
+		}
+	}
+
+	bumpFields := walletFields()
+	bumpFields["payload"] = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Required:    true,
+		Description: "The payload the original transaction was signed from.",
+	}
+	bumpFields["tx"] = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Description: "The original signed transaction hex. Required when the payload used coin_selection, or paid an HD wallet's default change without change_path.",
+	}
+
+	cpfpFields := walletFields()
+	cpfpFields["parent_tx"] = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Required:    true,
+		Description: "The unconfirmed transaction hex whose outputs to this wallet are spent.",
+	}
+	cpfpFields["parent_utxos"] = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Required:    true,
+		Description: "JSON list of the UTXOs the parent transaction spends, with txid, vout, value and script_pub_key. The parent's fee is computed from them.",
+	}
+
+	return []*framework.Path{
+		{
+			Pattern:      "wallets/" + framework.GenericNameRegex("blockchainType") + "/" + framework.GenericNameRegex("address") + "/bump-fee",
+			HelpSynopsis: "Sign a BIP125 replacement of a transaction at a higher fee rate.",
+			HelpDescription: `
+	POST - re-sign a payment as a replacement paying fee_rate
+
+The replacement spends the same inputs and makes the same payments, with the
+extra fee taken from the change, which goes back to the key the original paid
+it to. Its fee must exceed the original's by at least 1 sat/vbyte of its size.
+`,
+			Fields: bumpFields,
+
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.UpdateOperation: b.bumpFee,
+			},
+		},
+		{
+			Pattern:      "wallets/" + framework.GenericNameRegex("blockchainType") + "/" + framework.GenericNameRegex("address") + "/cpfp",
+			HelpSynopsis: "Sign a child transaction that pays for an unconfirmed parent.",
+			HelpDescription: `
+	POST - spend the wallet's outputs of parent_tx, change included, back to the wallet
+
+The child pays enough fee that parent and child together pay fee_rate. The
+parent's fee is computed from parent_utxos, and each parent input must verify
+against the UTXO it spends. Only the values of legacy (non-segwit) UTXOs are
+not covered by the parent's signatures and are trusted.
+`,
+			Fields: cpfpFields,
+
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.UpdateOperation: b.childPaysForParent,
+			},
+		},
+	}
+}
+
+// feeBumper returns the adapter and wallet of a fee bump request.
+func (b *pluginBackend) feeBumper(ctx context.Context, req *logical.Request, d *framework.FieldData) (adapters.FeeBumper, *adapters.Wallet, error) {
+	blockchainType := adapters.BlockchainType(d.Get("blockchainType").(string))
+	if !blockchainType.IsValid() {
+		return nil, nil, fmt.Errorf("invalid blockchain type: %s", blockchainType)
+	}
+	adapter, err := b.getAdapter(ctx, req.Storage, blockchainType)
+	if err != nil {
+		return nil, nil, err
+	}
+	bumper, ok := adapter.(adapters.FeeBumper)
+	if !ok {
+		return nil, nil, logical.CodedError(http.StatusBadRequest, fmt.Sprintf("fee bumping is not supported for %s", blockchainType))
+	}
+
+	address := d.Get("address").(string)
+	wallet, err := b.getWallet(ctx, req.Storage, blockchainType, address)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if enforcer, ok := adapter.(adapters.PolicyEnforcer); ok {
+		policy, err := b.signingPolicy(ctx, req.Storage, blockchainType, address, false)
+		if err != nil {
+			return nil, nil, err
+		}
+		enforcer.SetPolicy(policy)
+	}
+	return bumper, wallet, nil
+}
+
+func (b *pluginBackend) bumpFee(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	payload := d.Get("payload").(string)
+	if payload == "" {
+		return nil, logical.CodedError(http.StatusBadRequest, "payload is required")
+	}
+
+	bumper, wallet, err := b.feeBumper(ctx, req, d)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := bumper.BumpFee(wallet, payload, d.Get("tx").(string), d.Get("fee_rate").(float64))
+	return feeBumpResponse(result, err)
+}
+
+func (b *pluginBackend) childPaysForParent(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	parentTx := d.Get("parent_tx").(string)
+	if parentTx == "" {
+		return nil, logical.CodedError(http.StatusBadRequest, "parent_tx is required")
+	}
+	parentUtxos := d.Get("parent_utxos").(string)
+	if parentUtxos == "" {
+		return nil, logical.CodedError(http.StatusBadRequest, "parent_utxos is required")
+	}
+
+	bumper, wallet, err := b.feeBumper(ctx, req, d)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := bumper.ChildPaysForParent(wallet, parentTx, parentUtxos, d.Get("fee_rate").(float64))
+	return feeBumpResponse(result, err)
+}
+
+func feeBumpResponse(result *adapters.SignResult, err error) (*logical.Response, error) {
+	if err != nil {
+		if errors.Is(err, adapters.ErrInvalidPayload) || errors.Is(err, adapters.ErrCapExceeded) {
+			return nil, logical.CodedError(http.StatusBadRequest, err.Error())
+		}
+		return nil, err
+	}
+
+	data := map[string]interface{}{
+		"signature": result.Tx,
+	}
+	for k, v := range result.Details {
+		data[k] = v
+	}
+	return &logical.Response{Data: data}, nil
+}
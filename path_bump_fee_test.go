@@ -0,0 +1,126 @@
+package vaultpoly
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/igwedaniel/vaultpoly/internal/adapters"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBumpFee(t *testing.T) {
+	b, s := getTestBackend(t)
+
+	resp, err := testWalletCreate(t, b, s, adapters.BlockchainBTCTestnet.String(), map[string]interface{}{})
+	require.NoError(t, err)
+	address := resp.Data["address"].(string)
+
+	addr, err := btcutil.DecodeAddress(address, &chaincfg.TestNet4Params)
+	require.NoError(t, err)
+	script, err := txscript.PayToAddrScript(addr)
+	require.NoError(t, err)
+	utxos := []adapters.UTXO{
+		{Txid: strings.Repeat("c", 64), Vout: 0, Value: 300000, ScriptPubKey: hex.EncodeToString(script), ScriptPubKeyType: "v0_p2wpkh"},
+	}
+	jsonB, err := json.Marshal(adapters.BtcPayload{
+		Recipient: "tb1qpn5dddjnc2qwurpsm449l6uvggnjxwsetrnksx",
+		Amount:    100000,
+		FeeRate:   1,
+		RBF:       true,
+		Utxos:     utxos,
+	})
+	require.NoError(t, err)
+	payload := string(jsonB)
+	parentUtxos, err := json.Marshal(utxos)
+	require.NoError(t, err)
+
+	signed, err := testWalletSign(t, b, s, adapters.BlockchainBTCTestnet.String(), address, map[string]interface{}{
+		"payload": payload,
+	})
+	require.NoError(t, err)
+
+	t.Run("Bump fee - pass", func(t *testing.T) {
+		resp, err := testFeeBump(t, b, s, "bump-fee", adapters.BlockchainBTCTestnet.String(), address, map[string]interface{}{
+			"payload":  payload,
+			"tx":       signed.Data["signature"],
+			"fee_rate": 4,
+		})
+		require.NoError(t, err)
+		require.NotEmpty(t, resp.Data["signature"])
+		require.NotEmpty(t, resp.Data["replaces_txid"])
+		require.Greater(t, resp.Data["fee"], signed.Data["fee"])
+	})
+
+	t.Run("Bump fee too small - fail", func(t *testing.T) {
+		_, err := testFeeBump(t, b, s, "bump-fee", adapters.BlockchainBTCTestnet.String(), address, map[string]interface{}{
+			"payload":  payload,
+			"tx":       signed.Data["signature"],
+			"fee_rate": 1,
+		})
+		require.ErrorContains(t, err, "fee_rate")
+	})
+
+	t.Run("CPFP - pass", func(t *testing.T) {
+		resp, err := testFeeBump(t, b, s, "cpfp", adapters.BlockchainBTCTestnet.String(), address, map[string]interface{}{
+			"parent_tx":    signed.Data["signature"],
+			"parent_utxos": string(parentUtxos),
+			"fee_rate":     8,
+		})
+		require.NoError(t, err)
+		require.NotEmpty(t, resp.Data["signature"])
+		require.Len(t, resp.Data["spent_utxos"], 1)
+	})
+
+	t.Run("CPFP with an inconsistent parent fee - fail", func(t *testing.T) {
+		inflated := []adapters.UTXO{utxos[0]}
+		inflated[0].Value += 50000
+		parentUtxos, err := json.Marshal(inflated)
+		require.NoError(t, err)
+		resp, err := testFeeBump(t, b, s, "cpfp", adapters.BlockchainBTCTestnet.String(), address, map[string]interface{}{
+			"parent_tx":    signed.Data["signature"],
+			"parent_utxos": string(parentUtxos),
+			"fee_rate":     8,
+		})
+		require.ErrorContains(t, err, "parent_utxos: input 0 of the parent does not spend")
+		require.Nil(t, resp)
+		var coded logical.HTTPCodedError
+		require.ErrorAs(t, err, &coded)
+		require.Equal(t, http.StatusBadRequest, coded.Code())
+	})
+
+	t.Run("CPFP without parent_utxos - fail", func(t *testing.T) {
+		_, err := testFeeBump(t, b, s, "cpfp", adapters.BlockchainBTCTestnet.String(), address, map[string]interface{}{
+			"parent_tx": signed.Data["signature"],
+			"fee_rate":  8,
+		})
+		require.ErrorContains(t, err, "parent_utxos is required")
+	})
+
+	t.Run("Bump fee for ETH - fail", func(t *testing.T) {
+		resp, err := testWalletCreate(t, b, s, adapters.BlockchainETH.String(), map[string]interface{}{})
+		require.NoError(t, err)
+		_, err = testFeeBump(t, b, s, "bump-fee", adapters.BlockchainETH.String(), resp.Data["address"].(string), map[string]interface{}{
+			"payload":  "{}",
+			"fee_rate": 4,
+		})
+		require.ErrorContains(t, err, "not supported")
+	})
+}
+
+func testFeeBump(t *testing.T, b *pluginBackend, s logical.Storage, operation, blockchainType, address string, d map[string]interface{}) (*logical.Response, error) {
+	t.Helper()
+	return b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "wallets/" + blockchainType + "/" + address + "/" + operation,
+		Data:      d,
+		Storage:   s,
+	})
+}
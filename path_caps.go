@@ -0,0 +1,203 @@
+package vaultpoly
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strconv"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/igwedaniel/vaultpoly/internal/adapters"
+)
+
+const chainCapsPrefix = "config/caps/"
+
+func pathCaps(b *pluginBackend) []*framework.Path {
+	fields := capsFields()
+	fields["chain_id"] = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Required:    true,
+		Description: "The EVM chain ID the caps apply to.",
+	}
+
+	return []*framework.Path{
+		{
+			Pattern:      "config/caps/?",
+			HelpSynopsis: "List the chains that have ethereum safety caps configured.",
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ListOperation: b.listChainCaps,
+			},
+		},
+		{
+			Pattern:      "config/caps/" + framework.GenericNameRegex("chain_id"),
+			HelpSynopsis: "Manage the ethereum safety caps enforced for a chain ID.",
+			HelpDescription: `
+
+    GET    - read the caps configured for a chain
+    POST   - set the caps for a chain; omitted fields keep their current value
+    DELETE - remove all caps for a chain
+
+Amounts are in wei. A cap of "" (or 0 for max_gas_limit) disables it.
+`,
+			Fields: fields,
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation:   b.readChainCaps,
+				logical.UpdateOperation: b.writeChainCaps,
+				logical.DeleteOperation: b.deleteChainCaps,
+			},
+		},
+	}
+}
+
+func capsFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"max_gas_price": {
+			Type:        framework.TypeString,
+			Description: "Maximum gas price (max fee per gas) in wei.",
+		},
+		"max_gas_limit": {
+			Type:        framework.TypeInt,
+			Description: "Maximum gas limit.",
+		},
+		"max_total_fee": {
+			Type:        framework.TypeString,
+			Description: "Maximum total fee (gas limit * gas price) in wei.",
+		},
+		"max_value": {
+			Type:        framework.TypeString,
+			Description: "Maximum transferred value in wei.",
+		},
+	}
+}
+
+// updateCaps applies the cap fields present in d to caps.
+func updateCaps(caps *adapters.TxCaps, d *framework.FieldData) error {
+	weiFields := map[string]**big.Int{
+		"max_gas_price": &caps.MaxGasPrice,
+		"max_total_fee": &caps.MaxTotalFee,
+		"max_value":     &caps.MaxValue,
+	}
+	for name, target := range weiFields {
+		raw, ok := d.GetOk(name)
+		if !ok {
+			continue
+		}
+		if raw.(string) == "" {
+			*target = nil
+			continue
+		}
+		v, ok := new(big.Int).SetString(raw.(string), 10)
+		if !ok || v.Sign() < 0 {
+			return fmt.Errorf("%s must be a non-negative integer amount of wei", name)
+		}
+		*target = v
+	}
+
+	if raw, ok := d.GetOk("max_gas_limit"); ok {
+		if raw.(int) < 0 {
+			return fmt.Errorf("max_gas_limit must not be negative")
+		}
+		caps.MaxGasLimit = uint64(raw.(int))
+	}
+	return nil
+}
+
+func capsResponseData(caps *adapters.TxCaps) map[string]interface{} {
+	weiString := func(v *big.Int) string {
+		if v == nil {
+			return ""
+		}
+		return v.String()
+	}
+	return map[string]interface{}{
+		"max_gas_price": weiString(caps.MaxGasPrice),
+		"max_gas_limit": caps.MaxGasLimit,
+		"max_total_fee": weiString(caps.MaxTotalFee),
+		"max_value":     weiString(caps.MaxValue),
+	}
+}
+
+func chainIDFromField(d *framework.FieldData) (uint64, error) {
+	chainID, err := strconv.ParseUint(d.Get("chain_id").(string), 10, 64)
+	if err != nil || chainID == 0 {
+		return 0, logical.CodedError(http.StatusBadRequest, "chain_id must be a positive integer")
+	}
+	return chainID, nil
+}
+
+func (b *pluginBackend) getChainCaps(ctx context.Context, s logical.Storage, chainID uint64) (*adapters.TxCaps, error) {
+	entry, err := s.Get(ctx, chainCapsPrefix+strconv.FormatUint(chainID, 10))
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+	var caps adapters.TxCaps
+	if err := entry.DecodeJSON(&caps); err != nil {
+		return nil, err
+	}
+	caps.Scope = fmt.Sprintf("chain %d", chainID)
+	return &caps, nil
+}
+
+func (b *pluginBackend) listChainCaps(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	vals, err := req.Storage.List(ctx, chainCapsPrefix)
+	if err != nil {
+		b.Logger().Error("Failed to list chain caps", "error", err)
+		return nil, err
+	}
+	return logical.ListResponse(vals), nil
+}
+
+func (b *pluginBackend) readChainCaps(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	chainID, err := chainIDFromField(d)
+	if err != nil {
+		return nil, err
+	}
+	caps, err := b.getChainCaps(ctx, req.Storage, chainID)
+	if err != nil {
+		return nil, err
+	}
+	if caps == nil {
+		return nil, nil
+	}
+	return &logical.Response{Data: capsResponseData(caps)}, nil
+}
+
+func (b *pluginBackend) writeChainCaps(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	chainID, err := chainIDFromField(d)
+	if err != nil {
+		return nil, err
+	}
+	caps, err := b.getChainCaps(ctx, req.Storage, chainID)
+	if err != nil {
+		return nil, err
+	}
+	if caps == nil {
+		caps = &adapters.TxCaps{}
+	}
+	if err := updateCaps(caps, d); err != nil {
+		return nil, logical.CodedError(http.StatusBadRequest, err.Error())
+	}
+
+	entry, err := logical.StorageEntryJSON(chainCapsPrefix+strconv.FormatUint(chainID, 10), caps)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(ctx, entry); err != nil {
+		b.Logger().Error("Failed to save chain caps", "chain_id", chainID, "error", err)
+		return nil, err
+	}
+	return &logical.Response{Data: capsResponseData(caps)}, nil
+}
+
+func (b *pluginBackend) deleteChainCaps(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	chainID, err := chainIDFromField(d)
+	if err != nil {
+		return nil, err
+	}
+	return nil, req.Storage.Delete(ctx, chainCapsPrefix+strconv.FormatUint(chainID, 10))
+}
@@ -0,0 +1,126 @@
+package vaultpoly
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/igwedaniel/vaultpoly/internal/adapters"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSafetyCaps(t *testing.T) {
+	b, s := getTestBackend(t)
+
+	resp, err := testWalletCreate(t, b, s, adapters.BlockchainETH.String(), map[string]interface{}{})
+	require.NoError(t, err)
+	address := resp.Data["address"].(string)
+
+	payload := func(gasPrice, value uint64) string {
+		jsonB, _ := json.Marshal(adapters.EthPayload{
+			ChainID:  97,
+			To:       "0x337610d27c682E347C9cD60BD4b3b107C9d34dDd",
+			Value:    value,
+			GasLimit: 21000,
+			GasPrice: gasPrice,
+		})
+		return string(jsonB)
+	}
+
+	t.Run("Chain caps - write and read", func(t *testing.T) {
+		resp, err := testCapsRequest(t, b, s, logical.UpdateOperation, "config/caps/97", map[string]interface{}{
+			"max_gas_price": "50000000000",
+			"max_gas_limit": 100000,
+		})
+		require.NoError(t, err)
+		require.Nil(t, resp.Error())
+
+		resp, err = testCapsRequest(t, b, s, logical.ReadOperation, "config/caps/97", nil)
+		require.NoError(t, err)
+		require.Equal(t, "50000000000", resp.Data["max_gas_price"])
+		require.Equal(t, uint64(100000), resp.Data["max_gas_limit"])
+		require.Equal(t, "", resp.Data["max_value"])
+	})
+
+	t.Run("Chain caps - invalid amount", func(t *testing.T) {
+		_, err := testCapsRequest(t, b, s, logical.UpdateOperation, "config/caps/97", map[string]interface{}{
+			"max_value": "-1",
+		})
+		require.Error(t, err)
+	})
+
+	t.Run("Sign within caps - pass", func(t *testing.T) {
+		resp, err := testWalletSign(t, b, s, adapters.BlockchainETH.String(), address, map[string]interface{}{
+			"payload": payload(1000000000, 1),
+		})
+		require.NoError(t, err)
+		require.NotEmpty(t, resp.Data["signature"])
+	})
+
+	t.Run("Sign above chain gas price cap - fail", func(t *testing.T) {
+		_, err := testWalletSign(t, b, s, adapters.BlockchainETH.String(), address, map[string]interface{}{
+			"payload": payload(60000000000, 1),
+		})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "max_gas_price")
+
+		var coded logical.HTTPCodedError
+		require.ErrorAs(t, err, &coded)
+		require.Equal(t, http.StatusBadRequest, coded.Code())
+	})
+
+	t.Run("Sign above wallet value cap - fail", func(t *testing.T) {
+		resp, err := testCapsRequest(t, b, s, logical.UpdateOperation, "wallets/eth/"+address+"/config", map[string]interface{}{
+			"max_value": "1000",
+		})
+		require.NoError(t, err)
+		require.Equal(t, "1000", resp.Data["max_value"])
+
+		_, err = testWalletSign(t, b, s, adapters.BlockchainETH.String(), address, map[string]interface{}{
+			"payload": payload(1000000000, 1001),
+		})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "wallet "+address+" max_value")
+	})
+
+	t.Run("Override caps on sign path - forbidden", func(t *testing.T) {
+		_, err := testWalletSign(t, b, s, adapters.BlockchainETH.String(), address, map[string]interface{}{
+			"payload":       payload(60000000000, 1001),
+			"override_caps": true,
+		})
+		require.Error(t, err)
+
+		var coded logical.HTTPCodedError
+		require.ErrorAs(t, err, &coded)
+		require.Equal(t, http.StatusForbidden, coded.Code())
+	})
+
+	t.Run("Override caps on override path - pass", func(t *testing.T) {
+		resp, err := testCapsRequest(t, b, s, logical.UpdateOperation, "wallets/eth/"+address+"/sign/override", map[string]interface{}{
+			"payload":       payload(60000000000, 1001),
+			"override_caps": true,
+		})
+		require.NoError(t, err)
+		require.NotEmpty(t, resp.Data["signature"])
+	})
+
+	t.Run("Override path without flag still enforces caps", func(t *testing.T) {
+		_, err := testCapsRequest(t, b, s, logical.UpdateOperation, "wallets/eth/"+address+"/sign/override", map[string]interface{}{
+			"payload": payload(60000000000, 1),
+		})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "max_gas_price")
+	})
+}
+
+func testCapsRequest(t *testing.T, b *pluginBackend, s logical.Storage, op logical.Operation, path string, d map[string]interface{}) (*logical.Response, error) {
+	t.Helper()
+	return b.HandleRequest(context.Background(), &logical.Request{
+		Operation: op,
+		Path:      path,
+		Data:      d,
+		Storage:   s,
+	})
+}
@@ -0,0 +1,142 @@
+package vaultpoly
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/igwedaniel/vaultpoly/internal/adapters"
+)
+
+const signetConfigPath = "config/signet"
+
+// signetConfig holds the parameters of a custom signet used by btc-signet.
+type signetConfig struct {
+	Challenge string `json:"challenge"` // hex block challenge script
+	Bech32HRP string `json:"bech32_hrp"`
+}
+
+func pathConfigSignet(b *pluginBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern:      "config/signet",
+			HelpSynopsis: "Configure the custom signet used by the btc-signet blockchain type.",
+			HelpDescription: `
+
+    GET    - read the custom signet parameters
+    POST   - set the custom signet parameters
+    DELETE - go back to the default signet
+
+Addresses are encoded with bech32_hrp, so wallets created before a change
+keep addresses of the previous prefix and can no longer sign.
+`,
+			Fields: map[string]*framework.FieldSchema{
+				"challenge": {
+					Type:        framework.TypeString,
+					Required:    true,
+					Description: "The hex block challenge script of the signet.",
+				},
+				"bech32_hrp": {
+					Type:        framework.TypeString,
+					Default:     "tb",
+					Description: "The human readable part of segwit addresses.",
+				},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation:   b.readSignetConfig,
+				logical.UpdateOperation: b.writeSignetConfig,
+				logical.DeleteOperation: b.deleteSignetConfig,
+			},
+		},
+	}
+}
+
+// getAdapter returns the adapter of blockchainType. btc-signet uses the
+// mount's custom signet when one is configured.
+func (b *pluginBackend) getAdapter(ctx context.Context, s logical.Storage, blockchainType adapters.BlockchainType) (adapters.BlockchainAdapter, error) {
+	if blockchainType != adapters.BlockchainBTCSignet {
+		return adapters.GetAdapter(blockchainType)
+	}
+	config, err := b.getSignetConfig(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		return adapters.GetAdapter(blockchainType)
+	}
+	challenge, err := hex.DecodeString(config.Challenge)
+	if err != nil {
+		return nil, fmt.Errorf("invalid stored signet challenge: %w", err)
+	}
+	return adapters.NewSignetAdapter(adapters.SignetConfig{Challenge: challenge, Bech32HRP: config.Bech32HRP}), nil
+}
+
+func (b *pluginBackend) getSignetConfig(ctx context.Context, s logical.Storage) (*signetConfig, error) {
+	entry, err := s.Get(ctx, signetConfigPath)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+	var config signetConfig
+	if err := entry.DecodeJSON(&config); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+func (b *pluginBackend) readSignetConfig(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	config, err := b.getSignetConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		return nil, nil
+	}
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"challenge":  config.Challenge,
+			"bech32_hrp": config.Bech32HRP,
+		},
+	}, nil
+}
+
+func (b *pluginBackend) writeSignetConfig(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	challenge := strings.ToLower(strings.TrimSpace(d.Get("challenge").(string)))
+	if raw, err := hex.DecodeString(challenge); err != nil || len(raw) == 0 {
+		return nil, logical.CodedError(http.StatusBadRequest, "challenge must be a non-empty hex script")
+	}
+
+	hrp := d.Get("bech32_hrp").(string)
+	if hrp == "" || len(hrp) > 83 || strings.Trim(hrp, "abcdefghijklmnopqrstuvwxyz0123456789") != "" {
+		return nil, logical.CodedError(http.StatusBadRequest, "bech32_hrp must be 1 to 83 lowercase letters and digits")
+	}
+	if hrp == "bc" {
+		return nil, logical.CodedError(http.StatusBadRequest, "bech32_hrp must not be the mainnet prefix bc")
+	}
+
+	config := &signetConfig{Challenge: challenge, Bech32HRP: hrp}
+	entry, err := logical.StorageEntryJSON(signetConfigPath, config)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(ctx, entry); err != nil {
+		b.Logger().Error("Failed to save signet config", "error", err)
+		return nil, err
+	}
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"challenge":  config.Challenge,
+			"bech32_hrp": config.Bech32HRP,
+		},
+	}, nil
+}
+
+func (b *pluginBackend) deleteSignetConfig(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	return nil, req.Storage.Delete(ctx, signetConfigPath)
+}
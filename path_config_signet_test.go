@@ -0,0 +1,101 @@
+package vaultpoly
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/igwedaniel/vaultpoly/internal/adapters"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBitcoinNetworks(t *testing.T) {
+	b, s := getTestBackend(t)
+
+	t.Run("Network address prefixes - pass", func(t *testing.T) {
+		for blockchainType, prefix := range map[adapters.BlockchainType]string{
+			adapters.BlockchainBTCTestnet3: "tb1q",
+			adapters.BlockchainBTCSignet:   "tb1q",
+			adapters.BlockchainBTCRegtest:  "bcrt1q",
+		} {
+			resp, err := testWalletCreate(t, b, s, blockchainType.String(), map[string]interface{}{})
+			require.NoError(t, err)
+			require.True(t, strings.HasPrefix(resp.Data["address"].(string), prefix), "%s address %s", blockchainType, resp.Data["address"])
+		}
+	})
+
+	t.Run("Sign on regtest - pass", func(t *testing.T) {
+		resp, err := testWalletCreate(t, b, s, adapters.BlockchainBTCRegtest.String(), map[string]interface{}{})
+		require.NoError(t, err)
+		address := resp.Data["address"].(string)
+
+		addr, err := btcutil.DecodeAddress(address, &chaincfg.RegressionNetParams)
+		require.NoError(t, err)
+		script, err := txscript.PayToAddrScript(addr)
+		require.NoError(t, err)
+		payload, err := json.Marshal(adapters.BtcPayload{
+			Recipient: address,
+			Amount:    50000,
+			FeeRate:   1,
+			Utxos: []adapters.UTXO{
+				{Txid: strings.Repeat("e", 64), Vout: 0, Value: 100000, ScriptPubKey: hex.EncodeToString(script), ScriptPubKeyType: "v0_p2wpkh"},
+			},
+		})
+		require.NoError(t, err)
+		resp, err = testWalletSign(t, b, s, adapters.BlockchainBTCRegtest.String(), address, map[string]interface{}{
+			"payload": string(payload),
+		})
+		require.NoError(t, err)
+		require.NotEmpty(t, resp.Data["signature"])
+	})
+
+	t.Run("Custom signet - pass", func(t *testing.T) {
+		resp, err := testSignetConfig(t, b, s, logical.UpdateOperation, map[string]interface{}{
+			"challenge":  "512103ad5e0edad18cb1f0fc0d28a3d4f1f3e445640337489abb10404f2d1e086be43051ae",
+			"bech32_hrp": "sb",
+		})
+		require.NoError(t, err)
+		require.Equal(t, "sb", resp.Data["bech32_hrp"])
+
+		resp, err = testWalletCreate(t, b, s, adapters.BlockchainBTCSignet.String(), map[string]interface{}{})
+		require.NoError(t, err)
+		require.True(t, strings.HasPrefix(resp.Data["address"].(string), "sb1q"))
+
+		resp, err = testSignetConfig(t, b, s, logical.ReadOperation, nil)
+		require.NoError(t, err)
+		require.Equal(t, "512103ad5e0edad18cb1f0fc0d28a3d4f1f3e445640337489abb10404f2d1e086be43051ae", resp.Data["challenge"])
+
+		_, err = testSignetConfig(t, b, s, logical.DeleteOperation, nil)
+		require.NoError(t, err)
+		resp, err = testWalletCreate(t, b, s, adapters.BlockchainBTCSignet.String(), map[string]interface{}{})
+		require.NoError(t, err)
+		require.True(t, strings.HasPrefix(resp.Data["address"].(string), "tb1q"))
+	})
+
+	t.Run("Invalid signet config - fail", func(t *testing.T) {
+		_, err := testSignetConfig(t, b, s, logical.UpdateOperation, map[string]interface{}{"challenge": "zz"})
+		require.ErrorContains(t, err, "challenge")
+
+		_, err = testSignetConfig(t, b, s, logical.UpdateOperation, map[string]interface{}{"challenge": "51", "bech32_hrp": "bc"})
+		require.ErrorContains(t, err, "mainnet")
+
+		_, err = testSignetConfig(t, b, s, logical.UpdateOperation, map[string]interface{}{"challenge": "51", "bech32_hrp": "Sb"})
+		require.ErrorContains(t, err, "bech32_hrp")
+	})
+}
+
+func testSignetConfig(t *testing.T, b *pluginBackend, s logical.Storage, op logical.Operation, d map[string]interface{}) (*logical.Response, error) {
+	t.Helper()
+	return b.HandleRequest(context.Background(), &logical.Request{
+		Operation: op,
+		Path:      "config/signet",
+		Data:      d,
+		Storage:   s,
+	})
+}
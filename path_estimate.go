@@ -0,0 +1,109 @@
+package vaultpoly
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/igwedaniel/vaultpoly/internal/adapters"
+)
+
+func pathEstimate(b *pluginBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern:      "wallets/" + framework.GenericNameRegex("blockchainType") + "/" + framework.GenericNameRegex("address") + "/estimate",
+			HelpSynopsis: "Estimate the fee of a transaction without signing it.",
+			HelpDescription: `
+	POST - run the payload's validation, coin selection and fee calculation
+
+The payload is the same as for the sign endpoint and is checked against the
+same fee limits and change allowlist. Nothing is signed, and the keys of HD
+wallets come from the account's extended public key.
+`,
+			Fields: map[string]*framework.FieldSchema{
+				"blockchainType": {
+					Type:          framework.TypeString,
+					Required:      true,
+					Description:   "The blockchain type for the account. Currently supported: 'btc', 'tbtc', 'btc-testnet3', 'btc-signet', 'btc-regtest'.",
+					AllowedValues: adapters.AllowedBlockchains(),
+				},
+				"address": {
+					Type:        framework.TypeString,
+					Required:    true,
+					Description: "The address of the wallet the payload spends from.",
+				},
+				"payload": {
+					Type:        framework.TypeString,
+					Required:    true,
+					Description: "The transaction payload, as for the sign endpoint.",
+				},
+			},
+
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.UpdateOperation: b.estimateFee,
+			},
+		},
+	}
+}
+
+func (b *pluginBackend) estimateFee(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	jsonPayload := d.Get("payload").(string)
+	if jsonPayload == "" {
+		return nil, logical.CodedError(http.StatusBadRequest, "payload is required")
+	}
+
+	blockchainType := adapters.BlockchainType(d.Get("blockchainType").(string))
+	if !blockchainType.IsValid() {
+		return nil, fmt.Errorf("invalid blockchain type: %s", blockchainType)
+	}
+	adapter, err := b.getAdapter(ctx, req.Storage, blockchainType)
+	if err != nil {
+		return nil, err
+	}
+	estimator, ok := adapter.(adapters.FeeEstimator)
+	if !ok {
+		return nil, logical.CodedError(http.StatusBadRequest, fmt.Sprintf("fee estimation is not supported for %s", blockchainType))
+	}
+
+	walletAddress := d.Get("address").(string)
+	wallet, err := b.getWallet(ctx, req.Storage, blockchainType, walletAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	if enforcer, ok := adapter.(adapters.PolicyEnforcer); ok {
+		policy, err := b.signingPolicy(ctx, req.Storage, blockchainType, walletAddress, false)
+		if err != nil {
+			return nil, err
+		}
+		enforcer.SetPolicy(policy)
+	}
+
+	estimate, err := estimator.EstimateFee(wallet, jsonPayload)
+	if err != nil {
+		if errors.Is(err, adapters.ErrInvalidPayload) || errors.Is(err, adapters.ErrCapExceeded) {
+			return nil, logical.CodedError(http.StatusBadRequest, err.Error())
+		}
+		return nil, err
+	}
+
+	data := map[string]interface{}{
+		"fee":            estimate.EstimatedFee,
+		"vsize":          estimate.TxSize,
+		"change_value":   estimate.ChangeValue,
+		"num_outputs":    estimate.NumOutputs,
+		"dust_absorbed":  estimate.DustAbsorbed,
+		"selected_utxos": adapters.UTXORefs(estimate.SelectedUtxos),
+		"unused_utxos":   adapters.UTXORefs(estimate.UnusedUtxos),
+	}
+	if estimate.SendAmount != 0 {
+		data["amount"] = estimate.SendAmount
+	}
+	if estimate.Subtracted != 0 {
+		data["subtracted_fee"] = estimate.Subtracted
+	}
+	return &logical.Response{Data: data}, nil
+}
@@ -0,0 +1,244 @@
+package vaultpoly
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/igwedaniel/vaultpoly/internal/adapters"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEstimateFee(t *testing.T) {
+	b, s := getTestBackend(t)
+
+	resp, err := testWalletCreate(t, b, s, adapters.BlockchainBTCTestnet.String(), map[string]interface{}{})
+	require.NoError(t, err)
+	address := resp.Data["address"].(string)
+
+	addr, err := btcutil.DecodeAddress(address, &chaincfg.TestNet4Params)
+	require.NoError(t, err)
+	script, err := txscript.PayToAddrScript(addr)
+	require.NoError(t, err)
+	utxos := []adapters.UTXO{
+		{Txid: strings.Repeat("a", 64), Vout: 0, Value: 300000, ScriptPubKey: hex.EncodeToString(script), ScriptPubKeyType: "v0_p2wpkh"},
+		{Txid: strings.Repeat("b", 64), Vout: 1, Value: 120000, ScriptPubKey: hex.EncodeToString(script), ScriptPubKeyType: "v0_p2wpkh"},
+	}
+	recipient := "tb1qpn5dddjnc2qwurpsm449l6uvggnjxwsetrnksx"
+
+	t.Run("Estimate matches signed transaction - pass", func(t *testing.T) {
+		jsonB, err := json.Marshal(adapters.BtcPayload{
+			Recipient:     recipient,
+			Amount:        100000,
+			FeeRate:       3,
+			Utxos:         utxos,
+			CoinSelection: adapters.CoinSelectionLargestFirst,
+		})
+		require.NoError(t, err)
+
+		estimate, err := testEstimateFee(t, b, s, adapters.BlockchainBTCTestnet.String(), address, string(jsonB))
+		require.NoError(t, err)
+		require.Equal(t, 141, estimate.Data["vsize"])
+		require.Equal(t, int64(423), estimate.Data["fee"])
+		require.Equal(t, int64(300000-100000-423), estimate.Data["change_value"])
+		require.Equal(t, 2, estimate.Data["num_outputs"])
+		require.Equal(t, false, estimate.Data["dust_absorbed"])
+		require.Equal(t, []string{strings.Repeat("a", 64) + ":0"}, estimate.Data["selected_utxos"])
+
+		signed, err := testWalletSign(t, b, s, adapters.BlockchainBTCTestnet.String(), address, map[string]interface{}{
+			"payload": string(jsonB),
+		})
+		require.NoError(t, err)
+		require.Equal(t, estimate.Data["fee"], signed.Data["fee"])
+		require.Equal(t, estimate.Data["selected_utxos"], signed.Data["selected_utxos"])
+	})
+
+	t.Run("Estimate send max - pass", func(t *testing.T) {
+		jsonB, err := json.Marshal(adapters.BtcPayload{
+			Recipient: recipient,
+			FeeRate:   3,
+			Utxos:     utxos,
+			SendMax:   true,
+		})
+		require.NoError(t, err)
+
+		estimate, err := testEstimateFee(t, b, s, adapters.BlockchainBTCTestnet.String(), address, string(jsonB))
+		require.NoError(t, err)
+		require.Equal(t, 1, estimate.Data["num_outputs"])
+		require.Equal(t, int64(0), estimate.Data["change_value"])
+		require.Equal(t, int64(420000)-estimate.Data["fee"].(int64), estimate.Data["amount"])
+
+		signed, err := testWalletSign(t, b, s, adapters.BlockchainBTCTestnet.String(), address, map[string]interface{}{
+			"payload": string(jsonB),
+		})
+		require.NoError(t, err)
+		require.Equal(t, estimate.Data["fee"], signed.Data["fee"])
+		require.Equal(t, estimate.Data["amount"], signed.Data["amount"])
+	})
+
+	t.Run("Change absorbed as dust - pass", func(t *testing.T) {
+		estimate, err := testEstimateFee(t, b, s, adapters.BlockchainBTCTestnet.String(), address,
+			testBtcPayload(119500, recipient, utxos[1:]))
+		require.NoError(t, err)
+		require.Equal(t, 1, estimate.Data["num_outputs"])
+		require.Equal(t, true, estimate.Data["dust_absorbed"])
+		require.Equal(t, int64(500), estimate.Data["fee"])
+	})
+
+	t.Run("Estimate for P2WSH and P2TR destinations - pass", func(t *testing.T) {
+		jsonB, err := json.Marshal(adapters.BtcPayload{
+			Outputs: []adapters.BtcOutput{
+				{Address: "tb1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3q0sl5k7", Amount: 100000},
+				{Address: "tb1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vq47zagq", Amount: 50000},
+			},
+			FeeRate: 1,
+			Utxos:   utxos[:1],
+		})
+		require.NoError(t, err)
+
+		estimate, err := testEstimateFee(t, b, s, adapters.BlockchainBTCTestnet.String(), address, string(jsonB))
+		require.NoError(t, err)
+		// 782 WU: 40 overhead + 2 marker + 272 input + 172 + 172 payments + 124 change.
+		require.Equal(t, 196, estimate.Data["vsize"])
+		require.Equal(t, int64(196), estimate.Data["fee"])
+		require.Equal(t, 3, estimate.Data["num_outputs"])
+	})
+
+	t.Run("Estimate with P2TR change - pass", func(t *testing.T) {
+		jsonB, err := json.Marshal(adapters.BtcPayload{
+			Recipient:  recipient,
+			Amount:     100000,
+			FeeRate:    1,
+			Utxos:      utxos[:1],
+			ChangeType: adapters.AddressTypeP2TR,
+		})
+		require.NoError(t, err)
+
+		estimate, err := testEstimateFee(t, b, s, adapters.BlockchainBTCTestnet.String(), address, string(jsonB))
+		require.NoError(t, err)
+		// 610 WU: 40 overhead + 2 marker + 272 input + 124 payment + 172 P2TR change.
+		require.Equal(t, 153, estimate.Data["vsize"])
+	})
+
+	t.Run("Foreign UTXO - fail", func(t *testing.T) {
+		foreign := utxos[0]
+		foreign.ScriptPubKey = "00140ce8d6b653c280ee0c30dd6a5feb8c42272339a1"
+		_, err := testEstimateFee(t, b, s, adapters.BlockchainBTCTestnet.String(), address,
+			testBtcPayload(100000, recipient, []adapters.UTXO{foreign}))
+		require.ErrorContains(t, err, "does not match")
+	})
+
+	t.Run("Estimate for ETH - fail", func(t *testing.T) {
+		resp, err := testWalletCreate(t, b, s, adapters.BlockchainETH.String(), map[string]interface{}{})
+		require.NoError(t, err)
+		_, err = testEstimateFee(t, b, s, adapters.BlockchainETH.String(), resp.Data["address"].(string), "{}")
+		require.ErrorContains(t, err, "not supported")
+	})
+}
+
+func TestEstimateAndSignAgree(t *testing.T) {
+	b, s := getTestBackend(t)
+	tbtc := adapters.BlockchainBTCTestnet.String()
+
+	resp, err := testWalletCreate(t, b, s, tbtc, map[string]interface{}{})
+	require.NoError(t, err)
+	address := resp.Data["address"].(string)
+	_, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "wallets/" + tbtc + "/" + address + "/config",
+		Data:      map[string]interface{}{"max_fee_rate": 50, "max_fee_ratio": 0.5},
+		Storage:   s,
+	})
+	require.NoError(t, err)
+
+	addr, err := btcutil.DecodeAddress(address, &chaincfg.TestNet4Params)
+	require.NoError(t, err)
+	script, err := txscript.PayToAddrScript(addr)
+	require.NoError(t, err)
+	final := uint32(0xffffffff)
+	utxo := adapters.UTXO{Txid: strings.Repeat("c", 64), Value: 300000, ScriptPubKey: hex.EncodeToString(script), ScriptPubKeyType: "v0_p2wpkh"}
+	finalUtxo := utxo
+	finalUtxo.Sequence = &final
+	recipient := "tb1qpn5dddjnc2qwurpsm449l6uvggnjxwsetrnksx"
+
+	cases := []struct {
+		Name    string
+		Payload adapters.BtcPayload
+		Error   string // empty when both accept the payload
+	}{
+		{
+			Name:    "Valid payment",
+			Payload: adapters.BtcPayload{Recipient: recipient, Amount: 100000, FeeRate: 2, Utxos: []adapters.UTXO{utxo}},
+		},
+		{
+			Name:    "Fee rate above the wallet limit",
+			Payload: adapters.BtcPayload{Recipient: recipient, Amount: 100000, FeeRate: 60, Utxos: []adapters.UTXO{utxo}},
+			Error:   "max_fee_rate is 50",
+		},
+		{
+			Name:    "Absolute fee above the wallet limit",
+			Payload: adapters.BtcPayload{Recipient: recipient, Amount: 100000, AbsoluteFee: 20000, Utxos: []adapters.UTXO{utxo}},
+			Error:   "max_fee_rate is 50",
+		},
+		{
+			Name:    "Fee above the wallet ratio",
+			Payload: adapters.BtcPayload{Recipient: recipient, Amount: 1000, FeeRate: 10, Utxos: []adapters.UTXO{utxo}},
+			Error:   "max_fee_ratio is 0.5",
+		},
+		{
+			Name:    "Locktime with final sequences",
+			Payload: adapters.BtcPayload{Recipient: recipient, Amount: 100000, FeeRate: 2, Locktime: 800000, Utxos: []adapters.UTXO{finalUtxo}},
+			Error:   "locktime",
+		},
+		{
+			Name:    "RBF with final sequences",
+			Payload: adapters.BtcPayload{Recipient: recipient, Amount: 100000, FeeRate: 2, RBF: true, Utxos: []adapters.UTXO{finalUtxo}},
+			Error:   "rbf",
+		},
+		{
+			Name:    "Change address not allowlisted",
+			Payload: adapters.BtcPayload{Recipient: recipient, Amount: 100000, FeeRate: 2, ChangeAddress: recipient, Utxos: []adapters.UTXO{utxo}},
+			Error:   "change_address",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			jsonB, err := json.Marshal(tc.Payload)
+			require.NoError(t, err)
+
+			estimate, estimateErr := testEstimateFee(t, b, s, tbtc, address, string(jsonB))
+			signed, signErr := testWalletSign(t, b, s, tbtc, address, map[string]interface{}{"payload": string(jsonB)})
+			if tc.Error == "" {
+				require.NoError(t, estimateErr)
+				require.NoError(t, signErr)
+				require.Equal(t, estimate.Data["fee"], signed.Data["fee"])
+				return
+			}
+
+			for _, err := range []error{estimateErr, signErr} {
+				require.ErrorContains(t, err, tc.Error)
+				var coded logical.HTTPCodedError
+				require.ErrorAs(t, err, &coded)
+				require.Equal(t, http.StatusBadRequest, coded.Code())
+			}
+		})
+	}
+}
+
+func testEstimateFee(t *testing.T, b *pluginBackend, s logical.Storage, blockchainType, address, payload string) (*logical.Response, error) {
+	t.Helper()
+	return b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "wallets/" + blockchainType + "/" + address + "/estimate",
+		Data:      map[string]interface{}{"payload": payload},
+		Storage:   s,
+	})
+}
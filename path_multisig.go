@@ -0,0 +1,294 @@
+package vaultpoly
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/igwedaniel/vaultpoly/internal/adapters"
+)
+
+// multisigEntry is a stored multisig wallet. It holds public keys only and is
+// stored outside the wallets/ prefix so listing wallets is unaffected.
+type multisigEntry struct {
+	adapters.Multisig
+	// InternalKeys are the addresses of the wallets in this mount whose keys
+	// are part of the multisig.
+	InternalKeys []string `json:"internal_keys"`
+}
+
+func multisigPath(blockchainType adapters.BlockchainType, address string) string {
+	return fmt.Sprintf("multisig/%s/%s", blockchainType, address)
+}
+
+func pathMultisig(b *pluginBackend) []*framework.Path {
+	blockchainTypeField := &framework.FieldSchema{
+		Type:          framework.TypeString,
+		Required:      true,
+		Description:   "The blockchain type for the multisig. Currently supported: 'btc', 'tbtc', 'btc-testnet3', 'btc-signet', 'btc-regtest'.",
+		AllowedValues: adapters.AllowedBlockchains(),
+	}
+	addressField := &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Required:    true,
+		Description: "The address of the multisig.",
+	}
+
+	return []*framework.Path{
+		{
+			Pattern:      "multisig/" + framework.GenericNameRegex("blockchainType") + "/?",
+			HelpSynopsis: "List and create M-of-N multisig wallets.",
+			HelpDescription: `
+
+    LIST - list the multisig wallets of a blockchain type
+    POST - create a sortedmulti wallet of threshold of the given keys
+
+internal_keys are addresses of wallets in this mount; public_keys are external
+hex public keys or extended public keys with an optional non-hardened path,
+e.g. tpub.../0/3. Only public keys are stored with the multisig.
+`,
+			Fields: map[string]*framework.FieldSchema{
+				"blockchainType": blockchainTypeField,
+				"threshold": {
+					Type:        framework.TypeInt,
+					Required:    true,
+					Description: "The number of signatures needed to spend.",
+				},
+				"internal_keys": {
+					Type:        framework.TypeCommaStringSlice,
+					Description: "Addresses of wallets in this mount whose keys sign for the multisig.",
+				},
+				"public_keys": {
+					Type:        framework.TypeCommaStringSlice,
+					Description: "External hex public keys or extended public keys.",
+				},
+				"address_type": {
+					Type:        framework.TypeString,
+					Default:     adapters.MultisigTypeP2WSH,
+					Description: "The multisig address type: 'p2wsh' (default) or 'p2sh_p2wsh'.",
+				},
+			},
+
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ListOperation:   b.listMultisigs,
+				logical.UpdateOperation: b.createMultisig,
+			},
+		},
+		{
+			Pattern:      "multisig/" + framework.GenericNameRegex("blockchainType") + "/" + framework.GenericNameRegex("address"),
+			HelpSynopsis: "Read a multisig wallet.",
+			HelpDescription: `
+
+    GET - read the keys, threshold and scripts of a multisig wallet
+
+`,
+			Fields: map[string]*framework.FieldSchema{
+				"blockchainType": blockchainTypeField,
+				"address":        addressField,
+			},
+
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation: b.readMultisig,
+			},
+		},
+		{
+			Pattern:      "multisig/" + framework.GenericNameRegex("blockchainType") + "/" + framework.GenericNameRegex("address") + "/sign-psbt/" + framework.GenericNameRegex("signer"),
+			HelpSynopsis: "Add one internal key's signatures to a PSBT spending a multisig.",
+			HelpDescription: `
+	POST - sign the PSBT inputs spending the multisig with the signer wallet
+
+Each internal key signs on its own path, so policies can grant each signer
+separately. With finalize=true the multisig inputs must have threshold
+signatures; they are finalized and the raw transaction hex is returned.
+`,
+			Fields: map[string]*framework.FieldSchema{
+				"blockchainType": blockchainTypeField,
+				"address":        addressField,
+				"signer": {
+					Type:        framework.TypeString,
+					Required:    true,
+					Description: "The address of the internal wallet that signs.",
+				},
+				"psbt": {
+					Type:        framework.TypeString,
+					Required:    true,
+					Description: "The base64 encoded PSBT.",
+				},
+				"finalize": {
+					Type:        framework.TypeBool,
+					Default:     false,
+					Description: "Finalize the PSBT and extract the raw transaction.",
+				},
+			},
+
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.UpdateOperation: b.signMultisigPSBT,
+			},
+		},
+	}
+}
+
+// multisigSigner returns the multisig adapter of a blockchain type.
+func (b *pluginBackend) multisigSigner(ctx context.Context, s logical.Storage, blockchainType adapters.BlockchainType) (adapters.MultisigSigner, error) {
+	if !blockchainType.IsValid() {
+		return nil, fmt.Errorf("invalid blockchain type: %s", blockchainType)
+	}
+	adapter, err := b.getAdapter(ctx, s, blockchainType)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := adapter.(adapters.MultisigSigner)
+	if !ok {
+		return nil, logical.CodedError(http.StatusBadRequest, fmt.Sprintf("multisig wallets are not supported for %s", blockchainType))
+	}
+	return signer, nil
+}
+
+func (b *pluginBackend) listMultisigs(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	vals, err := req.Storage.List(ctx, "multisig/"+d.Get("blockchainType").(string)+"/")
+	if err != nil {
+		return nil, err
+	}
+	return logical.ListResponse(vals), nil
+}
+
+func (b *pluginBackend) createMultisig(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	blockchainType := adapters.BlockchainType(d.Get("blockchainType").(string))
+	signer, err := b.multisigSigner(ctx, req.Storage, blockchainType)
+	if err != nil {
+		return nil, err
+	}
+
+	internalKeys := d.Get("internal_keys").([]string)
+	internal := make([]*adapters.Wallet, 0, len(internalKeys))
+	for _, address := range internalKeys {
+		wallet, err := b.getWallet(ctx, req.Storage, blockchainType, address)
+		if err != nil {
+			return nil, err
+		}
+		internal = append(internal, wallet)
+	}
+
+	multisig, err := signer.NewMultisig(d.Get("threshold").(int), internal, d.Get("public_keys").([]string), d.Get("address_type").(string))
+	if err != nil {
+		if errors.Is(err, adapters.ErrInvalidPayload) {
+			return nil, logical.CodedError(http.StatusBadRequest, err.Error())
+		}
+		return nil, err
+	}
+
+	path := multisigPath(blockchainType, multisig.Address)
+	existing, err := req.Storage.Get(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, logical.CodedError(http.StatusConflict, fmt.Sprintf("multisig %s already exists", multisig.Address))
+	}
+
+	entry := &multisigEntry{Multisig: *multisig, InternalKeys: internalKeys}
+	storageEntry, err := logical.StorageEntryJSON(path, entry)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(ctx, storageEntry); err != nil {
+		b.Logger().Error("Failed to save the multisig to storage", "error", err)
+		return nil, err
+	}
+	return &logical.Response{Data: entry.responseData()}, nil
+}
+
+func (b *pluginBackend) getMultisig(ctx context.Context, s logical.Storage, blockchainType adapters.BlockchainType, address string) (*multisigEntry, error) {
+	entry, err := s.Get(ctx, multisigPath(blockchainType, address))
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, logical.CodedError(http.StatusExpectationFailed, fmt.Sprintf("no multisig found for address: %s", address))
+	}
+	var multisig multisigEntry
+	if err := entry.DecodeJSON(&multisig); err != nil {
+		return nil, err
+	}
+	return &multisig, nil
+}
+
+func (b *pluginBackend) readMultisig(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	multisig, err := b.getMultisig(ctx, req.Storage, adapters.BlockchainType(d.Get("blockchainType").(string)), d.Get("address").(string))
+	if err != nil {
+		return nil, err
+	}
+	return &logical.Response{Data: multisig.responseData()}, nil
+}
+
+func (b *pluginBackend) signMultisigPSBT(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	packet := d.Get("psbt").(string)
+	if packet == "" {
+		return nil, logical.CodedError(http.StatusBadRequest, "psbt is required")
+	}
+
+	blockchainType := adapters.BlockchainType(d.Get("blockchainType").(string))
+	signer, err := b.multisigSigner(ctx, req.Storage, blockchainType)
+	if err != nil {
+		return nil, err
+	}
+	multisig, err := b.getMultisig(ctx, req.Storage, blockchainType, d.Get("address").(string))
+	if err != nil {
+		return nil, err
+	}
+
+	signerAddress := d.Get("signer").(string)
+	if !slices.Contains(multisig.InternalKeys, signerAddress) {
+		return nil, logical.CodedError(http.StatusBadRequest, fmt.Sprintf("wallet %s is not an internal key of multisig %s", signerAddress, multisig.Address))
+	}
+	wallet, err := b.getWallet(ctx, req.Storage, blockchainType, signerAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	// The signer's fee limits apply to every transaction its key signs.
+	if enforcer, ok := signer.(adapters.PolicyEnforcer); ok {
+		policy, err := b.signingPolicy(ctx, req.Storage, blockchainType, signerAddress, false)
+		if err != nil {
+			return nil, err
+		}
+		enforcer.SetPolicy(policy)
+	}
+
+	result, err := signer.SignMultisigPSBT(&multisig.Multisig, wallet, packet, d.Get("finalize").(bool))
+	if err != nil {
+		if errors.Is(err, adapters.ErrInvalidPayload) || errors.Is(err, adapters.ErrCapExceeded) {
+			return nil, logical.CodedError(http.StatusBadRequest, err.Error())
+		}
+		return nil, err
+	}
+
+	data := map[string]interface{}{
+		"psbt":          result.PSBT,
+		"signed_inputs": result.SignedInputs,
+		"complete":      result.Complete,
+	}
+	if result.Tx != "" {
+		data["tx"] = result.Tx
+	}
+	return &logical.Response{Data: data}, nil
+}
+
+func (m *multisigEntry) responseData() map[string]interface{} {
+	data := map[string]interface{}{
+		"address":        m.Address,
+		"address_type":   m.AddressType,
+		"threshold":      m.Threshold,
+		"public_keys":    m.PublicKeys,
+		"internal_keys":  m.InternalKeys,
+		"witness_script": m.WitnessScript,
+	}
+	if m.RedeemScript != "" {
+		data["redeem_script"] = m.RedeemScript
+	}
+	return data
+}
@@ -0,0 +1,169 @@
+package vaultpoly
+
+import (
+	"context"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/psbt"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/igwedaniel/vaultpoly/internal/adapters"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMultisig(t *testing.T) {
+	b, s := getTestBackend(t)
+	tbtc := adapters.BlockchainBTCTestnet.String()
+
+	signers := make([]string, 2)
+	for i := range signers {
+		resp, err := testWalletCreate(t, b, s, tbtc, map[string]interface{}{})
+		require.NoError(t, err)
+		signers[i] = resp.Data["address"].(string)
+	}
+	external, err := btcec.NewPrivateKey()
+	require.NoError(t, err)
+	externalKey := hex.EncodeToString(external.PubKey().SerializeCompressed())
+
+	resp, err := testMultisigRequest(t, b, s, logical.UpdateOperation, "multisig/"+tbtc, map[string]interface{}{
+		"threshold":     2,
+		"internal_keys": strings.Join(signers, ","),
+		"public_keys":   externalKey,
+	})
+	require.NoError(t, err)
+	address := resp.Data["address"].(string)
+	require.Len(t, resp.Data["public_keys"], 3)
+	require.NotContains(t, resp.Data, "private_key")
+
+	t.Run("Read and list - pass", func(t *testing.T) {
+		resp, err := testMultisigRequest(t, b, s, logical.ReadOperation, "multisig/"+tbtc+"/"+address, nil)
+		require.NoError(t, err)
+		require.Equal(t, 2, resp.Data["threshold"])
+		require.Equal(t, signers, resp.Data["internal_keys"])
+
+		resp, err = testMultisigRequest(t, b, s, logical.ListOperation, "multisig/"+tbtc+"/", nil)
+		require.NoError(t, err)
+		require.Equal(t, []string{address}, resp.Data["keys"])
+
+		resp, err = testListWallets(t, b, s, tbtc)
+		require.NoError(t, err)
+		require.ElementsMatch(t, signers, resp.Data["keys"], "multisigs are not listed as wallets")
+	})
+
+	t.Run("Create twice - fail", func(t *testing.T) {
+		_, err := testMultisigRequest(t, b, s, logical.UpdateOperation, "multisig/"+tbtc, map[string]interface{}{
+			"threshold":     2,
+			"internal_keys": strings.Join(signers, ","),
+			"public_keys":   externalKey,
+		})
+		require.ErrorContains(t, err, "already exists")
+	})
+
+	t.Run("Invalid threshold - fail", func(t *testing.T) {
+		_, err := testMultisigRequest(t, b, s, logical.UpdateOperation, "multisig/"+tbtc, map[string]interface{}{
+			"threshold":     4,
+			"internal_keys": strings.Join(signers, ","),
+			"public_keys":   externalKey,
+		})
+		require.ErrorContains(t, err, "threshold")
+	})
+
+	t.Run("Each signer adds a signature - pass", func(t *testing.T) {
+		addr, err := btcutil.DecodeAddress(address, &chaincfg.TestNet4Params)
+		require.NoError(t, err)
+		pkScript, err := txscript.PayToAddrScript(addr)
+		require.NoError(t, err)
+
+		funding := wire.NewMsgTx(2)
+		funding.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{0x07}, 0), nil, nil))
+		funding.AddTxOut(wire.NewTxOut(100000, pkScript))
+		fundingHash := funding.TxHash()
+
+		tx := wire.NewMsgTx(2)
+		tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&fundingHash, 0), nil, nil))
+		tx.AddTxOut(wire.NewTxOut(90000, pkScript))
+		packet, err := psbt.NewFromUnsignedTx(tx)
+		require.NoError(t, err)
+		packet.Inputs[0].WitnessUtxo = funding.TxOut[0]
+		packet.Inputs[0].NonWitnessUtxo = funding
+		encoded, err := packet.B64Encode()
+		require.NoError(t, err)
+
+		resp, err := testMultisigRequest(t, b, s, logical.UpdateOperation, "multisig/"+tbtc+"/"+address+"/sign-psbt/"+signers[0], map[string]interface{}{
+			"psbt": encoded,
+		})
+		require.NoError(t, err)
+		require.Equal(t, false, resp.Data["complete"])
+
+		resp, err = testMultisigRequest(t, b, s, logical.UpdateOperation, "multisig/"+tbtc+"/"+address+"/sign-psbt/"+signers[1], map[string]interface{}{
+			"psbt":     resp.Data["psbt"],
+			"finalize": true,
+		})
+		require.NoError(t, err)
+		require.Equal(t, true, resp.Data["complete"])
+		require.NotEmpty(t, resp.Data["tx"])
+	})
+
+	t.Run("Fee above the signer's limit - fail", func(t *testing.T) {
+		addr, err := btcutil.DecodeAddress(address, &chaincfg.TestNet4Params)
+		require.NoError(t, err)
+		pkScript, err := txscript.PayToAddrScript(addr)
+		require.NoError(t, err)
+
+		funding := wire.NewMsgTx(2)
+		funding.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{0x08}, 0), nil, nil))
+		funding.AddTxOut(wire.NewTxOut(100000, pkScript))
+		fundingHash := funding.TxHash()
+		tx := wire.NewMsgTx(2)
+		tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&fundingHash, 0), nil, nil))
+		tx.AddTxOut(wire.NewTxOut(90000, pkScript))
+		packet, err := psbt.NewFromUnsignedTx(tx)
+		require.NoError(t, err)
+		packet.Inputs[0].NonWitnessUtxo = funding
+		encoded, err := packet.B64Encode()
+		require.NoError(t, err)
+
+		_, err = testMultisigRequest(t, b, s, logical.UpdateOperation, "wallets/"+tbtc+"/"+signers[0]+"/config", map[string]interface{}{
+			"max_fee": 5000,
+		})
+		require.NoError(t, err)
+		_, err = testMultisigRequest(t, b, s, logical.UpdateOperation, "multisig/"+tbtc+"/"+address+"/sign-psbt/"+signers[0], map[string]interface{}{
+			"psbt": encoded,
+		})
+		require.ErrorContains(t, err, "max_fee is 5000 sats, the fee is 10000 sats")
+	})
+
+	t.Run("Signer outside the multisig - fail", func(t *testing.T) {
+		resp, err := testWalletCreate(t, b, s, tbtc, map[string]interface{}{})
+		require.NoError(t, err)
+		_, err = testMultisigRequest(t, b, s, logical.UpdateOperation, "multisig/"+tbtc+"/"+address+"/sign-psbt/"+resp.Data["address"].(string), map[string]interface{}{
+			"psbt": "cHNidP8=",
+		})
+		require.ErrorContains(t, err, "not an internal key")
+	})
+
+	t.Run("Multisig for ETH - fail", func(t *testing.T) {
+		_, err := testMultisigRequest(t, b, s, logical.UpdateOperation, "multisig/"+adapters.BlockchainETH.String(), map[string]interface{}{
+			"threshold":   1,
+			"public_keys": externalKey,
+		})
+		require.ErrorContains(t, err, "not supported")
+	})
+}
+
+func testMultisigRequest(t *testing.T, b *pluginBackend, s logical.Storage, op logical.Operation, path string, d map[string]interface{}) (*logical.Response, error) {
+	t.Helper()
+	return b.HandleRequest(context.Background(), &logical.Request{
+		Operation: op,
+		Path:      path,
+		Data:      d,
+		Storage:   s,
+	})
+}
@@ -2,15 +2,44 @@ package vaultpoly
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/locksutil"
 	"github.com/hashicorp/vault/sdk/logical"
 	"github.com/igwedaniel/vaultpoly/internal/adapters"
 )
 
+const signOverrideSuffix = "/sign/override"
+
 func pathSign(b *pluginBackend) []*framework.Path {
+	fields := map[string]*framework.FieldSchema{
+		"blockchainType": {
+			Type:          framework.TypeString,
+			Required:      true,
+			Description:   "The blockchain type for the account. Currently supported: 'eth', 'btc', 'tbtc', 'btc-testnet3', 'btc-signet', 'btc-regtest'.",
+			AllowedValues: adapters.AllowedBlockchains(),
+		},
+		"address": {
+			Type:        framework.TypeString,
+			Required:    true,
+			Description: "The address of the wallet to sign the transaction.",
+		},
+		"payload": {
+			Type:        framework.TypeString,
+			Required:    true,
+			Description: "The txn payload to sign.",
+		},
+		"override_caps": {
+			Type:        framework.TypeBool,
+			Default:     false,
+			Description: "Skip the configured safety caps. Only honoured on the .../sign/override path.",
+		},
+	}
+
 	return []*framework.Path{
 		{
 			Pattern:      "wallets/" + framework.GenericNameRegex("blockchainType") + "/" + framework.GenericNameRegex("address") + "/sign",
@@ -19,24 +48,22 @@ func pathSign(b *pluginBackend) []*framework.Path {
 	POST - sign a transaction for a given blockchain type
 
 `,
-			Fields: map[string]*framework.FieldSchema{
-				"blockchainType": {
-					Type:          framework.TypeString,
-					Required:      true,
-					Description:   "The blockchain type for the account. Currently supported: 'eth', 'btc', 'tbtc'.",
-					AllowedValues: adapters.AllowedBlockchains(),
-				},
-				"address": {
-					Type:        framework.TypeString,
-					Required:    true,
-					Description: "The address of the wallet to sign the transaction.",
-				},
-				"payload": {
-					Type:        framework.TypeString,
-					Required:    true,
-					Description: "The txn payload to sign.",
-				},
+			Fields: fields,
+
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.UpdateOperation: b.signTxn,
 			},
+		},
+		{
+			Pattern:      "wallets/" + framework.GenericNameRegex("blockchainType") + "/" + framework.GenericNameRegex("address") + "/sign/override",
+			HelpSynopsis: "Sign a transaction, optionally bypassing the configured safety caps.",
+			HelpDescription: `
+	POST - sign a transaction; with override_caps=true the chain and wallet caps are skipped
+
+Grant this path only to policies that are trusted to bypass the caps. The
+bitcoin fee limits of the wallet still apply.
+`,
+			Fields: fields,
 
 			Callbacks: map[logical.Operation]framework.OperationFunc{
 				logical.UpdateOperation: b.signTxn,
@@ -52,43 +79,98 @@ func (b *pluginBackend) signTxn(ctx context.Context, req *logical.Request, d *fr
 		return nil, logical.CodedError(http.StatusBadRequest, "payload is required")
 	}
 
+	overrideCaps := d.Get("override_caps").(bool)
+	if overrideCaps && !strings.HasSuffix(req.Path, signOverrideSuffix) {
+		return nil, logical.CodedError(http.StatusForbidden, "override_caps is only honoured on the wallets/<blockchainType>/<address>/sign/override path")
+	}
+
 	blockchainType := adapters.BlockchainType(d.Get("blockchainType").(string))
 	if !blockchainType.IsValid() {
 		return nil, fmt.Errorf("invalid blockchain type: %s", blockchainType)
 	}
 
-	adapter, err := adapters.GetAdapter(blockchainType)
+	adapter, err := b.getAdapter(ctx, req.Storage, blockchainType)
 	if err != nil {
 		return nil, err
 	}
 
 	walletAddress := d.Get("address").(string)
-	if walletAddress == "" {
-		return nil, fmt.Errorf("wallet address is required")
-	}
-	walletPath := fmt.Sprintf("wallets/%s/%s", blockchainType, walletAddress)
-	entry, err := req.Storage.Get(ctx, walletPath)
+	// Payments of HD wallets hand out a fresh change key, so the signs of a
+	// wallet are serialised until its change index is stored.
+	lock := locksutil.LockForKey(b.walletLocks, fmt.Sprintf("wallets/%s/%s", blockchainType, walletAddress))
+	lock.Lock()
+	defer lock.Unlock()
+
+	wallet, err := b.getWallet(ctx, req.Storage, blockchainType, walletAddress)
 	if err != nil {
-		b.Logger().Error("Failed to retrieve the account by address", "path", walletPath, "error", err)
 		return nil, err
 	}
-	if entry == nil {
-		return nil, logical.CodedError(http.StatusExpectationFailed, fmt.Sprintf("no account found for address: %s", walletAddress))
+	changeIndex := wallet.ChangeIndex
+
+	if enforcer, ok := adapter.(adapters.PolicyEnforcer); ok {
+		policy, err := b.signingPolicy(ctx, req.Storage, blockchainType, walletAddress, overrideCaps)
+		if err != nil {
+			return nil, err
+		}
+		enforcer.SetPolicy(policy)
 	}
-	var wallet adapters.Wallet
-	_ = entry.DecodeJSON(&wallet)
 
-	signature, err := adapter.CreateSignedTransaction(&wallet, jsonPayload)
+	result := &adapters.SignResult{}
+	if signer, ok := adapter.(adapters.DetailedSigner); ok {
+		result, err = signer.CreateSignedTransactionDetailed(wallet, jsonPayload)
+	} else {
+		result.Tx, err = adapter.CreateSignedTransaction(wallet, jsonPayload)
+	}
 	if err != nil {
-		if err == adapters.ErrInvalidPayload {
-			return nil, logical.CodedError(http.StatusBadRequest, "invalid payload format")
+		if errors.Is(err, adapters.ErrInvalidPayload) || errors.Is(err, adapters.ErrCapExceeded) {
+			return nil, logical.CodedError(http.StatusBadRequest, err.Error())
 		}
 		return nil, err
 	}
+	if wallet.ChangeIndex != changeIndex {
+		if err := b.putWallet(ctx, req.Storage, blockchainType, wallet); err != nil {
+			return nil, err
+		}
+	}
 
+	data := map[string]interface{}{
+		"signature": result.Tx,
+	}
+	for k, v := range result.Details {
+		data[k] = v
+	}
 	return &logical.Response{
-		Data: map[string]interface{}{
-			"signature": signature,
-		},
+		Data: data,
 	}, nil
 }
+
+// signingPolicy builds the adapter policy for a wallet from the chain and
+// wallet configuration stored in this mount. overrideCaps drops the value
+// caps; the bitcoin fee limits always apply.
+func (b *pluginBackend) signingPolicy(ctx context.Context, s logical.Storage, blockchainType adapters.BlockchainType, address string, overrideCaps bool) (*adapters.Policy, error) {
+	config, err := b.getWalletConfig(ctx, s, blockchainType, address)
+	if err != nil {
+		return nil, err
+	}
+
+	feeLimits := config.FeeLimits.WithDefaults()
+	policy := &adapters.Policy{
+		AllowDelegateCall: config.AllowDelegateCall,
+		ChangeWallets:     config.ChangeWallets,
+		FeeLimits:         &feeLimits,
+	}
+	if !overrideCaps {
+		policy.Caps = func(chainID uint64) ([]adapters.TxCaps, error) {
+			caps := []adapters.TxCaps{config.Caps}
+			chainCaps, err := b.getChainCaps(ctx, s, chainID)
+			if err != nil {
+				return nil, err
+			}
+			if chainCaps != nil {
+				caps = append(caps, *chainCaps)
+			}
+			return caps, nil
+		}
+	}
+	return policy, nil
+}
@@ -0,0 +1,148 @@
+package vaultpoly
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/igwedaniel/vaultpoly/internal/adapters"
+)
+
+func pathSignMessage(b *pluginBackend) []*framework.Path {
+	fields := func() map[string]*framework.FieldSchema {
+		return map[string]*framework.FieldSchema{
+			"blockchainType": {
+				Type:          framework.TypeString,
+				Required:      true,
+				Description:   "The blockchain type for the account. Currently supported: 'btc', 'tbtc', 'btc-testnet3', 'btc-signet', 'btc-regtest'.",
+				AllowedValues: adapters.AllowedBlockchains(),
+			},
+			"address": {
+				Type:        framework.TypeString,
+				Required:    true,
+				Description: "The address the message is signed for.",
+			},
+			"message": {
+				Type:        framework.TypeString,
+				Required:    true,
+				Description: "The message to sign.",
+			},
+			"format": {
+				Type:        framework.TypeString,
+				Default:     Empty,
+				Description: "The signature format: 'bip137' or 'bip322'. Defaults to bip322 for taproot addresses and bip137 otherwise.",
+			},
+		}
+	}
+	verifyFields := fields()
+	verifyFields["signature"] = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Required:    true,
+		Description: "The base64 signature to verify.",
+	}
+
+	return []*framework.Path{
+		{
+			Pattern:      "wallets/" + framework.GenericNameRegex("blockchainType") + "/" + framework.GenericNameRegex("address") + "/sign-message",
+			HelpSynopsis: "Sign a message with a wallet key to prove ownership of its address.",
+			HelpDescription: `
+	POST - sign a message as a BIP137 compact signature or a BIP322 simple signature
+
+BIP137 covers P2PKH, P2SH-P2WPKH and P2WPKH addresses; BIP322 simple
+signatures cover P2WPKH and P2TR addresses.
+`,
+			Fields: fields(),
+
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.UpdateOperation: b.signMessage,
+			},
+		},
+		{
+			Pattern:      "wallets/" + framework.GenericNameRegex("blockchainType") + "/" + framework.GenericNameRegex("address") + "/verify-message",
+			HelpSynopsis: "Verify a message signature for an address.",
+			HelpDescription: `
+	POST - check a BIP137 or BIP322 simple signature of a message
+
+The address does not need to be a wallet of this mount.
+`,
+			Fields: verifyFields,
+
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.UpdateOperation: b.verifyMessage,
+			},
+		},
+	}
+}
+
+// messageSigner returns the message signing adapter of a blockchain type.
+func (b *pluginBackend) messageSigner(ctx context.Context, s logical.Storage, blockchainType adapters.BlockchainType) (adapters.MessageSigner, error) {
+	if !blockchainType.IsValid() {
+		return nil, fmt.Errorf("invalid blockchain type: %s", blockchainType)
+	}
+	adapter, err := b.getAdapter(ctx, s, blockchainType)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := adapter.(adapters.MessageSigner)
+	if !ok {
+		return nil, logical.CodedError(http.StatusBadRequest, fmt.Sprintf("message signing is not supported for %s", blockchainType))
+	}
+	return signer, nil
+}
+
+func (b *pluginBackend) signMessage(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	blockchainType := adapters.BlockchainType(d.Get("blockchainType").(string))
+	signer, err := b.messageSigner(ctx, req.Storage, blockchainType)
+	if err != nil {
+		return nil, err
+	}
+	wallet, err := b.getWallet(ctx, req.Storage, blockchainType, d.Get("address").(string))
+	if err != nil {
+		return nil, err
+	}
+
+	signature, format, err := signer.SignMessage(wallet, d.Get("message").(string), d.Get("format").(string))
+	if err != nil {
+		if errors.Is(err, adapters.ErrInvalidPayload) {
+			return nil, logical.CodedError(http.StatusBadRequest, err.Error())
+		}
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"address":   wallet.PublicKey,
+			"signature": signature,
+			"format":    format,
+		},
+	}, nil
+}
+
+func (b *pluginBackend) verifyMessage(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	signature := d.Get("signature").(string)
+	if signature == "" {
+		return nil, logical.CodedError(http.StatusBadRequest, "signature is required")
+	}
+
+	signer, err := b.messageSigner(ctx, req.Storage, adapters.BlockchainType(d.Get("blockchainType").(string)))
+	if err != nil {
+		return nil, err
+	}
+
+	valid, err := signer.VerifyMessage(d.Get("address").(string), d.Get("message").(string), signature, d.Get("format").(string))
+	if err != nil {
+		if errors.Is(err, adapters.ErrInvalidPayload) {
+			return nil, logical.CodedError(http.StatusBadRequest, err.Error())
+		}
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"valid": valid,
+		},
+	}, nil
+}
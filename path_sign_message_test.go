@@ -0,0 +1,72 @@
+package vaultpoly
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/igwedaniel/vaultpoly/internal/adapters"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignMessage(t *testing.T) {
+	b, s := getTestBackend(t)
+	tbtc := adapters.BlockchainBTCTestnet.String()
+
+	resp, err := testWalletCreate(t, b, s, tbtc, map[string]interface{}{"address_type": "p2tr"})
+	require.NoError(t, err)
+	address := resp.Data["address"].(string)
+
+	var signature string
+	t.Run("Sign message - pass", func(t *testing.T) {
+		resp, err := testMessageRequest(t, b, s, "wallets/"+tbtc+"/"+address+"/sign-message", map[string]interface{}{
+			"message": "we control this address",
+		})
+		require.NoError(t, err)
+		require.Equal(t, adapters.MessageFormatBIP322, resp.Data["format"])
+		signature = resp.Data["signature"].(string)
+	})
+
+	t.Run("Verify message - pass", func(t *testing.T) {
+		resp, err := testMessageRequest(t, b, s, "wallets/"+tbtc+"/"+address+"/verify-message", map[string]interface{}{
+			"message":   "we control this address",
+			"signature": signature,
+		})
+		require.NoError(t, err)
+		require.Equal(t, true, resp.Data["valid"])
+
+		resp, err = testMessageRequest(t, b, s, "wallets/"+tbtc+"/"+address+"/verify-message", map[string]interface{}{
+			"message":   "we do not control this address",
+			"signature": signature,
+		})
+		require.NoError(t, err)
+		require.Equal(t, false, resp.Data["valid"])
+	})
+
+	t.Run("BIP137 for taproot - fail", func(t *testing.T) {
+		_, err := testMessageRequest(t, b, s, "wallets/"+tbtc+"/"+address+"/sign-message", map[string]interface{}{
+			"message": "we control this address",
+			"format":  adapters.MessageFormatBIP137,
+		})
+		require.ErrorContains(t, err, "format")
+	})
+
+	t.Run("Sign message for ETH - fail", func(t *testing.T) {
+		resp, err := testWalletCreate(t, b, s, adapters.BlockchainETH.String(), map[string]interface{}{})
+		require.NoError(t, err)
+		_, err = testMessageRequest(t, b, s, "wallets/eth/"+resp.Data["address"].(string)+"/sign-message", map[string]interface{}{
+			"message": "hello",
+		})
+		require.ErrorContains(t, err, "not supported")
+	})
+}
+
+func testMessageRequest(t *testing.T, b *pluginBackend, s logical.Storage, path string, d map[string]interface{}) (*logical.Response, error) {
+	t.Helper()
+	return b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      path,
+		Data:      d,
+		Storage:   s,
+	})
+}
@@ -0,0 +1,110 @@
+package vaultpoly
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/igwedaniel/vaultpoly/internal/adapters"
+)
+
+func pathSignPSBT(b *pluginBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern:      "wallets/" + framework.GenericNameRegex("blockchainType") + "/" + framework.GenericNameRegex("address") + "/sign-psbt",
+			HelpSynopsis: "Sign the inputs of a PSBT (BIP174) that belong to a wallet.",
+			HelpDescription: `
+	POST - add the wallet's signatures to a base64 PSBT
+
+Only inputs whose UTXO script belongs to the wallet key, or to a key of the
+wallet's HD account named by the input's BIP32 derivation, are signed. Every
+input needs its UTXO, ECDSA inputs the non-witness UTXO, and witness UTXO amounts
+are checked against it when both are present. The fee is checked against the
+wallet's fee limits before signing. With finalize=true every input must be
+finalizable and the raw transaction hex is returned as well.
+`,
+			Fields: map[string]*framework.FieldSchema{
+				"blockchainType": {
+					Type:          framework.TypeString,
+					Required:      true,
+					Description:   "The blockchain type for the account. Currently supported: 'btc', 'tbtc', 'btc-testnet3', 'btc-signet', 'btc-regtest'.",
+					AllowedValues: adapters.AllowedBlockchains(),
+				},
+				"address": {
+					Type:        framework.TypeString,
+					Required:    true,
+					Description: "The address of the wallet signing the PSBT.",
+				},
+				"psbt": {
+					Type:        framework.TypeString,
+					Required:    true,
+					Description: "The base64 encoded PSBT.",
+				},
+				"finalize": {
+					Type:        framework.TypeBool,
+					Default:     false,
+					Description: "Finalize the PSBT and extract the raw transaction.",
+				},
+			},
+
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.UpdateOperation: b.signPSBT,
+			},
+		},
+	}
+}
+
+func (b *pluginBackend) signPSBT(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	packet := d.Get("psbt").(string)
+	if packet == "" {
+		return nil, logical.CodedError(http.StatusBadRequest, "psbt is required")
+	}
+
+	blockchainType := adapters.BlockchainType(d.Get("blockchainType").(string))
+	if !blockchainType.IsValid() {
+		return nil, fmt.Errorf("invalid blockchain type: %s", blockchainType)
+	}
+	adapter, err := b.getAdapter(ctx, req.Storage, blockchainType)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := adapter.(adapters.PSBTSigner)
+	if !ok {
+		return nil, logical.CodedError(http.StatusBadRequest, fmt.Sprintf("PSBT signing is not supported for %s", blockchainType))
+	}
+
+	walletAddress := d.Get("address").(string)
+	wallet, err := b.getWallet(ctx, req.Storage, blockchainType, walletAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	if enforcer, ok := adapter.(adapters.PolicyEnforcer); ok {
+		policy, err := b.signingPolicy(ctx, req.Storage, blockchainType, walletAddress, false)
+		if err != nil {
+			return nil, err
+		}
+		enforcer.SetPolicy(policy)
+	}
+
+	result, err := signer.SignPSBT(wallet, packet, d.Get("finalize").(bool))
+	if err != nil {
+		if errors.Is(err, adapters.ErrInvalidPayload) || errors.Is(err, adapters.ErrCapExceeded) {
+			return nil, logical.CodedError(http.StatusBadRequest, err.Error())
+		}
+		return nil, err
+	}
+
+	data := map[string]interface{}{
+		"psbt":          result.PSBT,
+		"signed_inputs": result.SignedInputs,
+		"complete":      result.Complete,
+	}
+	if result.Tx != "" {
+		data["tx"] = result.Tx
+	}
+	return &logical.Response{Data: data}, nil
+}
@@ -0,0 +1,122 @@
+package vaultpoly
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"net/http"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/psbt"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/igwedaniel/vaultpoly/internal/adapters"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignPSBTPath(t *testing.T) {
+	b, s := getTestBackend(t)
+	tbtc := adapters.BlockchainBTCTestnet.String()
+
+	resp, err := testWalletCreate(t, b, s, tbtc, map[string]interface{}{})
+	require.NoError(t, err)
+	address := resp.Data["address"].(string)
+	addr, err := btcutil.DecodeAddress(address, &chaincfg.TestNet4Params)
+	require.NoError(t, err)
+	pkScript, err := txscript.PayToAddrScript(addr)
+	require.NoError(t, err)
+
+	// A PSBT spending an output of the wallet, with its full UTXO.
+	funding := wire.NewMsgTx(wire.TxVersion)
+	funding.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{0x07}, 0), nil, nil))
+	funding.AddTxOut(wire.NewTxOut(60000, pkScript))
+	unsigned := wire.NewMsgTx(2)
+	fundingHash := funding.TxHash()
+	unsigned.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&fundingHash, 0), nil, nil))
+	unsigned.AddTxOut(wire.NewTxOut(59000, pkScript))
+	packet, err := psbt.NewFromUnsignedTx(unsigned)
+	require.NoError(t, err)
+	packet.Inputs[0].WitnessUtxo = funding.TxOut[0]
+	packet.Inputs[0].NonWitnessUtxo = funding
+	encoded, err := packet.B64Encode()
+	require.NoError(t, err)
+
+	signPSBT := func(d map[string]interface{}) (*logical.Response, error) {
+		return b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "wallets/" + tbtc + "/" + address + "/sign-psbt",
+			Data:      d,
+			Storage:   s,
+		})
+	}
+
+	t.Run("Sign PSBT - pass", func(t *testing.T) {
+		resp, err := signPSBT(map[string]interface{}{"psbt": encoded})
+		require.NoError(t, err)
+		require.Equal(t, []int{0}, resp.Data["signed_inputs"])
+		require.Equal(t, false, resp.Data["complete"])
+		require.NotContains(t, resp.Data, "tx")
+
+		signed, err := psbt.NewFromRawBytes(bytes.NewReader([]byte(resp.Data["psbt"].(string))), true)
+		require.NoError(t, err)
+		require.Len(t, signed.Inputs[0].PartialSigs, 1)
+	})
+
+	t.Run("Sign and finalize PSBT - pass", func(t *testing.T) {
+		resp, err := signPSBT(map[string]interface{}{"psbt": encoded, "finalize": true})
+		require.NoError(t, err)
+		require.Equal(t, true, resp.Data["complete"])
+
+		raw, err := hex.DecodeString(resp.Data["tx"].(string))
+		require.NoError(t, err)
+		var tx wire.MsgTx
+		require.NoError(t, tx.Deserialize(bytes.NewReader(raw)))
+		require.Equal(t, unsigned.TxHash(), tx.TxHash())
+		require.Len(t, tx.TxIn[0].Witness, 2)
+	})
+
+	t.Run("Bad PSBT - fail", func(t *testing.T) {
+		for name, d := range map[string]map[string]interface{}{
+			"missing": {},
+			"garbage": {"psbt": "bm90IGEgcHNidA=="},
+		} {
+			_, err := signPSBT(d)
+			var coded logical.HTTPCodedError
+			require.ErrorAs(t, err, &coded, name)
+			require.Equal(t, http.StatusBadRequest, coded.Code(), name)
+		}
+	})
+
+	t.Run("Fee above the wallet limit - fail", func(t *testing.T) {
+		// The PSBT pays 1000 sats for about 110 vbytes.
+		_, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "wallets/" + tbtc + "/" + address + "/config",
+			Data:      map[string]interface{}{"max_fee_rate": 5},
+			Storage:   s,
+		})
+		require.NoError(t, err)
+
+		_, err = signPSBT(map[string]interface{}{"psbt": encoded})
+		require.ErrorContains(t, err, "max_fee_rate is 5")
+		var coded logical.HTTPCodedError
+		require.ErrorAs(t, err, &coded)
+		require.Equal(t, http.StatusBadRequest, coded.Code())
+	})
+
+	t.Run("Sign PSBT for ETH - fail", func(t *testing.T) {
+		resp, err := testWalletCreate(t, b, s, adapters.BlockchainETH.String(), map[string]interface{}{})
+		require.NoError(t, err)
+		_, err = b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "wallets/eth/" + resp.Data["address"].(string) + "/sign-psbt",
+			Data:      map[string]interface{}{"psbt": encoded},
+			Storage:   s,
+		})
+		require.ErrorContains(t, err, "not supported")
+	})
+}
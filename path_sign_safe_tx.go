@@ -0,0 +1,115 @@
+package vaultpoly
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/igwedaniel/vaultpoly/internal/adapters"
+)
+
+func pathSignSafeTx(b *pluginBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern:      "wallets/" + framework.GenericNameRegex("blockchainType") + "/" + framework.GenericNameRegex("address") + "/sign-safe-tx",
+			HelpSynopsis: "Sign a Safe{Wallet} multisig transaction as one of its owners.",
+			HelpDescription: `
+	POST - compute the EIP-712 safeTxHash of a SafeTx and sign it with the wallet key
+
+The response can be posted to the Safe Transaction Service as
+contractTransactionHash, sender and signature. Delegatecall operations are
+refused unless allow_delegatecall is set in the wallet config.
+`,
+			Fields: map[string]*framework.FieldSchema{
+				"blockchainType": {
+					Type:          framework.TypeString,
+					Required:      true,
+					Description:   "The blockchain type for the account. Currently supported: 'eth'.",
+					AllowedValues: adapters.AllowedBlockchains(),
+				},
+				"address": {
+					Type:        framework.TypeString,
+					Required:    true,
+					Description: "The address of the owner wallet.",
+				},
+				"safe_address": {
+					Type:        framework.TypeString,
+					Required:    true,
+					Description: "The address of the Safe.",
+				},
+				"chain_id": {
+					Type:        framework.TypeInt,
+					Required:    true,
+					Description: "The chain ID the Safe is deployed on.",
+				},
+				"safe_tx": {
+					Type:        framework.TypeString,
+					Required:    true,
+					Description: "The SafeTx as JSON: to, value, data, operation, safeTxGas, baseGas, gasPrice, gasToken, refundReceiver, nonce.",
+				},
+			},
+
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.UpdateOperation: b.signSafeTx,
+			},
+		},
+	}
+}
+
+func (b *pluginBackend) signSafeTx(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	safeTx := d.Get("safe_tx").(string)
+	if safeTx == "" {
+		return nil, logical.CodedError(http.StatusBadRequest, "safe_tx is required")
+	}
+	chainID := d.Get("chain_id").(int)
+	if chainID <= 0 {
+		return nil, logical.CodedError(http.StatusBadRequest, "chain_id must be a positive integer")
+	}
+
+	blockchainType := adapters.BlockchainType(d.Get("blockchainType").(string))
+	if !blockchainType.IsValid() {
+		return nil, fmt.Errorf("invalid blockchain type: %s", blockchainType)
+	}
+	adapter, err := b.getAdapter(ctx, req.Storage, blockchainType)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := adapter.(adapters.SafeTransactionSigner)
+	if !ok {
+		return nil, logical.CodedError(http.StatusBadRequest, fmt.Sprintf("safe transactions are not supported for %s", blockchainType))
+	}
+
+	walletAddress := d.Get("address").(string)
+	wallet, err := b.getWallet(ctx, req.Storage, blockchainType, walletAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	if enforcer, ok := adapter.(adapters.PolicyEnforcer); ok {
+		policy, err := b.signingPolicy(ctx, req.Storage, blockchainType, walletAddress, false)
+		if err != nil {
+			return nil, err
+		}
+		enforcer.SetPolicy(policy)
+	}
+
+	hash, signature, err := signer.SignSafeTransaction(wallet, d.Get("safe_address").(string), uint64(chainID), safeTx)
+	if err != nil {
+		if errors.Is(err, adapters.ErrInvalidPayload) {
+			return nil, logical.CodedError(http.StatusBadRequest, err.Error())
+		}
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"safe_tx_hash": hash,
+			"sender":       common.HexToAddress(wallet.PublicKey).Hex(),
+			"signature":    signature,
+		},
+	}, nil
+}
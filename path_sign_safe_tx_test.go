@@ -0,0 +1,96 @@
+package vaultpoly
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/igwedaniel/vaultpoly/internal/adapters"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignSafeTx(t *testing.T) {
+	b, s := getTestBackend(t)
+
+	resp, err := testWalletCreate(t, b, s, adapters.BlockchainETH.String(), map[string]interface{}{})
+	require.NoError(t, err)
+	address := resp.Data["address"].(string)
+
+	safeTx := func(operation int) string {
+		return `{
+			"to": "0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48",
+			"value": "0",
+			"data": "0xa9059cbb",
+			"operation": ` + strconv.Itoa(operation) + `,
+			"safeTxGas": "0",
+			"baseGas": "0",
+			"gasPrice": "0",
+			"gasToken": "0x0000000000000000000000000000000000000000",
+			"refundReceiver": "0x0000000000000000000000000000000000000000",
+			"nonce": "3"
+		}`
+	}
+	request := func(operation int) map[string]interface{} {
+		return map[string]interface{}{
+			"safe_address": "0x1c2d8e6b2a5f4d8e3cbb2d5ba8e2a3b1d9a1e6f4",
+			"chain_id":     1,
+			"safe_tx":      safeTx(operation),
+		}
+	}
+
+	t.Run("Sign SafeTx call - pass", func(t *testing.T) {
+		resp, err := testSignSafeTx(t, b, s, address, request(0))
+		require.NoError(t, err)
+		require.Nil(t, resp.Error())
+		require.Equal(t, address, resp.Data["sender"])
+
+		hash := hexutil.MustDecode(resp.Data["safe_tx_hash"].(string))
+		signature := hexutil.MustDecode(resp.Data["signature"].(string))
+		require.Len(t, signature, 65)
+		require.Contains(t, []byte{27, 28}, signature[64])
+
+		signature[64] -= 27
+		pubKey, err := crypto.SigToPub(hash, signature)
+		require.NoError(t, err)
+		require.Equal(t, strings.ToLower(address), strings.ToLower(crypto.PubkeyToAddress(*pubKey).Hex()))
+	})
+
+	t.Run("Sign SafeTx delegatecall - fail", func(t *testing.T) {
+		_, err := testSignSafeTx(t, b, s, address, request(1))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "delegatecall")
+	})
+
+	t.Run("Sign SafeTx delegatecall when allowed - pass", func(t *testing.T) {
+		_, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "wallets/eth/" + address + "/config",
+			Data:      map[string]interface{}{"allow_delegatecall": true},
+			Storage:   s,
+		})
+		require.NoError(t, err)
+
+		resp, err := testSignSafeTx(t, b, s, address, request(1))
+		require.NoError(t, err)
+		require.NotEmpty(t, resp.Data["signature"])
+	})
+
+	t.Run("Sign SafeTx unknown operation - fail", func(t *testing.T) {
+		_, err := testSignSafeTx(t, b, s, address, request(2))
+		require.Error(t, err)
+	})
+}
+
+func testSignSafeTx(t *testing.T, b *pluginBackend, s logical.Storage, address string, d map[string]interface{}) (*logical.Response, error) {
+	t.Helper()
+	return b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "wallets/eth/" + address + "/sign-safe-tx",
+		Data:      d,
+		Storage:   s,
+	})
+}
@@ -6,6 +6,7 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"math/big"
+	"net/http"
 	"strings"
 	"testing"
 
@@ -226,6 +227,206 @@ func TestWalletSign(t *testing.T) {
 		require.True(t, actualFee < totalInput/2, "Transaction fee seems unreasonably high")
 	})
 
+	t.Run("Sign Wallet BTC coin selection - pass", func(t *testing.T) {
+		resp, err := testWalletCreate(t, b, s, adapters.BlockchainBTCTestnet.String(), map[string]interface{}{})
+		require.NoError(t, err)
+		address := resp.Data["address"].(string)
+
+		addr, err := btcutil.DecodeAddress(address, &chaincfg.TestNet4Params)
+		require.NoError(t, err)
+		script, err := txscript.PayToAddrScript(addr)
+		require.NoError(t, err)
+
+		utxos := []adapters.UTXO{
+			{Txid: strings.Repeat("1", 64), Vout: 0, Value: 50000, ScriptPubKey: hex.EncodeToString(script), ScriptPubKeyType: "v0_p2wpkh"},
+			{Txid: strings.Repeat("2", 64), Vout: 3, Value: 900000, ScriptPubKey: hex.EncodeToString(script), ScriptPubKeyType: "v0_p2wpkh"},
+			{Txid: strings.Repeat("3", 64), Vout: 1, Value: 70000, ScriptPubKey: hex.EncodeToString(script), ScriptPubKeyType: "v0_p2wpkh"},
+		}
+		jsonB, err := json.Marshal(adapters.BtcPayload{
+			Recipient:     "tb1qpn5dddjnc2qwurpsm449l6uvggnjxwsetrnksx",
+			Amount:        200000,
+			FeeRate:       1,
+			Utxos:         utxos,
+			CoinSelection: adapters.CoinSelectionLargestFirst,
+		})
+		require.NoError(t, err)
+
+		resp, err = testWalletSign(t, b, s, adapters.BlockchainBTCTestnet.String(), address, map[string]interface{}{
+			"payload": string(jsonB),
+		})
+		require.NoError(t, err)
+		require.NotEmpty(t, resp.Data["signature"])
+		require.Equal(t, []string{strings.Repeat("2", 64) + ":3"}, resp.Data["selected_utxos"])
+		require.Equal(t, []string{strings.Repeat("1", 64) + ":0", strings.Repeat("3", 64) + ":1"}, resp.Data["unused_utxos"])
+		require.Equal(t, int64(141), resp.Data["fee"])
+	})
+
+	t.Run("Sign Wallet BTC fresh change key per payment - pass", func(t *testing.T) {
+		resp, err := testWalletCreate(t, b, s, adapters.BlockchainBTCTestnet.String(), map[string]interface{}{})
+		require.NoError(t, err)
+		address := resp.Data["address"].(string)
+
+		addr, err := btcutil.DecodeAddress(address, &chaincfg.TestNet4Params)
+		require.NoError(t, err)
+		script, err := txscript.PayToAddrScript(addr)
+		require.NoError(t, err)
+		jsonB, err := json.Marshal(adapters.BtcPayload{
+			Recipient: "tb1qpn5dddjnc2qwurpsm449l6uvggnjxwsetrnksx",
+			Amount:    200000,
+			FeeRate:   1,
+			Utxos:     []adapters.UTXO{{Txid: strings.Repeat("6", 64), Value: 500000, ScriptPubKey: hex.EncodeToString(script), ScriptPubKeyType: "v0_p2wpkh"}},
+		})
+		require.NoError(t, err)
+
+		var changeScripts [][]byte
+		for _, want := range []string{"1/0", "1/1"} {
+			resp, err = testWalletSign(t, b, s, adapters.BlockchainBTCTestnet.String(), address, map[string]interface{}{
+				"payload": string(jsonB),
+			})
+			require.NoError(t, err)
+			require.Equal(t, want, resp.Data["change_path"])
+
+			txBytes, err := hex.DecodeString(resp.Data["signature"].(string))
+			require.NoError(t, err)
+			var tx wire.MsgTx
+			require.NoError(t, tx.Deserialize(bytes.NewReader(txBytes)))
+			require.Len(t, tx.TxOut, 2)
+			require.NotEqual(t, script, tx.TxOut[1].PkScript)
+			changeScripts = append(changeScripts, tx.TxOut[1].PkScript)
+		}
+		require.NotEqual(t, changeScripts[0], changeScripts[1])
+
+		wallet, err := b.getWallet(context.Background(), s, adapters.BlockchainBTCTestnet, address)
+		require.NoError(t, err)
+		require.Equal(t, uint32(2), wallet.ChangeIndex)
+	})
+
+	t.Run("Sign Wallet BTC change wallet allowlist - pass", func(t *testing.T) {
+		resp, err := testWalletCreate(t, b, s, adapters.BlockchainBTCTestnet.String(), map[string]interface{}{})
+		require.NoError(t, err)
+		address := resp.Data["address"].(string)
+		resp, err = testWalletCreate(t, b, s, adapters.BlockchainBTCTestnet.String(), map[string]interface{}{})
+		require.NoError(t, err)
+		changeWallet := resp.Data["address"].(string)
+
+		addr, err := btcutil.DecodeAddress(address, &chaincfg.TestNet4Params)
+		require.NoError(t, err)
+		script, err := txscript.PayToAddrScript(addr)
+		require.NoError(t, err)
+		jsonB, err := json.Marshal(adapters.BtcPayload{
+			Recipient:     "tb1qpn5dddjnc2qwurpsm449l6uvggnjxwsetrnksx",
+			Amount:        200000,
+			FeeRate:       1,
+			Utxos:         []adapters.UTXO{{Txid: strings.Repeat("4", 64), Value: 500000, ScriptPubKey: hex.EncodeToString(script), ScriptPubKeyType: "v0_p2wpkh"}},
+			ChangeAddress: changeWallet,
+		})
+		require.NoError(t, err)
+
+		_, err = testWalletSign(t, b, s, adapters.BlockchainBTCTestnet.String(), address, map[string]interface{}{
+			"payload": string(jsonB),
+		})
+		require.ErrorContains(t, err, "allowlisted", "change wallets must be allowlisted - fail")
+
+		_, err = b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "wallets/" + adapters.BlockchainBTCTestnet.String() + "/" + address + "/config",
+			Data:      map[string]interface{}{"change_wallets": "tb1qpn5dddjnc2qwurpsm449l6uvggnjxwsetrnksx"},
+			Storage:   s,
+		})
+		require.ErrorContains(t, err, "no account found", "change wallets must be wallets of this mount - fail")
+
+		_, err = b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "wallets/" + adapters.BlockchainBTCTestnet.String() + "/" + address + "/config",
+			Data:      map[string]interface{}{"change_wallets": changeWallet},
+			Storage:   s,
+		})
+		require.NoError(t, err)
+
+		resp, err = testWalletSign(t, b, s, adapters.BlockchainBTCTestnet.String(), address, map[string]interface{}{
+			"payload": string(jsonB),
+		})
+		require.NoError(t, err)
+		txBytes, err := hex.DecodeString(resp.Data["signature"].(string))
+		require.NoError(t, err)
+		var tx wire.MsgTx
+		require.NoError(t, tx.Deserialize(bytes.NewReader(txBytes)))
+		changeAddr, err := btcutil.DecodeAddress(changeWallet, &chaincfg.TestNet4Params)
+		require.NoError(t, err)
+		changeScript, err := txscript.PayToAddrScript(changeAddr)
+		require.NoError(t, err)
+		require.Equal(t, changeScript, tx.TxOut[1].PkScript)
+	})
+
+	t.Run("Sign Wallet BTC fee limits - fail", func(t *testing.T) {
+		resp, err := testWalletCreate(t, b, s, adapters.BlockchainBTCTestnet.String(), map[string]interface{}{})
+		require.NoError(t, err)
+		address := resp.Data["address"].(string)
+
+		addr, err := btcutil.DecodeAddress(address, &chaincfg.TestNet4Params)
+		require.NoError(t, err)
+		script, err := txscript.PayToAddrScript(addr)
+		require.NoError(t, err)
+		utxo := adapters.UTXO{Txid: strings.Repeat("5", 64), Value: 500000, ScriptPubKey: hex.EncodeToString(script), ScriptPubKeyType: "v0_p2wpkh"}
+		payload := func(feeRate float64, utxos ...adapters.UTXO) string {
+			jsonB, err := json.Marshal(adapters.BtcPayload{
+				Recipient: "tb1qpn5dddjnc2qwurpsm449l6uvggnjxwsetrnksx",
+				Amount:    200000,
+				FeeRate:   feeRate,
+				Utxos:     utxos,
+			})
+			require.NoError(t, err)
+			return string(jsonB)
+		}
+		sign := func(path string, d map[string]interface{}) error {
+			_, err := b.HandleRequest(context.Background(), &logical.Request{
+				Operation: logical.UpdateOperation,
+				Path:      "wallets/" + adapters.BlockchainBTCTestnet.String() + "/" + address + path,
+				Data:      d,
+				Storage:   s,
+			})
+			return err
+		}
+
+		for name, tc := range map[string]struct {
+			payload string
+			message string
+		}{
+			"duplicate input":  {payload(2, utxo, utxo), "utxos[1]: spends"},
+			"zero value input": {payload(2, adapters.UTXO{Txid: utxo.Txid, ScriptPubKey: utxo.ScriptPubKey, ScriptPubKeyType: utxo.ScriptPubKeyType}), "utxos[0].value"},
+			"zero fee rate":    {payload(0, utxo), "minimum relay fee rate"},
+			"absurd fee rate":  {payload(100000, utxo), "max_fee_rate"},
+			"unknown field":    {strings.Replace(payload(2, utxo), "{", `{"fee":5,`, 1), "fee: unknown field"},
+			"trailing data":    {payload(2, utxo) + "}", "unexpected data after the JSON object"},
+			"malformed":        {`{"recipient":`, "payload"},
+			"insufficient funds": {payload(2, adapters.UTXO{Txid: utxo.Txid, Value: 200100, ScriptPubKey: utxo.ScriptPubKey, ScriptPubKeyType: utxo.ScriptPubKeyType}),
+				"utxos: insufficient funds"},
+		} {
+			err := sign("/sign", map[string]interface{}{"payload": tc.payload})
+			require.ErrorContains(t, err, tc.message, name)
+			var coded logical.HTTPCodedError
+			require.ErrorAs(t, err, &coded, name)
+			require.Equal(t, http.StatusBadRequest, coded.Code(), name)
+		}
+
+		require.ErrorContains(t, sign("/sign/override", map[string]interface{}{"payload": payload(100000, utxo), "override_caps": true}), "max_fee_rate is 10000 sat/vB", "the override path refuses an absurd fee - fail")
+
+		require.ErrorContains(t, sign("/config", map[string]interface{}{"max_fee": -1}), "max_fee must not be negative")
+		require.NoError(t, sign("/config", map[string]interface{}{"max_fee_rate": 5, "max_fee_ratio": 0.5}))
+		resp, err = b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      "wallets/" + adapters.BlockchainBTCTestnet.String() + "/" + address + "/config",
+			Storage:   s,
+		})
+		require.NoError(t, err)
+		require.Equal(t, 5.0, resp.Data["max_fee_rate"])
+		require.Equal(t, int64(0), resp.Data["max_fee"])
+
+		require.ErrorContains(t, sign("/sign", map[string]interface{}{"payload": payload(10, utxo)}), "max_fee_rate is 5")
+		require.NoError(t, sign("/sign", map[string]interface{}{"payload": payload(4, utxo)}))
+		require.ErrorContains(t, sign("/sign/override", map[string]interface{}{"payload": payload(10, utxo), "override_caps": true}), "max_fee_rate is 5", "the override path keeps the fee limits - fail")
+		require.NoError(t, sign("/sign/override", map[string]interface{}{"payload": payload(4, utxo), "override_caps": true}))
+	})
 }
 
 func testWalletSign(t *testing.T, b *pluginBackend, s logical.Storage, blockchainType, address string, d map[string]interface{}) (*logical.Response, error) {
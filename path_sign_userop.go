@@ -0,0 +1,105 @@
+package vaultpoly
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/igwedaniel/vaultpoly/internal/adapters"
+)
+
+func pathSignUserOp(b *pluginBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern:      "wallets/" + framework.GenericNameRegex("blockchainType") + "/" + framework.GenericNameRegex("address") + "/sign-userop",
+			HelpSynopsis: "Sign an ERC-4337 UserOperation with a wallet that owns a smart account.",
+			HelpDescription: `
+	POST - compute the userOpHash of a v0.6 or v0.7 UserOperation and sign it
+
+The EntryPoint must be one of the canonical v0.6 or v0.7 deployments; its
+version selects how the operation is packed. The signature is an EIP-191
+personal signature over the userOpHash, ready to place in the operation's
+signature field before submitting it to a bundler.
+`,
+			Fields: map[string]*framework.FieldSchema{
+				"blockchainType": {
+					Type:          framework.TypeString,
+					Required:      true,
+					Description:   "The blockchain type for the account. Currently supported: 'eth'.",
+					AllowedValues: adapters.AllowedBlockchains(),
+				},
+				"address": {
+					Type:        framework.TypeString,
+					Required:    true,
+					Description: "The address of the wallet that owns the smart account.",
+				},
+				"user_operation": {
+					Type:        framework.TypeString,
+					Required:    true,
+					Description: "The UserOperation as JSON, in the shape accepted by eth_sendUserOperation.",
+				},
+				"entry_point": {
+					Type:        framework.TypeString,
+					Required:    true,
+					Description: "The EntryPoint contract address.",
+				},
+				"chain_id": {
+					Type:        framework.TypeInt,
+					Required:    true,
+					Description: "The chain ID the operation is for.",
+				},
+			},
+
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.UpdateOperation: b.signUserOp,
+			},
+		},
+	}
+}
+
+func (b *pluginBackend) signUserOp(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	userOp := d.Get("user_operation").(string)
+	if userOp == "" {
+		return nil, logical.CodedError(http.StatusBadRequest, "user_operation is required")
+	}
+	chainID := d.Get("chain_id").(int)
+	if chainID <= 0 {
+		return nil, logical.CodedError(http.StatusBadRequest, "chain_id must be a positive integer")
+	}
+
+	blockchainType := adapters.BlockchainType(d.Get("blockchainType").(string))
+	if !blockchainType.IsValid() {
+		return nil, fmt.Errorf("invalid blockchain type: %s", blockchainType)
+	}
+	adapter, err := b.getAdapter(ctx, req.Storage, blockchainType)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := adapter.(adapters.UserOperationSigner)
+	if !ok {
+		return nil, logical.CodedError(http.StatusBadRequest, fmt.Sprintf("user operations are not supported for %s", blockchainType))
+	}
+
+	wallet, err := b.getWallet(ctx, req.Storage, blockchainType, d.Get("address").(string))
+	if err != nil {
+		return nil, err
+	}
+
+	hash, signature, err := signer.SignUserOperation(wallet, userOp, d.Get("entry_point").(string), uint64(chainID))
+	if err != nil {
+		if errors.Is(err, adapters.ErrInvalidPayload) {
+			return nil, logical.CodedError(http.StatusBadRequest, err.Error())
+		}
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"user_op_hash": hash,
+			"signature":    signature,
+		},
+	}, nil
+}
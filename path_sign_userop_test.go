@@ -0,0 +1,98 @@
+package vaultpoly
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/igwedaniel/vaultpoly/internal/adapters"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignUserOp(t *testing.T) {
+	b, s := getTestBackend(t)
+
+	resp, err := testWalletCreate(t, b, s, adapters.BlockchainETH.String(), map[string]interface{}{})
+	require.NoError(t, err)
+	address := resp.Data["address"].(string)
+
+	userOp := `{
+		"sender": "0x9406Cc6185a346906296840746125a0E44976454",
+		"nonce": "0x1",
+		"callData": "0xb61d27f6",
+		"callGasLimit": "0x186a0",
+		"verificationGasLimit": "0x30d40",
+		"preVerificationGas": "0xc350",
+		"maxFeePerGas": "0xb2d05e00",
+		"maxPriorityFeePerGas": "0x3b9aca00"
+	}`
+
+	t.Run("Sign UserOperation v0.7 - pass", func(t *testing.T) {
+		resp, err := testSignUserOp(t, b, s, address, map[string]interface{}{
+			"user_operation": userOp,
+			"entry_point":    "0x0000000071727De22E5E9d8BAf0edAc6f37da032",
+			"chain_id":       11155111,
+		})
+		require.NoError(t, err)
+		require.Nil(t, resp.Error())
+
+		hash := hexutil.MustDecode(resp.Data["user_op_hash"].(string))
+		signature := hexutil.MustDecode(resp.Data["signature"].(string))
+		require.Len(t, signature, 65)
+		require.Contains(t, []byte{27, 28}, signature[64])
+
+		signature[64] -= 27
+		pubKey, err := crypto.SigToPub(accounts.TextHash(hash), signature)
+		require.NoError(t, err)
+		require.Equal(t, strings.ToLower(address), strings.ToLower(crypto.PubkeyToAddress(*pubKey).Hex()))
+	})
+
+	t.Run("Hash depends on entry point version", func(t *testing.T) {
+		v06, err := testSignUserOp(t, b, s, address, map[string]interface{}{
+			"user_operation": userOp,
+			"entry_point":    "0x5FF137D4b0FDCD49DcA30c7CF57E578a026d2789",
+			"chain_id":       11155111,
+		})
+		require.NoError(t, err)
+		v07, err := testSignUserOp(t, b, s, address, map[string]interface{}{
+			"user_operation": userOp,
+			"entry_point":    "0x0000000071727De22E5E9d8BAf0edAc6f37da032",
+			"chain_id":       11155111,
+		})
+		require.NoError(t, err)
+		require.NotEqual(t, v06.Data["user_op_hash"], v07.Data["user_op_hash"])
+	})
+
+	t.Run("Unknown entry point - fail", func(t *testing.T) {
+		_, err := testSignUserOp(t, b, s, address, map[string]interface{}{
+			"user_operation": userOp,
+			"entry_point":    "0x0000000000000000000000000000000000000001",
+			"chain_id":       11155111,
+		})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "allowlist")
+	})
+
+	t.Run("Unknown user operation field - fail", func(t *testing.T) {
+		_, err := testSignUserOp(t, b, s, address, map[string]interface{}{
+			"user_operation": `{"sender": "0x9406Cc6185a346906296840746125a0E44976454", "bogus": 1}`,
+			"entry_point":    "0x0000000071727De22E5E9d8BAf0edAc6f37da032",
+			"chain_id":       11155111,
+		})
+		require.Error(t, err)
+	})
+}
+
+func testSignUserOp(t *testing.T, b *pluginBackend, s logical.Storage, address string, d map[string]interface{}) (*logical.Response, error) {
+	t.Helper()
+	return b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "wallets/eth/" + address + "/sign-userop",
+		Data:      d,
+		Storage:   s,
+	})
+}
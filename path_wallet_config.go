@@ -0,0 +1,188 @@
+package vaultpoly
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/igwedaniel/vaultpoly/internal/adapters"
+)
+
+// walletConfig holds per-wallet signing settings. It is stored outside the
+// wallets/ prefix so listing wallets is unaffected.
+type walletConfig struct {
+	Caps              adapters.TxCaps `json:"caps"`
+	AllowDelegateCall bool            `json:"allow_delegatecall"`
+	ChangeWallets     []string        `json:"change_wallets"`
+	// FeeLimits bound bitcoin fees; unset rate and fee limits take the
+	// adapter defaults.
+	FeeLimits adapters.BtcFeeLimits `json:"fee_limits"`
+}
+
+func walletConfigPath(blockchainType adapters.BlockchainType, address string) string {
+	return fmt.Sprintf("wallet-config/%s/%s", blockchainType, address)
+}
+
+func pathWalletConfig(b *pluginBackend) []*framework.Path {
+	fields := capsFields()
+	fields["blockchainType"] = &framework.FieldSchema{
+		Type:          framework.TypeString,
+		Required:      true,
+		Description:   "The blockchain type for the account. Currently supported: 'eth', 'btc', 'tbtc', 'btc-testnet3', 'btc-signet', 'btc-regtest'.",
+		AllowedValues: adapters.AllowedBlockchains(),
+	}
+	fields["address"] = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Required:    true,
+		Description: "The address of the wallet.",
+	}
+	fields["allow_delegatecall"] = &framework.FieldSchema{
+		Type:        framework.TypeBool,
+		Description: "Allow signing Safe transactions that use the delegatecall operation.",
+	}
+	fields["change_wallets"] = &framework.FieldSchema{
+		Type:        framework.TypeCommaStringSlice,
+		Description: "Addresses of other bitcoin wallets in this mount that may receive change.",
+	}
+	fields["max_fee_rate"] = &framework.FieldSchema{
+		Type:        framework.TypeFloat,
+		Description: "Maximum bitcoin fee rate in sat/vbyte. 0 uses the default of 10000.",
+	}
+	fields["max_fee"] = &framework.FieldSchema{
+		Type:        framework.TypeInt64,
+		Description: "Maximum bitcoin fee in sats. 0 uses the default of 10000000 (0.1 BTC).",
+	}
+	fields["max_fee_ratio"] = &framework.FieldSchema{
+		Type:        framework.TypeFloat,
+		Description: "Maximum bitcoin fee as a fraction of the amount paid, e.g. 0.05. 0 disables the check.",
+	}
+
+	return []*framework.Path{
+		{
+			Pattern:      "wallets/" + framework.GenericNameRegex("blockchainType") + "/" + framework.GenericNameRegex("address") + "/config",
+			HelpSynopsis: "Manage the signing settings of a wallet.",
+			HelpDescription: `
+
+    GET  - read the wallet settings
+    POST - update the wallet settings; omitted fields keep their current value
+
+The max_* fields are ethereum safety caps, in wei. They are enforced in
+addition to any caps configured for the chain under config/caps/<chain_id>.
+allow_delegatecall permits Safe transactions with operation 1.
+change_wallets lists other wallets of the same blockchain type in this mount
+that bitcoin payloads may name as change_address.
+max_fee_rate, max_fee and max_fee_ratio bound bitcoin fees; the .../sign/override
+path skips them along with the ethereum caps.
+`,
+			Fields: fields,
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation:   b.readWalletConfig,
+				logical.UpdateOperation: b.writeWalletConfig,
+			},
+		},
+	}
+}
+
+func (b *pluginBackend) getWalletConfig(ctx context.Context, s logical.Storage, blockchainType adapters.BlockchainType, address string) (*walletConfig, error) {
+	var config walletConfig
+	entry, err := s.Get(ctx, walletConfigPath(blockchainType, address))
+	if err != nil {
+		return nil, err
+	}
+	if entry != nil {
+		if err := entry.DecodeJSON(&config); err != nil {
+			return nil, err
+		}
+	}
+	config.Caps.Scope = fmt.Sprintf("wallet %s", address)
+	return &config, nil
+}
+
+func (b *pluginBackend) readWalletConfig(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	blockchainType := adapters.BlockchainType(d.Get("blockchainType").(string))
+	address := d.Get("address").(string)
+	if _, err := b.getWallet(ctx, req.Storage, blockchainType, address); err != nil {
+		return nil, err
+	}
+
+	config, err := b.getWalletConfig(ctx, req.Storage, blockchainType, address)
+	if err != nil {
+		return nil, err
+	}
+	return &logical.Response{Data: config.responseData()}, nil
+}
+
+func (b *pluginBackend) writeWalletConfig(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	blockchainType := adapters.BlockchainType(d.Get("blockchainType").(string))
+	address := d.Get("address").(string)
+	if _, err := b.getWallet(ctx, req.Storage, blockchainType, address); err != nil {
+		return nil, err
+	}
+
+	config, err := b.getWalletConfig(ctx, req.Storage, blockchainType, address)
+	if err != nil {
+		return nil, err
+	}
+	if err := updateCaps(&config.Caps, d); err != nil {
+		return nil, logical.CodedError(http.StatusBadRequest, err.Error())
+	}
+	if allow, ok := d.GetOk("allow_delegatecall"); ok {
+		config.AllowDelegateCall = allow.(bool)
+	}
+	if err := updateFeeLimits(&config.FeeLimits, d); err != nil {
+		return nil, logical.CodedError(http.StatusBadRequest, err.Error())
+	}
+	if changeWallets, ok := d.GetOk("change_wallets"); ok {
+		config.ChangeWallets = changeWallets.([]string)
+		for _, changeWallet := range config.ChangeWallets {
+			if _, err := b.getWallet(ctx, req.Storage, blockchainType, changeWallet); err != nil {
+				return nil, logical.CodedError(http.StatusBadRequest, fmt.Sprintf("change wallet %s: %v", changeWallet, err))
+			}
+		}
+	}
+
+	entry, err := logical.StorageEntryJSON(walletConfigPath(blockchainType, address), config)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(ctx, entry); err != nil {
+		b.Logger().Error("Failed to save wallet config", "address", address, "error", err)
+		return nil, err
+	}
+	return &logical.Response{Data: config.responseData()}, nil
+}
+
+func (c *walletConfig) responseData() map[string]interface{} {
+	data := capsResponseData(&c.Caps)
+	data["allow_delegatecall"] = c.AllowDelegateCall
+	data["change_wallets"] = c.ChangeWallets
+	data["max_fee_rate"] = c.FeeLimits.MaxFeeRate
+	data["max_fee"] = c.FeeLimits.MaxFee
+	data["max_fee_ratio"] = c.FeeLimits.MaxFeeRatio
+	return data
+}
+
+// updateFeeLimits applies the bitcoin fee limit fields present in d to limits.
+func updateFeeLimits(limits *adapters.BtcFeeLimits, d *framework.FieldData) error {
+	if raw, ok := d.GetOk("max_fee_rate"); ok {
+		if raw.(float64) < 0 {
+			return fmt.Errorf("max_fee_rate must not be negative")
+		}
+		limits.MaxFeeRate = raw.(float64)
+	}
+	if raw, ok := d.GetOk("max_fee"); ok {
+		if raw.(int64) < 0 {
+			return fmt.Errorf("max_fee must not be negative")
+		}
+		limits.MaxFee = raw.(int64)
+	}
+	if raw, ok := d.GetOk("max_fee_ratio"); ok {
+		if raw.(float64) < 0 {
+			return fmt.Errorf("max_fee_ratio must not be negative")
+		}
+		limits.MaxFeeRatio = raw.(float64)
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package vaultpoly
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/igwedaniel/vaultpoly/internal/adapters"
+)
+
+func pathWalletExport(b *pluginBackend) []*framework.Path {
+	fields := func(blockchains string) map[string]*framework.FieldSchema {
+		return map[string]*framework.FieldSchema{
+			"blockchainType": {
+				Type:          framework.TypeString,
+				Required:      true,
+				Description:   "The blockchain type for the account. Currently supported: " + blockchains + ".",
+				AllowedValues: adapters.AllowedBlockchains(),
+			},
+			"address": {
+				Type:        framework.TypeString,
+				Required:    true,
+				Description: "The address of the wallet.",
+			},
+		}
+	}
+
+	return []*framework.Path{
+		{
+			Pattern:      "wallets/" + framework.GenericNameRegex("blockchainType") + "/" + framework.GenericNameRegex("address") + "/xpub",
+			HelpSynopsis: "Read the extended public key of a wallet's HD account.",
+			HelpDescription: `
+	GET - read the account xpub, its master key fingerprint and derivation path
+
+The wallet key is the account's first receive key, <derivation_path>/0/0.
+Bitcoin p2wpkh and p2sh_p2wpkh wallets also return the SLIP-132 zpub or ypub
+(vpub or upub on test networks). Wallets created before HD derivation, and
+imported ones, have no account.
+`,
+			Fields: fields("'eth', 'btc', 'tbtc', 'btc-testnet3', 'btc-signet', 'btc-regtest'"),
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation: b.readWalletXpub,
+			},
+		},
+		{
+			Pattern:      "wallets/" + framework.GenericNameRegex("blockchainType") + "/" + framework.GenericNameRegex("address") + "/descriptors",
+			HelpSynopsis: "Read the BIP380 output descriptors of a bitcoin wallet.",
+			HelpDescription: `
+	GET - read the wallet's output descriptors, with checksums
+
+descriptor covers the receive addresses <account>/0/* of the wallet's HD
+account, for watch-only wallets and indexers; the wallet signs for every one
+of them. change_descriptor covers the account's change addresses
+<account>/1/*, where HD wallets pay their change. address_descriptor covers
+the wallet address alone and is returned for every wallet.
+`,
+			Fields: fields("'btc', 'tbtc', 'btc-testnet3', 'btc-signet', 'btc-regtest'"),
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation: b.readWalletDescriptors,
+			},
+		},
+	}
+}
+
+func (b *pluginBackend) readWalletXpub(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	blockchainType := adapters.BlockchainType(d.Get("blockchainType").(string))
+	if !blockchainType.IsValid() {
+		return nil, fmt.Errorf("invalid blockchain type: %s", blockchainType)
+	}
+	adapter, err := b.getAdapter(ctx, req.Storage, blockchainType)
+	if err != nil {
+		return nil, err
+	}
+	exporter, ok := adapter.(adapters.AccountExporter)
+	if !ok {
+		return nil, logical.CodedError(http.StatusBadRequest, fmt.Sprintf("account export is not supported for %s", blockchainType))
+	}
+	wallet, err := b.getWallet(ctx, req.Storage, blockchainType, d.Get("address").(string))
+	if err != nil {
+		return nil, err
+	}
+
+	account, err := exporter.ExportAccount(wallet)
+	if err != nil {
+		if errors.Is(err, adapters.ErrNoHDAccount) {
+			return nil, logical.CodedError(http.StatusBadRequest, err.Error())
+		}
+		return nil, err
+	}
+
+	data := map[string]interface{}{
+		"address":         wallet.PublicKey,
+		"xpub":            account.ExtendedKey,
+		"fingerprint":     account.Fingerprint,
+		"derivation_path": account.Path,
+	}
+	if account.SLIP132Key != "" {
+		data["slip132_xpub"] = account.SLIP132Key
+	}
+	return &logical.Response{Data: data}, nil
+}
+
+func (b *pluginBackend) readWalletDescriptors(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	blockchainType := adapters.BlockchainType(d.Get("blockchainType").(string))
+	if !blockchainType.IsValid() {
+		return nil, fmt.Errorf("invalid blockchain type: %s", blockchainType)
+	}
+	adapter, err := b.getAdapter(ctx, req.Storage, blockchainType)
+	if err != nil {
+		return nil, err
+	}
+	exporter, ok := adapter.(adapters.DescriptorExporter)
+	if !ok {
+		return nil, logical.CodedError(http.StatusBadRequest, fmt.Sprintf("output descriptors are not supported for %s", blockchainType))
+	}
+	wallet, err := b.getWallet(ctx, req.Storage, blockchainType, d.Get("address").(string))
+	if err != nil {
+		return nil, err
+	}
+
+	descriptors, err := exporter.Descriptors(wallet)
+	if err != nil {
+		return nil, err
+	}
+
+	data := map[string]interface{}{
+		"address":            wallet.PublicKey,
+		"address_descriptor": descriptors.AddressDescriptor,
+	}
+	if descriptors.Descriptor != "" {
+		data["descriptor"] = descriptors.Descriptor
+		data["change_descriptor"] = descriptors.ChangeDescriptor
+	}
+	return &logical.Response{Data: data}, nil
+}
@@ -0,0 +1,105 @@
+package vaultpoly
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/igwedaniel/vaultpoly/internal/adapters"
+	"github.com/stretchr/testify/require"
+)
+
+// extendedPrivateKey matches a serialised xprv or tprv, on its own or inside
+// a descriptor. Addresses and checksums are far shorter than its 107 base58
+// characters past the prefix.
+var extendedPrivateKey = regexp.MustCompile(`[xt]prv[1-9A-HJ-NP-Za-km-z]{100,}`)
+
+func TestWalletExport(t *testing.T) {
+	b, s := getTestBackend(t)
+
+	read := func(blockchainType, address, export string) (*logical.Response, error) {
+		return b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      "wallets/" + blockchainType + "/" + address + "/" + export,
+			Storage:   s,
+		})
+	}
+	requirePublic := func(t *testing.T, resp *logical.Response, wallet *adapters.Wallet) {
+		t.Helper()
+		for key, value := range resp.Data {
+			require.NotContains(t, key, "private")
+			str := value.(string)
+			for _, secret := range []string{wallet.PrivateKey, wallet.AccountKey} {
+				if secret != "" {
+					require.NotContains(t, str, secret)
+				}
+			}
+			require.NotRegexp(t, extendedPrivateKey, str, "%s carries an extended private key", key)
+		}
+	}
+
+	t.Run("Read BTC xpub and descriptors - pass", func(t *testing.T) {
+		resp, err := testWalletCreate(t, b, s, adapters.BlockchainBTCTestnet.String(), map[string]interface{}{})
+		require.NoError(t, err)
+		address := resp.Data["address"].(string)
+		wallet, err := b.getWallet(context.Background(), s, adapters.BlockchainBTCTestnet, address)
+		require.NoError(t, err)
+		require.True(t, strings.HasPrefix(wallet.AccountKey, "tprv"), "the account key is sealed in the wallet entry")
+		require.Regexp(t, extendedPrivateKey, wallet.AccountKey)
+
+		resp, err = read(adapters.BlockchainBTCTestnet.String(), address, "xpub")
+		require.NoError(t, err)
+		require.Equal(t, "m/84h/1h/0h", resp.Data["derivation_path"])
+		require.True(t, strings.HasPrefix(resp.Data["xpub"].(string), "tpub"))
+		require.True(t, strings.HasPrefix(resp.Data["slip132_xpub"].(string), "vpub"))
+		requirePublic(t, resp, wallet)
+
+		resp, err = read(adapters.BlockchainBTCTestnet.String(), address, "descriptors")
+		require.NoError(t, err)
+		require.Equal(t, address, resp.Data["address"])
+		require.True(t, strings.HasPrefix(resp.Data["descriptor"].(string), "wpkh(["+wallet.Account.Fingerprint+"/84h/1h/0h]tpub"))
+		require.Contains(t, resp.Data["descriptor"], "/0/*)#")
+		require.Contains(t, resp.Data["change_descriptor"], "/1/*)#")
+		require.Contains(t, resp.Data["address_descriptor"], "/84h/1h/0h/0/0]")
+		requirePublic(t, resp, wallet)
+	})
+
+	t.Run("Read ETH xpub - pass", func(t *testing.T) {
+		resp, err := testWalletCreate(t, b, s, adapters.BlockchainETH.String(), map[string]interface{}{})
+		require.NoError(t, err)
+		address := resp.Data["address"].(string)
+		wallet, err := b.getWallet(context.Background(), s, adapters.BlockchainETH, address)
+		require.NoError(t, err)
+
+		resp, err = read(adapters.BlockchainETH.String(), address, "xpub")
+		require.NoError(t, err)
+		require.Equal(t, "m/44h/60h/0h", resp.Data["derivation_path"])
+		require.True(t, strings.HasPrefix(resp.Data["xpub"].(string), "xpub"))
+		require.NotContains(t, resp.Data, "slip132_xpub")
+		requirePublic(t, resp, wallet)
+
+		_, err = read(adapters.BlockchainETH.String(), address, "descriptors")
+		var coded logical.HTTPCodedError
+		require.ErrorAs(t, err, &coded)
+		require.Equal(t, http.StatusBadRequest, coded.Code())
+	})
+
+	t.Run("Read xpub of wallet without account - fail", func(t *testing.T) {
+		wallet := &adapters.Wallet{
+			PublicKey:  "0xf39Fd6e51aad88F6F4ce6aB8827279cffFb92266",
+			PrivateKey: "ac0974bec39a17e36ba4a6b4d238ff944bacb478cbed5efcae784d7bf4f2ff80",
+		}
+		entry, err := logical.StorageEntryJSON("wallets/eth/"+wallet.PublicKey, wallet)
+		require.NoError(t, err)
+		require.NoError(t, s.Put(context.Background(), entry))
+
+		_, err = read(adapters.BlockchainETH.String(), wallet.PublicKey, "xpub")
+		var coded logical.HTTPCodedError
+		require.ErrorAs(t, err, &coded)
+		require.Equal(t, http.StatusBadRequest, coded.Code())
+		require.ErrorContains(t, err, "not derived from an HD seed")
+	})
+}
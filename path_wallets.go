@@ -2,7 +2,9 @@ package vaultpoly
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
 
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/logical"
@@ -27,14 +29,15 @@ func walletsPaths(b *pluginBackend) []*framework.Path {
 			HelpDescription: `
 
     LIST - list all wallets for a given blockchain type
-    POST - create a new account for a given blockchain type.
+    POST - create a new account for a given blockchain type, or import one
+           from an encrypted keystore (eth only) when keystore is set.
 
 `,
 			Fields: map[string]*framework.FieldSchema{
 				"blockchainType": {
 					Type:          framework.TypeString,
 					Default:       "eth",
-					Description:   "The blockchain type for the account. Currently supported: 'eth', 'btc', 'tbtc'.",
+					Description:   "The blockchain type for the account. Currently supported: 'eth', 'btc', 'tbtc', 'btc-testnet3', 'btc-signet', 'btc-regtest'.",
 					AllowedValues: adapters.AllowedBlockchains(),
 				},
 				"mnemonic": {
@@ -42,6 +45,24 @@ func walletsPaths(b *pluginBackend) []*framework.Path {
 					Default:     Empty,
 					Description: "The mnemonic to use to create the account. If not provided, one is generated.",
 				},
+				"address_type": {
+					Type:        framework.TypeString,
+					Default:     Empty,
+					Description: "The address type of a new btc wallet: 'p2wpkh' (default), 'p2tr' (BIP86 taproot) or 'p2sh_p2wpkh' (nested segwit).",
+				},
+				"keystore": {
+					Type:        framework.TypeString,
+					Default:     Empty,
+					Description: "A keystore v3 JSON file (scrypt or pbkdf2) to import instead of creating a new key.",
+				},
+				"password": {
+					Type:        framework.TypeString,
+					Default:     Empty,
+					Description: "The password of the keystore. Used only for decryption; it is never stored.",
+					DisplayAttrs: &framework.DisplayAttributes{
+						Sensitive: true,
+					},
+				},
 			},
 
 			Callbacks: map[logical.Operation]framework.OperationFunc{
@@ -67,34 +88,123 @@ func (b *pluginBackend) pathAccountsCreate(ctx context.Context, req *logical.Req
 	if !blockchainType.IsValid() {
 		return nil, fmt.Errorf("invalid blockchain type: %s", blockchainType)
 	}
-	adapter, err := adapters.GetAdapter(blockchainType)
+	adapter, err := b.getAdapter(ctx, req.Storage, blockchainType)
 	if err != nil {
 		return nil, err
 	}
 
-	wallet, err := adapter.DeriveWallet()
+	var wallet *adapters.Wallet
+	if keystoreJSON := d.Get("keystore").(string); keystoreJSON != "" {
+		wallet, err = b.importKeystore(ctx, req.Storage, adapter, blockchainType, keystoreJSON, d.Get("password").(string))
+		if err != nil {
+			return nil, err
+		}
+	} else if addressType := d.Get("address_type").(string); addressType != "" {
+		wallet, err = b.deriveWalletOfType(adapter, blockchainType, addressType)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		wallet, err = adapter.DeriveWallet()
+		if err != nil {
+			b.Logger().Error("Failed to create wallet", "error", err)
+			return nil, fmt.Errorf("failed to create wallet: %w", err)
+		}
+	}
+
+	if err := b.putWallet(ctx, req.Storage, blockchainType, wallet); err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"address": wallet.PublicKey,
+		},
+	}, nil
+}
+
+// deriveWalletOfType creates a wallet with the requested address type on
+// adapters that support more than one.
+func (b *pluginBackend) deriveWalletOfType(adapter adapters.BlockchainAdapter, blockchainType adapters.BlockchainType, addressType string) (*adapters.Wallet, error) {
+	deriver, ok := adapter.(adapters.AddressTypeDeriver)
+	if !ok {
+		return nil, logical.CodedError(http.StatusBadRequest, fmt.Sprintf("address_type is not supported for %s", blockchainType))
+	}
+
+	wallet, err := deriver.DeriveWalletOfType(addressType)
 	if err != nil {
+		if errors.Is(err, adapters.ErrInvalidPayload) {
+			return nil, logical.CodedError(http.StatusBadRequest, err.Error())
+		}
 		b.Logger().Error("Failed to create wallet", "error", err)
 		return nil, fmt.Errorf("failed to create wallet: %w", err)
 	}
+	return wallet, nil
+}
+
+// importKeystore decrypts a keystore into a wallet, refusing to overwrite a
+// wallet that already exists. The password is never logged.
+func (b *pluginBackend) importKeystore(ctx context.Context, s logical.Storage, adapter adapters.BlockchainAdapter, blockchainType adapters.BlockchainType, keystoreJSON, password string) (*adapters.Wallet, error) {
+	importer, ok := adapter.(adapters.KeystoreImporter)
+	if !ok {
+		return nil, logical.CodedError(http.StatusBadRequest, fmt.Sprintf("keystore import is not supported for %s", blockchainType))
+	}
 
+	wallet, err := importer.ImportKeystore([]byte(keystoreJSON), password)
+	if err != nil {
+		if errors.Is(err, adapters.ErrInvalidPayload) || errors.Is(err, adapters.ErrKeystoreDecrypt) {
+			return nil, logical.CodedError(http.StatusBadRequest, err.Error())
+		}
+		b.Logger().Error("Failed to import keystore", "error", err)
+		return nil, fmt.Errorf("failed to import keystore: %w", err)
+	}
+
+	existing, err := s.Get(ctx, fmt.Sprintf("wallets/%s/%s", blockchainType, wallet.PublicKey))
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, logical.CodedError(http.StatusConflict, fmt.Sprintf("wallet %s already exists", wallet.PublicKey))
+	}
+	return wallet, nil
+}
+
+// putWallet stores the wallet entry.
+func (b *pluginBackend) putWallet(ctx context.Context, s logical.Storage, blockchainType adapters.BlockchainType, wallet *adapters.Wallet) error {
 	walletPath := fmt.Sprintf("wallets/%s/%s", blockchainType, wallet.PublicKey)
 
 	entry, err := logical.StorageEntryJSON(walletPath, wallet)
 	if err != nil {
 		b.Logger().Error("Failed to create storage entry for wallet", "error", err)
-		return nil, fmt.Errorf("failed to create storage entry for wallet: %w", err)
+		return fmt.Errorf("failed to create storage entry for wallet: %w", err)
+	}
+
+	if err := s.Put(ctx, entry); err != nil {
+		b.Logger().Error("Failed to save the wallet to storage", "path", walletPath, "error", err)
+		return err
 	}
+	return nil
+}
 
-	err = req.Storage.Put(ctx, entry)
+func (b *pluginBackend) getWallet(ctx context.Context, s logical.Storage, blockchainType adapters.BlockchainType, address string) (*adapters.Wallet, error) {
+	if !blockchainType.IsValid() {
+		return nil, fmt.Errorf("invalid blockchain type: %s", blockchainType)
+	}
+	if address == "" {
+		return nil, fmt.Errorf("wallet address is required")
+	}
+	walletPath := fmt.Sprintf("wallets/%s/%s", blockchainType, address)
+	entry, err := s.Get(ctx, walletPath)
 	if err != nil {
-		b.Logger().Error("Failed to save the new account to storage", "error", err)
+		b.Logger().Error("Failed to retrieve the account by address", "path", walletPath, "error", err)
 		return nil, err
 	}
-
-	return &logical.Response{
-		Data: map[string]interface{}{
-			"address": wallet.PublicKey,
-		},
-	}, nil
+	if entry == nil {
+		return nil, logical.CodedError(http.StatusExpectationFailed, fmt.Sprintf("no account found for address: %s", address))
+	}
+	var wallet adapters.Wallet
+	if err := entry.DecodeJSON(&wallet); err != nil {
+		return nil, err
+	}
+	return &wallet, nil
 }
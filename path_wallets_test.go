@@ -2,8 +2,13 @@ package vaultpoly
 
 import (
 	"context"
+	"fmt"
+	"strings"
 	"testing"
 
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/google/uuid"
 	"github.com/hashicorp/vault/sdk/logical"
 	"github.com/igwedaniel/vaultpoly/internal/adapters"
 	"github.com/stretchr/testify/require"
@@ -43,6 +48,127 @@ func TestWallets(t *testing.T) {
 		require.NotEmpty(t, resp.Data["address"])
 	})
 
+	t.Run("Create Wallet - pass BTC taproot", func(t *testing.T) {
+		resp, err := testWalletCreate(t, b, s, adapters.BlockchainBTCTestnet.String(), map[string]interface{}{
+			"address_type": "p2tr",
+		})
+
+		require.NoError(t, err)
+		require.True(t, strings.HasPrefix(resp.Data["address"].(string), "tb1p"))
+	})
+
+	t.Run("Create Wallet - pass BTC nested segwit", func(t *testing.T) {
+		resp, err := testWalletCreate(t, b, s, adapters.BlockchainBTCTestnet.String(), map[string]interface{}{
+			"address_type": "p2sh_p2wpkh",
+		})
+
+		require.NoError(t, err)
+		require.True(t, strings.HasPrefix(resp.Data["address"].(string), "2"))
+	})
+
+	t.Run("Create Wallet - unknown address type - fail", func(t *testing.T) {
+		_, err := testWalletCreate(t, b, s, adapters.BlockchainBTCTestnet.String(), map[string]interface{}{
+			"address_type": "p2sh",
+		})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "address_type")
+	})
+
+	t.Run("Create Wallet - address type for ETH - fail", func(t *testing.T) {
+		_, err := testWalletCreate(t, b, s, adapters.BlockchainETH.String(), map[string]interface{}{
+			"address_type": "p2tr",
+		})
+		require.Error(t, err)
+	})
+
+}
+
+func TestWalletImportKeystore(t *testing.T) {
+	b, s := getTestBackend(t)
+
+	t.Run("Import scrypt keystore - pass", func(t *testing.T) {
+		privateKey, err := crypto.GenerateKey()
+		require.NoError(t, err)
+		id, err := uuid.NewRandom()
+		require.NoError(t, err)
+		keyJSON, err := keystore.EncryptKey(&keystore.Key{
+			Id:         id,
+			Address:    crypto.PubkeyToAddress(privateKey.PublicKey),
+			PrivateKey: privateKey,
+		}, "correct horse", keystore.LightScryptN, keystore.LightScryptP)
+		require.NoError(t, err)
+
+		resp, err := testWalletCreate(t, b, s, adapters.BlockchainETH.String(), map[string]interface{}{
+			"keystore": string(keyJSON),
+			"password": "correct horse",
+		})
+		require.NoError(t, err)
+		require.Equal(t, crypto.PubkeyToAddress(privateKey.PublicKey).Hex(), resp.Data["address"])
+
+		entry, err := s.Get(context.Background(), "wallets/eth/"+resp.Data["address"].(string))
+		require.NoError(t, err)
+		require.NotNil(t, entry)
+		require.NotContains(t, string(entry.Value), "correct horse")
+
+		_, err = testWalletCreate(t, b, s, adapters.BlockchainETH.String(), map[string]interface{}{
+			"keystore": string(keyJSON),
+			"password": "correct horse",
+		})
+		require.Error(t, err, "importing the same key twice should not overwrite the wallet")
+	})
+
+	// Test vector from the Web3 Secret Storage definition.
+	pbkdf2Keystore := `{
+		"address": "%s",
+		"crypto": {
+			"cipher": "aes-128-ctr",
+			"cipherparams": {"iv": "6087dab2f9fdbbfaddc31a909735c1e6"},
+			"ciphertext": "5318b4d5bcd28de64ee5559e671353e16f075ecae9f99c7a79a38af5f869aa46",
+			"kdf": "pbkdf2",
+			"kdfparams": {"c": 262144, "dklen": 32, "prf": "hmac-sha256", "salt": "ae3cd4e7013836a3df6bd7241b12db061dbe2c6785853cce422d148a624ce0bd"},
+			"mac": "517ead924a9d0dc3124507e3393d175ce3ff7c1e96529c6c555ce9e51205e9b2"
+		},
+		"id": "3198bc9c-6672-5ab3-d995-4942343ae5b6",
+		"version": 3
+	}`
+	vectorKey, err := crypto.HexToECDSA("7a28b5ba57c53603b0b07b56bba752f7784bf506fa95edc395f5cf6c7514fe9d")
+	require.NoError(t, err)
+	vectorAddress := crypto.PubkeyToAddress(vectorKey.PublicKey)
+
+	t.Run("Import pbkdf2 keystore wrong password - fail", func(t *testing.T) {
+		_, err := testWalletCreate(t, b, s, adapters.BlockchainETH.String(), map[string]interface{}{
+			"keystore": fmt.Sprintf(pbkdf2Keystore, vectorAddress.Hex()),
+			"password": "wrongpassword",
+		})
+		require.Error(t, err)
+		require.NotContains(t, err.Error(), "wrongpassword")
+	})
+
+	t.Run("Import pbkdf2 keystore address mismatch - fail", func(t *testing.T) {
+		_, err := testWalletCreate(t, b, s, adapters.BlockchainETH.String(), map[string]interface{}{
+			"keystore": fmt.Sprintf(pbkdf2Keystore, "0x337610d27c682E347C9cD60BD4b3b107C9d34dDd"),
+			"password": "testpassword",
+		})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "does not match")
+	})
+
+	t.Run("Import pbkdf2 keystore - pass", func(t *testing.T) {
+		resp, err := testWalletCreate(t, b, s, adapters.BlockchainETH.String(), map[string]interface{}{
+			"keystore": fmt.Sprintf(pbkdf2Keystore, strings.ToLower(vectorAddress.Hex()[2:])),
+			"password": "testpassword",
+		})
+		require.NoError(t, err)
+		require.Equal(t, vectorAddress.Hex(), resp.Data["address"])
+	})
+
+	t.Run("Import keystore for btc - fail", func(t *testing.T) {
+		_, err := testWalletCreate(t, b, s, adapters.BlockchainBTCTestnet.String(), map[string]interface{}{
+			"keystore": fmt.Sprintf(pbkdf2Keystore, vectorAddress.Hex()),
+			"password": "testpassword",
+		})
+		require.Error(t, err)
+	})
 }
 
 func testWalletCreate(t *testing.T, b *pluginBackend, s logical.Storage, blockchainType string, d map[string]interface{}) (*logical.Response, error) {